@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rjseymour66/library-go/core"
+	"github.com/rjseymour66/library-go/util"
+)
+
+// runCommand runs a subcommand of the library binary:
+//
+//	library import-csv [-dry-run] FILE
+//	library export-csv [-search TERM] [-o FILE]
+func runCommand(name string, args []string) (err error) {
+	switch name {
+	case "import-csv":
+		return importCSVCommand(args)
+	case "export-csv":
+		return exportCSVCommand(args)
+	default:
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
+
+func importCSVCommand(args []string) (err error) {
+	flags := flag.NewFlagSet("import-csv", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "validate the rows without touching the database")
+
+	err = flags.Parse(args)
+	if err != nil {
+		return
+	}
+
+	if flags.NArg() != 1 {
+		return errors.New("usage: library import-csv [-dry-run] FILE")
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	ctx := context.Background()
+
+	// A dry run does not need the database
+	if !*dryRun {
+		ctx, err = prepareCommandDb(ctx)
+		if err != nil {
+			return
+		}
+	}
+
+	report, err := core.ImportCSV(ctx, *dryRun, file)
+	if err != nil {
+		return
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+func exportCSVCommand(args []string) (err error) {
+	flags := flag.NewFlagSet("export-csv", flag.ContinueOnError)
+	searchTerm := flags.String("search", "", "only export books that match the search term")
+	output := flags.String("o", "", "write to the file instead of standard output")
+
+	err = flags.Parse(args)
+	if err != nil {
+		return
+	}
+
+	ctx, err := prepareCommandDb(context.Background())
+	if err != nil {
+		return
+	}
+
+	response, err := core.ExportCSV(ctx, &core.ListParams{SearchTerm: *searchTerm})
+	if err != nil {
+		return
+	}
+
+	var writer io.Writer = os.Stdout
+	if *output != "" {
+		file, errCreate := os.Create(*output)
+		if errCreate != nil {
+			return errCreate
+		}
+		defer file.Close()
+		writer = file
+	}
+
+	return response.(*util.StreamResponse).WriteBody(writer)
+}
+
+func prepareCommandDb(ctx context.Context) (context.Context, error) {
+	err := dbserver.InitializeDb()
+	if err != nil {
+		return ctx, err
+	}
+
+	return dbserver.PrepareDbRunner(ctx), nil
+}
@@ -0,0 +1,70 @@
+package config
+
+import "time"
+
+var (
+	// GetAuthSessionIdleTimeout returns the session_idle_timeout
+	// value from the [auth] section in the .toml config file
+	GetAuthSessionIdleTimeout = getAuthSessionIdleTimeout
+
+	// GetAuthSessionMaxLifetime returns the session_max_lifetime
+	// value from the [auth] section in the .toml config file
+	GetAuthSessionMaxLifetime = getAuthSessionMaxLifetime
+
+	// GetAuthSessionCleanupInterval returns the
+	// session_cleanup_interval value from the [auth] section in the
+	// .toml config file
+	GetAuthSessionCleanupInterval = getAuthSessionCleanupInterval
+
+	// GetAuthJWTKeyFiles returns the jwt_key_files value from the
+	// [auth] section in the .toml config file
+	GetAuthJWTKeyFiles = getAuthJWTKeyFiles
+
+	// GetAuthJWTSigningKey returns the jwt_signing_key value from
+	// the [auth] section in the .toml config file
+	GetAuthJWTSigningKey = getAuthJWTSigningKey
+
+	// GetAuthJWTLifetime returns the jwt_lifetime value from the
+	// [auth] section in the .toml config file
+	GetAuthJWTLifetime = getAuthJWTLifetime
+
+	// GetAuthPermissionCacheTTL returns the permission_cache_ttl
+	// value from the [auth] section in the .toml config file
+	GetAuthPermissionCacheTTL = getAuthPermissionCacheTTL
+
+	// GetAuthAuthenticators returns the authenticators value from the
+	// [auth] section in the .toml config file
+	GetAuthAuthenticators = getAuthAuthenticators
+)
+
+func getAuthSessionIdleTimeout() time.Duration {
+	return getConfigDuration("auth.session_idle_timeout")
+}
+
+func getAuthSessionMaxLifetime() time.Duration {
+	return getConfigDuration("auth.session_max_lifetime")
+}
+
+func getAuthSessionCleanupInterval() time.Duration {
+	return getConfigDuration("auth.session_cleanup_interval")
+}
+
+func getAuthJWTKeyFiles() []string {
+	return getConfigStringSlice("auth.jwt_key_files")
+}
+
+func getAuthJWTSigningKey() string {
+	return getConfigString("auth.jwt_signing_key")
+}
+
+func getAuthJWTLifetime() time.Duration {
+	return getConfigDuration("auth.jwt_lifetime")
+}
+
+func getAuthPermissionCacheTTL() time.Duration {
+	return getConfigDuration("auth.permission_cache_ttl")
+}
+
+func getAuthAuthenticators() []string {
+	return getConfigStringSlice("auth.authenticators")
+}
@@ -55,3 +55,11 @@ func getConfigInt(key string) int {
 func getConfigDuration(key string) time.Duration {
 	return viper.GetDuration(key)
 }
+
+func getConfigStringSlice(key string) []string {
+	return viper.GetStringSlice(key)
+}
+
+func getConfigBool(key string) bool {
+	return viper.GetBool(key)
+}
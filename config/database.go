@@ -160,7 +160,7 @@ type Runner interface {
 	QueryRow(ctx context.Context, query string, args ...interface{}) (row *sql.Row)
 	Exec(ctx context.Context, query string, args ...interface{}) (res sql.Result, err error)
 	Prepare(ctx context.Context, query string) (stmt *sql.Stmt, err error)
-	IsInTranscation() bool
+	IsInTransaction() bool
 }
 
 func (run *dbRunner) Transact(ctx context.Context, txOptions *sql.TxOptions, txFunc func() error) (err error) {
@@ -331,7 +331,7 @@ type RowReader interface {
 	RowReaderFxs
 }
 
-func (rr *rowReader) ScanNext(hasMore bool) {
+func (rr *rowReader) ScanNext() (hasMore bool) {
 	if hasMore = rr.rows.Next(); hasMore {
 		err := rr.rows.Scan(rr.valuePtrs...)
 		rr.lastError = err
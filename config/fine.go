@@ -0,0 +1,45 @@
+package config
+
+import "time"
+
+var (
+	// GetFineDailyCharge returns the daily_charge value from the
+	// [fine] section in the .toml config file
+	GetFineDailyCharge = getFineDailyCharge
+
+	// GetFineGracePeriod returns the grace_period value from the
+	// [fine] section in the .toml config file
+	GetFineGracePeriod = getFineGracePeriod
+
+	// GetFineMaxPerItem returns the max_per_item value from the
+	// [fine] section in the .toml config file
+	GetFineMaxPerItem = getFineMaxPerItem
+
+	// GetFineBlockThreshold returns the block_threshold value from
+	// the [fine] section in the .toml config file
+	GetFineBlockThreshold = getFineBlockThreshold
+
+	// GetFineAccrualInterval returns the accrual_interval value
+	// from the [fine] section in the .toml config file
+	GetFineAccrualInterval = getFineAccrualInterval
+)
+
+func getFineDailyCharge() int {
+	return getConfigInt("fine.daily_charge")
+}
+
+func getFineGracePeriod() time.Duration {
+	return getConfigDuration("fine.grace_period")
+}
+
+func getFineMaxPerItem() int {
+	return getConfigInt("fine.max_per_item")
+}
+
+func getFineBlockThreshold() int {
+	return getConfigInt("fine.block_threshold")
+}
+
+func getFineAccrualInterval() time.Duration {
+	return getConfigDuration("fine.accrual_interval")
+}
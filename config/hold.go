@@ -0,0 +1,21 @@
+package config
+
+import "time"
+
+var (
+	// GetHoldPickupWindow returns the pickup_window value from
+	// the [hold] section in the .toml config file
+	GetHoldPickupWindow = getHoldPickupWindow
+
+	// GetHoldExpiryCheckInterval returns the expiry_check_interval
+	// value from the [hold] section in the .toml config file
+	GetHoldExpiryCheckInterval = getHoldExpiryCheckInterval
+)
+
+func getHoldPickupWindow() time.Duration {
+	return getConfigDuration("hold.pickup_window")
+}
+
+func getHoldExpiryCheckInterval() time.Duration {
+	return getConfigDuration("hold.expiry_check_interval")
+}
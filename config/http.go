@@ -14,6 +14,10 @@ var (
 	// GetHTTPReadTimeout returns the write_timeout value from
 	// the [http] section in the .toml config file
 	GetHTTPWriteTimeout = getHTTPWriteTimeout
+
+	// GetHTTPTrustForwardedFor returns the trust_forwarded_for value
+	// from the [http] section in the .toml config file
+	GetHTTPTrustForwardedFor = getHTTPTrustForwardedFor
 )
 
 func getHTTPServerAddress() string {
@@ -27,3 +31,7 @@ func getHTTPReadTimeout() time.Duration {
 func getHTTPWriteTimeout() time.Duration {
 	return getConfigDuration("http.write_timeout")
 }
+
+func getHTTPTrustForwardedFor() bool {
+	return getConfigBool("http.trust_forwarded_for")
+}
@@ -0,0 +1,93 @@
+package config
+
+import "time"
+
+var (
+	// GetLDAPURL returns the url value from the [ldap] section in the
+	// .toml config file
+	GetLDAPURL = getLDAPURL
+
+	// GetLDAPBindDN returns the bind_dn value from the [ldap] section
+	// in the .toml config file
+	GetLDAPBindDN = getLDAPBindDN
+
+	// GetLDAPBindPassword returns the bind_password value from the
+	// [ldap] section in the .toml config file
+	GetLDAPBindPassword = getLDAPBindPassword
+
+	// GetLDAPBaseDN returns the base_dn value from the [ldap] section
+	// in the .toml config file
+	GetLDAPBaseDN = getLDAPBaseDN
+
+	// GetLDAPUserObjectClass returns the user_object_class value from
+	// the [ldap] section in the .toml config file
+	GetLDAPUserObjectClass = getLDAPUserObjectClass
+
+	// GetLDAPUsernameAttribute returns the username_attribute value
+	// from the [ldap] section in the .toml config file
+	GetLDAPUsernameAttribute = getLDAPUsernameAttribute
+
+	// GetLDAPNameAttribute returns the name_attribute value from the
+	// [ldap] section in the .toml config file
+	GetLDAPNameAttribute = getLDAPNameAttribute
+
+	// GetLDAPEmailAttribute returns the email_attribute value from the
+	// [ldap] section in the .toml config file
+	GetLDAPEmailAttribute = getLDAPEmailAttribute
+
+	// GetLDAPGroupAttribute returns the group_attribute value from the
+	// [ldap] section in the .toml config file
+	GetLDAPGroupAttribute = getLDAPGroupAttribute
+
+	// GetLDAPGroupRoles returns the group_roles value from the [ldap]
+	// section in the .toml config file
+	GetLDAPGroupRoles = getLDAPGroupRoles
+
+	// GetLDAPTimeout returns the timeout value from the [ldap] section
+	// in the .toml config file
+	GetLDAPTimeout = getLDAPTimeout
+)
+
+func getLDAPURL() string {
+	return getConfigString("ldap.url")
+}
+
+func getLDAPBindDN() string {
+	return getConfigString("ldap.bind_dn")
+}
+
+func getLDAPBindPassword() string {
+	return getConfigString("ldap.bind_password")
+}
+
+func getLDAPBaseDN() string {
+	return getConfigString("ldap.base_dn")
+}
+
+func getLDAPUserObjectClass() string {
+	return getConfigString("ldap.user_object_class")
+}
+
+func getLDAPUsernameAttribute() string {
+	return getConfigString("ldap.username_attribute")
+}
+
+func getLDAPNameAttribute() string {
+	return getConfigString("ldap.name_attribute")
+}
+
+func getLDAPEmailAttribute() string {
+	return getConfigString("ldap.email_attribute")
+}
+
+func getLDAPGroupAttribute() string {
+	return getConfigString("ldap.group_attribute")
+}
+
+func getLDAPGroupRoles() []string {
+	return getConfigStringSlice("ldap.group_roles")
+}
+
+func getLDAPTimeout() time.Duration {
+	return getConfigDuration("ldap.timeout")
+}
@@ -0,0 +1,29 @@
+package config
+
+import "time"
+
+var (
+	// GetLoanPeriod returns the period value from the [loan]
+	// section in the .toml config file
+	GetLoanPeriod = getLoanPeriod
+
+	// GetLoanMaxRenewals returns the max_renewals value from the
+	// [loan] section in the .toml config file
+	GetLoanMaxRenewals = getLoanMaxRenewals
+
+	// GetLoanRenewalPeriod returns the renewal_period value from
+	// the [loan] section in the .toml config file
+	GetLoanRenewalPeriod = getLoanRenewalPeriod
+)
+
+func getLoanPeriod() time.Duration {
+	return getConfigDuration("loan.period")
+}
+
+func getLoanMaxRenewals() int {
+	return getConfigInt("loan.max_renewals")
+}
+
+func getLoanRenewalPeriod() time.Duration {
+	return getConfigDuration("loan.renewal_period")
+}
@@ -0,0 +1,61 @@
+package config
+
+import "time"
+
+var (
+	// GetLockoutBackoffBase returns the backoff_base value from the
+	// [lockout] section in the .toml config file
+	GetLockoutBackoffBase = getLockoutBackoffBase
+
+	// GetLockoutBackoffMax returns the backoff_max value from the
+	// [lockout] section in the .toml config file
+	GetLockoutBackoffMax = getLockoutBackoffMax
+
+	// GetLockoutUsernameThreshold returns the username_threshold
+	// value from the [lockout] section in the .toml config file
+	GetLockoutUsernameThreshold = getLockoutUsernameThreshold
+
+	// GetLockoutIPThreshold returns the ip_threshold value from the
+	// [lockout] section in the .toml config file
+	GetLockoutIPThreshold = getLockoutIPThreshold
+
+	// GetLockoutDuration returns the lockout_duration value from the
+	// [lockout] section in the .toml config file
+	GetLockoutDuration = getLockoutDuration
+
+	// GetLockoutResetAfter returns the reset_after value from the
+	// [lockout] section in the .toml config file
+	GetLockoutResetAfter = getLockoutResetAfter
+
+	// GetLockoutCleanupInterval returns the cleanup_interval value
+	// from the [lockout] section in the .toml config file
+	GetLockoutCleanupInterval = getLockoutCleanupInterval
+)
+
+func getLockoutBackoffBase() time.Duration {
+	return getConfigDuration("lockout.backoff_base")
+}
+
+func getLockoutBackoffMax() time.Duration {
+	return getConfigDuration("lockout.backoff_max")
+}
+
+func getLockoutUsernameThreshold() int {
+	return getConfigInt("lockout.username_threshold")
+}
+
+func getLockoutIPThreshold() int {
+	return getConfigInt("lockout.ip_threshold")
+}
+
+func getLockoutDuration() time.Duration {
+	return getConfigDuration("lockout.lockout_duration")
+}
+
+func getLockoutResetAfter() time.Duration {
+	return getConfigDuration("lockout.reset_after")
+}
+
+func getLockoutCleanupInterval() time.Duration {
+	return getConfigDuration("lockout.cleanup_interval")
+}
@@ -0,0 +1,19 @@
+package config
+
+var (
+	// GetNotifierType returns the type value from the [notifier]
+	// section in the .toml config file
+	GetNotifierType = getNotifierType
+
+	// GetNotifierTarget returns the target value from the
+	// [notifier] section in the .toml config file
+	GetNotifierTarget = getNotifierTarget
+)
+
+func getNotifierType() string {
+	return getConfigString("notifier.type")
+}
+
+func getNotifierTarget() string {
+	return getConfigString("notifier.target")
+}
@@ -0,0 +1,109 @@
+package config
+
+import "time"
+
+var (
+	// GetOIDCIssuer returns the issuer value from the [oidc] section
+	// in the .toml config file
+	GetOIDCIssuer = getOIDCIssuer
+
+	// GetOIDCClientID returns the client_id value from the [oidc]
+	// section in the .toml config file
+	GetOIDCClientID = getOIDCClientID
+
+	// GetOIDCClientSecret returns the client_secret value from the
+	// [oidc] section in the .toml config file
+	GetOIDCClientSecret = getOIDCClientSecret
+
+	// GetOIDCRedirectURI returns the redirect_uri value from the
+	// [oidc] section in the .toml config file
+	GetOIDCRedirectURI = getOIDCRedirectURI
+
+	// GetOIDCScopes returns the scopes value from the [oidc] section
+	// in the .toml config file
+	GetOIDCScopes = getOIDCScopes
+
+	// GetOIDCUsernameClaim returns the username_claim value from the
+	// [oidc] section in the .toml config file
+	GetOIDCUsernameClaim = getOIDCUsernameClaim
+
+	// GetOIDCRoleClaim returns the role_claim value from the [oidc]
+	// section in the .toml config file
+	GetOIDCRoleClaim = getOIDCRoleClaim
+
+	// GetOIDCClaimRoles returns the claim_roles value from the [oidc]
+	// section in the .toml config file
+	GetOIDCClaimRoles = getOIDCClaimRoles
+
+	// GetOIDCDefaultRole returns the default_role value from the
+	// [oidc] section in the .toml config file
+	GetOIDCDefaultRole = getOIDCDefaultRole
+
+	// GetOIDCLinkVerifiedEmail returns the link_verified_email value
+	// from the [oidc] section in the .toml config file
+	GetOIDCLinkVerifiedEmail = getOIDCLinkVerifiedEmail
+
+	// GetOIDCLoginTimeout returns the login_timeout value from the
+	// [oidc] section in the .toml config file
+	GetOIDCLoginTimeout = getOIDCLoginTimeout
+
+	// GetOIDCHTTPTimeout returns the http_timeout value from the
+	// [oidc] section in the .toml config file
+	GetOIDCHTTPTimeout = getOIDCHTTPTimeout
+
+	// GetOIDCCleanupInterval returns the cleanup_interval value from
+	// the [oidc] section in the .toml config file
+	GetOIDCCleanupInterval = getOIDCCleanupInterval
+)
+
+func getOIDCIssuer() string {
+	return getConfigString("oidc.issuer")
+}
+
+func getOIDCClientID() string {
+	return getConfigString("oidc.client_id")
+}
+
+func getOIDCClientSecret() string {
+	return getConfigString("oidc.client_secret")
+}
+
+func getOIDCRedirectURI() string {
+	return getConfigString("oidc.redirect_uri")
+}
+
+func getOIDCScopes() []string {
+	return getConfigStringSlice("oidc.scopes")
+}
+
+func getOIDCUsernameClaim() string {
+	return getConfigString("oidc.username_claim")
+}
+
+func getOIDCRoleClaim() string {
+	return getConfigString("oidc.role_claim")
+}
+
+func getOIDCClaimRoles() []string {
+	return getConfigStringSlice("oidc.claim_roles")
+}
+
+func getOIDCDefaultRole() string {
+	return getConfigString("oidc.default_role")
+}
+
+func getOIDCLinkVerifiedEmail() bool {
+	return getConfigBool("oidc.link_verified_email")
+}
+
+func getOIDCLoginTimeout() time.Duration {
+	return getConfigDuration("oidc.login_timeout")
+}
+
+func getOIDCHTTPTimeout() time.Duration {
+	return getConfigDuration("oidc.http_timeout")
+}
+
+func getOIDCCleanupInterval() time.Duration {
+	return getConfigDuration("oidc.cleanup_interval")
+}
@@ -0,0 +1,62 @@
+package config
+
+import "time"
+
+var (
+	// GetPasswordMinLength returns the min_length value from the
+	// [password] section in the .toml config file
+	GetPasswordMinLength = getPasswordMinLength
+
+	// GetPasswordMaxLength returns the max_length value from the
+	// [password] section in the .toml config file
+	GetPasswordMaxLength = getPasswordMaxLength
+
+	// GetPasswordRequireUppercase returns the require_uppercase
+	// value from the [password] section in the .toml config file
+	GetPasswordRequireUppercase = getPasswordRequireUppercase
+
+	// GetPasswordRequireLowercase returns the require_lowercase
+	// value from the [password] section in the .toml config file
+	GetPasswordRequireLowercase = getPasswordRequireLowercase
+
+	// GetPasswordRequireDigit returns the require_digit value from
+	// the [password] section in the .toml config file
+	GetPasswordRequireDigit = getPasswordRequireDigit
+
+	// GetPasswordRequireSymbol returns the require_symbol value
+	// from the [password] section in the .toml config file
+	GetPasswordRequireSymbol = getPasswordRequireSymbol
+
+	// GetPasswordResetTokenLifetime returns the
+	// reset_token_lifetime value from the [password] section in the
+	// .toml config file
+	GetPasswordResetTokenLifetime = getPasswordResetTokenLifetime
+)
+
+func getPasswordMinLength() int {
+	return getConfigInt("password.min_length")
+}
+
+func getPasswordMaxLength() int {
+	return getConfigInt("password.max_length")
+}
+
+func getPasswordRequireUppercase() bool {
+	return getConfigBool("password.require_uppercase")
+}
+
+func getPasswordRequireLowercase() bool {
+	return getConfigBool("password.require_lowercase")
+}
+
+func getPasswordRequireDigit() bool {
+	return getConfigBool("password.require_digit")
+}
+
+func getPasswordRequireSymbol() bool {
+	return getConfigBool("password.require_symbol")
+}
+
+func getPasswordResetTokenLifetime() time.Duration {
+	return getConfigDuration("password.reset_token_lifetime")
+}
@@ -0,0 +1,254 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/rjseymour66/library-go/data"
+	"github.com/rjseymour66/library-go/util"
+	"github.com/rjseymour66/library-go/values"
+)
+
+var (
+	GetAPIKeys   = getAPIKeys
+	CreateAPIKey = createAPIKey
+	RevokeAPIKey = revokeAPIKey
+)
+
+// apiKeyPrefix starts every API key, which tells them apart from
+// session tokens in the Authorization header
+const apiKeyPrefix = "lib_"
+
+// apiKeyDisplayLength is how much of a key is kept in clear to
+// identify it in listings
+const apiKeyDisplayLength = len(apiKeyPrefix) + 8
+
+// isAPIKey returns whether the token is an API key rather than a
+// session token.
+func isAPIKey(token string) bool {
+	return strings.HasPrefix(strings.TrimSpace(token), apiKeyPrefix)
+}
+
+// requireNotAPIKey fails when the request is authorized with an API
+// key. Keys cannot manage keys or sessions, so that a leaked key
+// cannot outlive its revocation or widen its scopes.
+func requireNotAPIKey(ctx context.Context) (err error) {
+	principal, ok := ctx.Value(values.ContextKeyPrincipal).(*values.Principal)
+	if ok && principal.APIKey {
+		cause := "Not allowed with an API key"
+		err = util.NewError(cause, util.ErrorCodePermissionDenied, util.ErrForbidden, err)
+		return
+	}
+
+	return
+}
+
+// getAPIKeys returns the API keys of the user with the token.
+func getAPIKeys(ctx context.Context, token string) (response interface{}, err error) {
+	err = requireNotAPIKey(ctx)
+	if err != nil {
+		return
+	}
+
+	userID, err := data.GetUserID(ctx, token)
+	if err != nil {
+		cause := "Failed to get userUID"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	response, err = data.GetUserAPIKeys(ctx, userID)
+	if err != nil {
+		cause := "Failed to get API keys"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	return
+}
+
+type createAPIKeyRequest struct {
+	Name      string `validate:"trim,required,max=100"`
+	Scopes    []string
+	ExpiresAt *time.Time
+}
+
+type createAPIKeyResponse struct {
+	APIKeyID  string
+	Key       string
+	Name      string
+	Prefix    string
+	Scopes    []string   `json:",omitempty"`
+	ExpiresAt *time.Time `json:",omitempty"`
+}
+
+// createAPIKey creates an API key for the user with the token. Without
+// scopes the key has every permission of the role of the user;
+// otherwise only the scopes, each of which the role must grant. The
+// key is only returned here, since only its hash is stored.
+func createAPIKey(ctx context.Context, token string, requestBody io.Reader) (response interface{}, err error) {
+	err = requireNotAPIKey(ctx)
+	if err != nil {
+		return
+	}
+
+	request := &createAPIKeyRequest{}
+	err = decodeRequest(requestBody, request)
+	if err != nil {
+		return
+	}
+
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		cause := "Expiry must be in the future"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	scopes, err := checkAPIKeyScopes(ctx, request.Scopes)
+	if err != nil {
+		return
+	}
+
+	userID, err := data.GetUserID(ctx, token)
+	if err != nil {
+		cause := "Failed to get userUID"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	key, keyHash, err := makeAPIKey()
+	if err != nil {
+		cause := "Failed to generate API key"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	prefix := key[:apiKeyDisplayLength]
+
+	var apiKeyID string
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+	err = dbRunner.Transact(ctx, nil, func() (err error) {
+		apiKeyID, err = data.CreateAPIKey(ctx, userID, request.Name, prefix, keyHash, scopes, request.ExpiresAt)
+		if err != nil {
+			cause := "Failed to create API key"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	response = &createAPIKeyResponse{
+		APIKeyID:  apiKeyID,
+		Key:       key,
+		Name:      request.Name,
+		Prefix:    prefix,
+		Scopes:    scopes,
+		ExpiresAt: request.ExpiresAt,
+	}
+	return
+}
+
+// checkAPIKeyScopes returns the scopes without duplicates, once it has
+// checked that each is a permission the caller has. Nil scopes stay
+// nil, for a key that is not scoped.
+func checkAPIKeyScopes(ctx context.Context, scopes []string) (response []string, err error) {
+	if scopes == nil {
+		return
+	}
+
+	if len(scopes) == 0 {
+		cause := "Scopes cannot be empty, leave them out for an unscoped key"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	response = make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if hasString(response, scope) {
+			continue
+		}
+
+		ok, err := hasPermission(ctx, scope)
+		if err != nil {
+			return nil, err
+		}
+
+		// Unknown permissions are granted by no role
+		if !ok {
+			cause := "Cannot scope an API key to " + scope
+			return nil, util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		}
+
+		response = append(response, scope)
+	}
+
+	return
+}
+
+// revokeAPIKey revokes an API key of the user with the token. The key
+// stops working at once.
+func revokeAPIKey(ctx context.Context, token, apiKeyID string) (err error) {
+	err = requireNotAPIKey(ctx)
+	if err != nil {
+		return
+	}
+
+	apiKeyID = strings.TrimSpace(apiKeyID)
+	if apiKeyID == "" {
+		cause := "Invalid value for apiKeyID parameter"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	userID, err := data.GetUserID(ctx, token)
+	if err != nil {
+		cause := "Failed to get userUID"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	rowsAffected, err := data.RevokeAPIKey(ctx, userID, apiKeyID)
+	if err != nil {
+		cause := "Failed to revoke API key"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if rowsAffected == 0 {
+		cause := "API key not found"
+		err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+		return
+	}
+
+	return
+}
+
+// makeAPIKey returns a random API key and the hash that is stored in
+// its place.
+func makeAPIKey() (key, keyHash string, err error) {
+	raw := make([]byte, 32)
+	_, err = rand.Read(raw)
+	if err != nil {
+		return
+	}
+
+	key = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(raw)
+	keyHash = hashAPIKey(key)
+	return
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(key)))
+	return hex.EncodeToString(sum[:])
+}
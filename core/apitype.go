@@ -0,0 +1,82 @@
+package core
+
+import (
+	"reflect"
+
+	"github.com/rjseymour66/library-go/data"
+)
+
+var (
+	// APIType returns a value of the type with the name that a core
+	// function decodes from a request body or returns as a response.
+	// If there is none, returns nil
+	APIType = apiType
+)
+
+// apiTypes are the types of the request bodies and responses of the
+// core functions, which the API documentation describes.
+var apiTypes = []interface{}{
+	loginRequest{},
+	loginResponse{},
+	registerRequest{},
+	registerResponse{},
+	refreshAccessTokenRequest{},
+	refreshAccessTokenResponse{},
+	requestPasswordResetRequest{},
+	resetPasswordRequest{},
+	changePasswordRequest{},
+	changePasswordResponse{},
+	startOIDCLoginResponse{},
+	finishOIDCLoginRequest{},
+	createAPIKeyRequest{},
+	createAPIKeyResponse{},
+	createBookRequest{},
+	updateBookRequest{},
+	updateBookResponse{},
+	getBookResponse{},
+	getAllResponse{},
+	borrowOrReturnRequest{},
+	renewRequest{},
+	renewResponse{},
+	placeHoldRequest{},
+	holdResponse{},
+	marcImportResponse{},
+	csvImportResponse{},
+	createItemRequest{},
+	updateItemRequest{},
+	updateItemResponse{},
+	checkoutRequest{},
+	checkinRequest{},
+	checkinResponse{},
+	getAccountResponse{},
+	paymentRequest{},
+	waiverRequest{},
+	creditResponse{},
+	getUsersResponse{},
+	changeUserStatusRequest{},
+	unlockLoginRequest{},
+	createUserRequest{},
+	updateUserRequest{},
+	updateUserResponse{},
+	changeUserRoleRequest{},
+	resetUserPasswordRequest{},
+	roleRequest{},
+	createRoleResponse{},
+	data.APIKeyEntity{},
+	data.BookEntity{},
+	data.ItemEntity{},
+	data.LoanEntity{},
+	data.UserEntity{},
+	data.RoleEntity{},
+	data.PermissionEntity{},
+}
+
+func apiType(name string) interface{} {
+	for _, value := range apiTypes {
+		if reflect.TypeOf(value).Name() == name {
+			return value
+		}
+	}
+
+	return nil
+}
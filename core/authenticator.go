@@ -0,0 +1,144 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/rjseymour66/library-go/config"
+	"github.com/rjseymour66/library-go/data"
+	"github.com/rjseymour66/library-go/util"
+	"github.com/rjseymour66/library-go/values"
+)
+
+var (
+	InitAuthenticators    = initAuthenticators
+	RegisterAuthenticator = registerAuthenticator
+)
+
+// ErrUnknownAuthenticator is returned for an authenticator in the
+// config that is not registered
+var ErrUnknownAuthenticator = errors.New("Unknown authenticator")
+
+// Authenticator checks the password of a login
+type Authenticator interface {
+	// Authenticate returns the userID of the user with the username
+	// and password, or empty string if it does not accept them. An
+	// error means the authenticator could not decide.
+	Authenticate(ctx context.Context, username, password string) (userID string, err error)
+}
+
+// AuthenticatorFactory returns an authenticator configured from the
+// config
+type AuthenticatorFactory func() (Authenticator, error)
+
+var authenticatorFactories = struct {
+	sync.RWMutex
+	byName map[string]AuthenticatorFactory
+}{
+	byName: map[string]AuthenticatorFactory{
+		values.AuthSourceDatabase: newDatabaseAuthenticator,
+		values.AuthSourceLDAP:     newLDAPAuthenticator,
+	},
+}
+
+// authenticators check logins in the configured order
+var authenticators = []Authenticator{&databaseAuthenticator{}}
+
+// registerAuthenticator makes an authenticator available under the
+// name, which is also the auth_source of the users it provisions.
+func registerAuthenticator(name string, factory AuthenticatorFactory) {
+	authenticatorFactories.Lock()
+	defer authenticatorFactories.Unlock()
+
+	authenticatorFactories.byName[name] = factory
+}
+
+// initAuthenticators creates the authenticators in the [auth] section.
+// Without any, logins are checked against the database.
+func initAuthenticators() (err error) {
+	names := config.GetAuthAuthenticators()
+	if len(names) == 0 {
+		return
+	}
+
+	configured := make([]Authenticator, 0, len(names))
+	for _, name := range names {
+		authenticatorFactories.RLock()
+		factory, ok := authenticatorFactories.byName[name]
+		authenticatorFactories.RUnlock()
+
+		if !ok {
+			return fmt.Errorf("%w: %q", ErrUnknownAuthenticator, name)
+		}
+
+		authenticator, err := factory()
+		if err != nil {
+			return fmt.Errorf("authenticator %q: %w", name, err)
+		}
+
+		configured = append(configured, authenticator)
+	}
+
+	authenticators = configured
+	return
+}
+
+// authenticate asks each authenticator in turn to accept the login.
+// An authenticator that fails is skipped, so that an unreachable
+// directory does not lock out database users; the error is only
+// returned if no other authenticator accepts the login.
+func authenticate(ctx context.Context, username, password string) (userID string, err error) {
+	for _, authenticator := range authenticators {
+		id, authErr := authenticator.Authenticate(ctx, username, password)
+		if authErr != nil {
+			log.Printf("Authenticator %T failed for %v: %v\n", authenticator, username, authErr)
+			err = authErr
+			continue
+		}
+
+		if id != "" {
+			return id, nil
+		}
+	}
+
+	return
+}
+
+// checkDatabasePassword fails if the password of the user is not kept
+// in the database, but checked by another authenticator.
+func checkDatabasePassword(ctx context.Context, userID string) (err error) {
+	user, err := data.GetUser(ctx, userID)
+	if err != nil {
+		cause := "Failed to get user"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if user == nil {
+		cause := "User not found"
+		err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+		return
+	}
+
+	if user.AuthSource != values.AuthSourceDatabase {
+		cause := fmt.Sprintf("The password of the user is managed by %v", user.AuthSource)
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	return
+}
+
+// databaseAuthenticator checks the password stored in library_user
+type databaseAuthenticator struct{}
+
+func newDatabaseAuthenticator() (Authenticator, error) {
+	return &databaseAuthenticator{}, nil
+}
+
+func (a *databaseAuthenticator) Authenticate(ctx context.Context, username, password string) (string, error) {
+	return data.LoginUser(ctx, username, password)
+}
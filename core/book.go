@@ -2,11 +2,13 @@ package core
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"io"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/rjseymour66/library-go/data"
 	"github.com/rjseymour66/library-go/util"
 	"github.com/rjseymour66/library-go/values"
 )
@@ -14,46 +16,41 @@ import (
 var (
 	CreateBook         = createBook
 	GetBook            = getBook
+	GetBookByISBN      = getBookByISBN
 	GetAllBooks        = getAllBooks
 	UpdateBook         = updateBook
 	DeleteBook         = deleteBook
 	BorrowOrReturnBook = borrowOrReturnBook
 )
 
-func createBook(ctx context.Context, requestBody io.Reader) (response interface{}, err error) {
-	type createBookRequest struct {
-		BookName    string
-		AuthorName  string
-		Publisher   string
-		Description string
-	}
+type createBookRequest struct {
+	BookName    string `validate:"trim,required,max=255"`
+	AuthorName  string `validate:"trim,required,max=255"`
+	Publisher   string `validate:"trim,required,max=255"`
+	Description string `validate:"trim,max=4000"`
+	ISBN        string `validate:"trim,isbn"`
+}
 
+func createBook(ctx context.Context, requestBody io.Reader) (response interface{}, err error) {
 	request := &createBookRequest{}
-	err = json.NewDecoder(requestBody).Decode(request)
+	err = decodeRequest(requestBody, request)
 	if err != nil {
-		cause := "Failed to decode JSON"
-		err = util.NewError(cause, util.ErrorCodeInvalidJSONBody, util.ErrBadRequest, err)
 		return
 	}
 
-	request.BookName = strings.TrimSpace(request.BookName)
-	if request.BookName == "" {
-		cause := "Trying to create book with empty name"
-		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
-		return
-	}
+	return addBook(ctx, request)
+}
 
-	request.AuthorName = strings.TrimSpace(request.AuthorName)
-	if request.AuthorName == "" {
-		cause := "Trying to create book with empty author name"
-		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+// addBook validates a new book and adds it to the catalog. It is
+// shared by the JSON and bulk import endpoints.
+func addBook(ctx context.Context, request *createBookRequest) (response *data.BookEntity, err error) {
+	isbn13, isbn10, err := validateBook(request)
+	if err != nil {
 		return
 	}
 
-	request.Publisher = strings.TrimSpace(request.Publisher)
-	if request.Publisher == "" {
-		cause := "Trying to create book with empty publisher"
-		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+	err = checkISBNUnused(ctx, isbn13, "")
+	if err != nil {
 		return
 	}
 
@@ -62,7 +59,14 @@ func createBook(ctx context.Context, requestBody io.Reader) (response interface{
 		request.BookName,
 		request.AuthorName,
 		request.Publisher,
-		util.NewNullableString(request.Description))
+		util.NewNullableString(request.Description),
+		util.NewNullableString(isbn13),
+		util.NewNullableString(isbn10))
+	if errors.Is(err, data.ErrDuplicateISBN) {
+		err = duplicateISBNError(ctx, isbn13, err)
+		return
+	}
+
 	if err != nil {
 		cause := "Failed to create book"
 		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
@@ -72,7 +76,24 @@ func createBook(ctx context.Context, requestBody io.Reader) (response interface{
 	return
 }
 
-func getBook(ctx context.Context, bookID string) (response interface{}, err error) {
+// validateBook checks the fields of a new book without reading the
+// database, so that imported books follow the rules of decoded ones.
+// It returns the normalized ISBNs.
+func validateBook(request *createBookRequest) (isbn13, isbn10 string, err error) {
+	err = validateRequest(request)
+	if err != nil {
+		return
+	}
+
+	return normalizeBookISBN(request.ISBN)
+}
+
+type getBookResponse struct {
+	*data.BookDetails
+	Items interface{}
+}
+
+func getBook(ctx context.Context, bookID string, userRole int) (response interface{}, err error) {
 	if bookID == "" {
 		cause := "Invalid value for bookID parameter"
 		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
@@ -93,11 +114,66 @@ func getBook(ctx context.Context, bookID string) (response interface{}, err erro
 		return
 	}
 
-	response = book
+	var items interface{}
+
+	if userRole == values.UserRoleMember {
+		items, err = data.GetItemsForMember(ctx, bookID)
+	} else {
+		items, err = data.GetItemsForLibrarian(ctx, bookID)
+	}
+
+	if err != nil {
+		cause := "Failed to get items"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	response = &getBookResponse{
+		BookDetails: book,
+		Items:       items,
+	}
 	return
 }
 
-func getAllBooks(ctx context.Context, searchTerm string, rowOffset, rowLimit, userRole int) (response interface{}, err error) {
+func getBookByISBN(ctx context.Context, isbn string, userRole int) (response interface{}, err error) {
+	isbn13, ok := util.NormalizeISBN(isbn)
+	if !ok {
+		cause := "Invalid value for ISBN parameter"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	bookID, err := data.GetBookIDByISBN(ctx, isbn13)
+	if err != nil {
+		cause := "Failed to get book by ISBN"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if bookID == "" {
+		cause := "Book not found"
+		err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+		return
+	}
+
+	return getBook(ctx, bookID, userRole)
+}
+
+// getAllResponse is the response of a book listing. Its links are sent
+// in the Link header.
+type getAllResponse struct {
+	Data  interface{} `json:"data"`
+	Meta  interface{} `json:"meta"`
+	links []util.PageLink
+}
+
+func (response *getAllResponse) PageLinks() []util.PageLink {
+	return response.links
+}
+
+func getAllBooks(ctx context.Context, params *ListParams, userRole int) (response interface{}, err error) {
+	rowOffset, rowLimit := params.RowOffset, params.RowLimit
+
 	if rowOffset < 0 {
 		cause := "Invalid value for row offset parameter"
 		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
@@ -114,12 +190,42 @@ func getAllBooks(ctx context.Context, searchTerm string, rowOffset, rowLimit, us
 		rowLimit = values.MaxRowLimit
 	}
 
+	// A cursor already marks where the page starts
+	if params.Cursor != "" && rowOffset != 0 {
+		cause := "The offset and cursor parameters cannot be used together"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	search, err := makeBookSearch(params, userRole)
+	if err != nil {
+		return
+	}
+
 	var books interface{}
+	var count int
+	var lastCursorKey string
 
 	if userRole == values.UserRoleMember {
-		books, err = data.GetAllBooksForMember(ctx, searchTerm, rowOffset, rowLimit)
+		var memberBooks []*data.BookInfoMember
+		memberBooks, err = data.GetAllBooksForMember(ctx, search, rowOffset, rowLimit)
+		books, count = memberBooks, len(memberBooks)
+		if count > 0 {
+			lastCursorKey = memberBooks[count-1].CursorKey
+		}
 	} else {
-		books, err = data.GetAllBooksForLibrarian(ctx, searchTerm, rowOffset, rowLimit)
+		var librarianBooks []*data.BookInfoLibrarian
+		librarianBooks, err = data.GetAllBooksForLibrarian(ctx, search, rowOffset, rowLimit)
+		books, count = librarianBooks, len(librarianBooks)
+		if count > 0 {
+			lastCursorKey = librarianBooks[count-1].CursorKey
+		}
+	}
+
+	if errors.Is(err, data.ErrInvalidCursor) {
+		cause := "Invalid value for cursor parameter"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
 	}
 
 	if err != nil {
@@ -128,73 +234,123 @@ func getAllBooks(ctx context.Context, searchTerm string, rowOffset, rowLimit, us
 		return
 	}
 
+	totalCount, err := data.CountBooks(ctx, search)
+	if err != nil {
+		cause := "Failed to count books"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	facets, err := getBookFacets(ctx, search, params.Facets, userRole)
+	if err != nil {
+		return
+	}
+
+	// A full page may be followed by more books
+	var nextCursor string
+	if count == rowLimit {
+		nextCursor = data.MakeBookCursor(lastCursorKey)
+	}
+
 	type metaData struct {
-		SearchTerm string `json: ", omitempty"`
-		RowOffset  int    `json: ", omitempty"`
+		SearchTerm string   `json:",omitempty"`
+		Fields     []string `json:",omitempty"`
+		Sort       []string `json:",omitempty"`
+		RowOffset  int      `json:",omitempty"`
 		RowLimit   int
+		TotalCount int64
+		NextCursor string                        `json:",omitempty"`
+		Facets     map[string][]*data.FacetValue `json:",omitempty"`
 	}
 
 	meta := &metaData{
-		SearchTerm: searchTerm,
+		SearchTerm: search.Term,
+		Fields:     params.Fields,
+		Sort:       params.Sort,
 		RowOffset:  rowOffset,
 		RowLimit:   rowLimit,
-	}
-
-	type getAllResponse struct {
-		Data interface{} `json: "data"`
-		Meta interface{} `json: "meta"`
+		TotalCount: totalCount,
+		NextCursor: nextCursor,
+		Facets:     facets,
 	}
 
 	response = &getAllResponse{
-		Data: books,
-		Meta: meta,
+		Data:  books,
+		Meta:  meta,
+		links: makePageLinks(params.Cursor != "", rowOffset, rowLimit, totalCount, nextCursor),
 	}
 
 	return
 }
 
-func updateBook(ctx context.Context, requestBody io.Reader) (response interface{}, err error) {
-	type updateBookRequest struct {
-		BookID      string
-		BookName    string
-		AuthorName  string
-		Publisher   string
-		Description string
+// makePageLinks returns the links to the first, previous and next
+// pages. A listing paged with a cursor keeps using cursors, which
+// only go forward.
+func makePageLinks(cursorPaging bool, rowOffset, rowLimit int, totalCount int64, nextCursor string) (links []util.PageLink) {
+	links = append(links, util.PageLink{
+		Rel:    "first",
+		Params: map[string]string{"offset": "", "cursor": ""},
+	})
+
+	if cursorPaging {
+		if nextCursor != "" {
+			links = append(links, util.PageLink{
+				Rel:    "next",
+				Params: map[string]string{"cursor": nextCursor},
+			})
+		}
+		return
 	}
 
-	request := &updateBookRequest{}
-	err = json.NewDecoder(requestBody).Decode(request)
-	if err != nil {
-		cause := "Failed to decode JSON"
-		err = util.NewError(cause, util.ErrorCodeInvalidJSONBody, util.ErrBadRequest, err)
-		return
+	if rowOffset > 0 {
+		previous := rowOffset - rowLimit
+		if previous < 0 {
+			previous = 0
+		}
+
+		links = append(links, util.PageLink{
+			Rel:    "prev",
+			Params: map[string]string{"offset": strconv.Itoa(previous)},
+		})
 	}
 
-	request.BookID = strings.TrimSpace(request.BookID)
-	if request.BookID == "" {
-		cause := "Invalid value for bookID parameter"
-		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
-		return
+	if int64(rowOffset+rowLimit) < totalCount {
+		links = append(links, util.PageLink{
+			Rel:    "next",
+			Params: map[string]string{"offset": strconv.Itoa(rowOffset + rowLimit)},
+		})
 	}
 
-	request.BookName = strings.TrimSpace(request.BookName)
-	if request.BookName == "" {
-		cause := "Invalid value for book name"
-		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+	return
+}
+
+type updateBookRequest struct {
+	BookID      string `validate:"trim,required,uuid"`
+	BookName    string `validate:"trim,required,max=255"`
+	AuthorName  string `validate:"trim,required,max=255"`
+	Publisher   string `validate:"trim,required,max=255"`
+	Description string `validate:"trim,max=4000"`
+	ISBN        string `validate:"trim,isbn"`
+}
+
+type updateBookResponse struct {
+	UpdatedAt time.Time
+}
+
+func updateBook(ctx context.Context, requestBody io.Reader) (response interface{}, err error) {
+	request := &updateBookRequest{}
+	err = decodeRequest(requestBody, request)
+	if err != nil {
 		return
 	}
 
-	request.AuthorName = strings.TrimSpace(request.AuthorName)
-	if request.AuthorName == "" {
-		cause := "Invalid value for author name"
-		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+	isbn13, isbn10, err := normalizeBookISBN(request.ISBN)
+	if err != nil {
 		return
 	}
 
-	request.Publisher = strings.TrimSpace(request.Publisher)
-	if request.Publisher == "" {
-		cause := "Invalid value for publisher"
-		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+	err = checkISBNUnused(ctx, isbn13, request.BookID)
+	if err != nil {
 		return
 	}
 
@@ -204,7 +360,14 @@ func updateBook(ctx context.Context, requestBody io.Reader) (response interface{
 		request.BookName,
 		request.AuthorName,
 		request.Publisher,
-		util.NewNullableString(request.Description))
+		util.NewNullableString(request.Description),
+		util.NewNullableString(isbn13),
+		util.NewNullableString(isbn10))
+
+	if errors.Is(err, data.ErrDuplicateISBN) {
+		err = duplicateISBNError(ctx, isbn13, err)
+		return
+	}
 
 	if err != nil {
 		cause := "Failed to update book"
@@ -218,10 +381,6 @@ func updateBook(ctx context.Context, requestBody io.Reader) (response interface{
 		return
 	}
 
-	type updateBookResponse struct {
-		UpdatedAt time.Time
-	}
-
 	response = &updateBookResponse{
 		UpdatedAt: updatedAt,
 	}
@@ -238,56 +397,120 @@ func deleteBook(ctx context.Context, bookID string) (err error) {
 		return
 	}
 
-	rowsAffected, err := data.DeleteBook(ctx, bookID)
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+	err = dbRunner.Transact(ctx, nil, func() (err error) {
+		unavailable, err := data.LockItemsOfBook(ctx, bookID)
+		if err != nil {
+			cause := "Failed to get items"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
 
-	if err != nil {
-		cause := "Failed to delete book"
-		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		if unavailable > 0 {
+			cause := "Book has items on loan or reserved and cannot be deleted"
+			err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+			return
+		}
+
+		hasLoans, err := data.HasLoanHistory(ctx, bookID, "")
+		if err != nil {
+			cause := "Failed to get loans"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		if hasLoans {
+			cause := "Book has been on loan and cannot be deleted"
+			err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+			return
+		}
+
+		rowsAffected, err := data.DeleteBook(ctx, bookID)
+		if err != nil {
+			cause := "Failed to delete book"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		if rowsAffected == 0 {
+			cause := "Book not found"
+			err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+			return
+		}
+
+		return
+	})
+
+	return
+}
+
+// normalizeBookISBN validates an optional ISBN-10 or ISBN-13 and
+// returns its ISBN-13 and, where one exists, ISBN-10 forms.
+func normalizeBookISBN(isbn string) (isbn13, isbn10 string, err error) {
+	isbn = strings.TrimSpace(isbn)
+	if isbn == "" {
 		return
 	}
 
-	if rowsAffected == 0 {
-		cause := "Book not found"
-		err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+	isbn13, ok := util.NormalizeISBN(isbn)
+	if !ok {
+		cause := "Invalid value for ISBN"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
 		return
 	}
+
+	isbn10 = util.ISBN13To10(isbn13)
 	return
 }
 
-func borrowOrReturnBook(ctx context.Context, token string, requestBody io.Reader) (err error) {
-
-	type borrowOrReturnRequest struct {
-		BookID string
+// checkISBNUnused fails with ErrorCodeDuplicateISBN if a book other
+// than bookID already has the ISBN. The error references the
+// existing book.
+func checkISBNUnused(ctx context.Context, isbn13, bookID string) (err error) {
+	if isbn13 == "" {
+		return
 	}
 
-	request := &borrowOrReturnRequest{}
-	err = json.NewDecoder(requestBody).Decode(request)
-
+	existingID, err := data.GetBookIDByISBN(ctx, isbn13)
 	if err != nil {
-		cause := "Failed to decode JSON"
-		err = util.NewError(cause, util.ErrorCodeInvalidJSONBody, util.ErrBadRequest, err)
+		cause := "Failed to get book by ISBN"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
 		return
 	}
 
-	request.BookID = strings.TrimSpace(request.BookID)
-
-	if request.BookID == "" {
-		cause := "Invalid value for bookID parameter"
-		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+	if existingID != "" && existingID != bookID {
+		cause := "A book with this ISBN already exists"
+		err = util.NewErrorWithReference(cause, util.ErrorCodeDuplicateISBN, existingID, util.ErrConflict, err)
 		return
 	}
 
-	status, err := data.GetBookStatus(ctx, request.BookID)
+	return
+}
 
-	if err != nil {
-		cause := "Failed to get book status"
-		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
-		return
+// duplicateISBNError is the conflict for an ISBN that another book
+// took after checkISBNUnused. The existing book is only referenced if
+// it can still be read, which it cannot in a transaction the failed
+// write aborted.
+func duplicateISBNError(ctx context.Context, isbn13 string, err error) error {
+	cause := "A book with this ISBN already exists"
+
+	existingID, errGet := data.GetBookIDByISBN(ctx, isbn13)
+	if errGet != nil || existingID == "" {
+		return util.NewError(cause, util.ErrorCodeDuplicateISBN, util.ErrConflict, err)
 	}
 
-	if status == values.BookStatusUnkown {
-		cause := "Book not found"
-		err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+	return util.NewErrorWithReference(cause, util.ErrorCodeDuplicateISBN, existingID, util.ErrConflict, err)
+}
+
+type borrowOrReturnRequest struct {
+	ItemID string `validate:"trim,required,uuid"`
+}
+
+func borrowOrReturnBook(ctx context.Context, token string, requestBody io.Reader) (err error) {
+
+	request := &borrowOrReturnRequest{}
+	err = decodeRequest(requestBody, request)
+	if err != nil {
 		return
 	}
 
@@ -299,38 +522,50 @@ func borrowOrReturnBook(ctx context.Context, token string, requestBody io.Reader
 		return
 	}
 
-	// If the book is borrowed by one who did not take the error
-	newStatus := values.BookStatusAvailable
-
-	if status == values.BookStatusAvailable {
-		newStatus = values.BookStatusBorrowed
-	} else {
-		borrowerID := ""
-		borrowerID, err = data.GetBorrowerId(ctx, request.BookID)
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+	err = dbRunner.Transact(ctx, nil, func() (err error) {
+		item, err := data.GetItemForUpdate(ctx, request.ItemID)
 
 		if err != nil {
-			cause := "Failed to get borrowerID"
+			cause := "Failed to get item"
 			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
 			return
 		}
 
-		if borrowerID != userUID {
-			cause := "Book is not available"
+		if item == nil {
+			cause := "Item not found"
 			err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
 			return
 		}
 
-		userUID = ""
-		newStatus = values.BookStatusAvailable
-	}
+		if item.Status == values.BookStatusAvailable || item.Status == values.BookStatusOnHoldShelf {
+			err = claimItem(ctx, item, userUID)
+			if err != nil {
+				return
+			}
 
-	err = data.ChangeBookStatus(ctx, request.BookID, newStatus, util.NewNullableString(userID))
+			_, err = checkout(ctx, item.ItemID, userUID, userUID, false)
+			return
+		}
 
-	if err != nil {
-		cause := "Failed to change book status"
-		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		// The item can only be returned by the member who borrowed it
+		loan, err := data.GetActiveLoan(ctx, item.ItemID)
+
+		if err != nil {
+			cause := "Failed to get active loan"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		if loan == nil || loan.BorrowerID != userUID {
+			cause := "Item is not available, place a hold to join the queue"
+			err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+			return
+		}
+
+		_, err = checkin(ctx, loan, userUID)
 		return
-	}
+	})
 
 	return
 }
@@ -0,0 +1,45 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rjseymour66/library-go/data"
+	"github.com/rjseymour66/library-go/util"
+)
+
+// TestAddBookDuplicateISBN adds a book whose ISBN another book takes
+// between the check and the insert
+func TestAddBookDuplicateISBN(t *testing.T) {
+	getBookIDByISBN := data.GetBookIDByISBN
+	createBook := data.CreateBook
+	t.Cleanup(func() {
+		data.GetBookIDByISBN = getBookIDByISBN
+		data.CreateBook = createBook
+	})
+
+	existingID := ""
+	data.GetBookIDByISBN = func(ctx context.Context, isbn13 string) (string, error) {
+		return existingID, nil
+	}
+	data.CreateBook = func(ctx context.Context, bookName, authorName, publisher string, description, isbn13, isbn10 util.NullString) (*data.BookEntity, error) {
+		existingID = "book-1"
+		return nil, data.ErrDuplicateISBN
+	}
+
+	_, err := addBook(context.Background(), &createBookRequest{
+		BookName:   "The Art of Computer Programming",
+		AuthorName: "Donald Knuth",
+		Publisher:  "Addison-Wesley",
+		ISBN:       "0-306-40615-2",
+	})
+
+	isError, code, _, errorType := util.IsError(err)
+	if !isError || code != util.ErrorCodeDuplicateISBN || errorType != util.ErrConflict {
+		t.Fatalf("addBook: got %v, want ErrorCodeDuplicateISBN", err)
+	}
+
+	if reference := util.GetErrorReference(err); reference != "book-1" {
+		t.Errorf("addBook: got reference %q, want book-1", reference)
+	}
+}
@@ -0,0 +1,273 @@
+package core
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/rjseymour66/library-go/data"
+	"github.com/rjseymour66/library-go/util"
+	"github.com/rjseymour66/library-go/values"
+)
+
+var (
+	ImportCSV = importCSV
+	ExportCSV = exportCSV
+)
+
+// csvColumns maps normalized CSV header names onto the fields of a
+// new book. The export headers map back onto themselves.
+var csvColumns = map[string]func(request *createBookRequest, value string){
+	"bookname":        func(request *createBookRequest, value string) { request.BookName = value },
+	"title":           func(request *createBookRequest, value string) { request.BookName = value },
+	"authorname":      func(request *createBookRequest, value string) { request.AuthorName = value },
+	"author":          func(request *createBookRequest, value string) { request.AuthorName = value },
+	"publisher":       func(request *createBookRequest, value string) { request.Publisher = value },
+	"description":     func(request *createBookRequest, value string) { request.Description = value },
+	"bookdescription": func(request *createBookRequest, value string) { request.Description = value },
+	"isbn":            func(request *createBookRequest, value string) { request.ISBN = value },
+	"isbn13":          func(request *createBookRequest, value string) { request.ISBN = value },
+	"isbn10":          func(request *createBookRequest, value string) { request.ISBN = value },
+}
+
+// errCSVImportFailed rolls back an import where a row failed
+var errCSVImportFailed = errors.New("CSV import failed")
+
+type csvImportRow struct {
+	Row    int
+	BookID string              `json:",omitempty"`
+	Title  string              `json:",omitempty"`
+	Error  *util.ErrorResponse `json:",omitempty"`
+}
+
+type csvImportResponse struct {
+	DryRun         bool
+	Committed      bool
+	Total          int
+	Imported       int
+	Failed         int
+	IgnoredColumns []string `json:",omitempty"`
+	Rows           []*csvImportRow
+}
+
+type csvBook struct {
+	row     *csvImportRow
+	request *createBookRequest
+}
+
+// importCSV adds a book for every row of a CSV file whose first line
+// holds the column names. The rows are validated like createBook, and
+// the books are only added if every row is valid and every insert
+// succeeds, all in one transaction. A dry run validates the rows
+// without touching the database, so it cannot report ISBNs that are
+// already in the catalog.
+func importCSV(ctx context.Context, dryRun bool, requestBody io.Reader) (response interface{}, err error) {
+	reader := csv.NewReader(requestBody)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		cause := "Failed to read CSV header"
+		err = util.NewError(cause, util.ErrorCodeInvalidCSV, util.ErrBadRequest, err)
+		return
+	}
+
+	report := &csvImportResponse{DryRun: dryRun, Rows: make([]*csvImportRow, 0)}
+
+	setters, err := mapCSVHeader(header, report)
+	if err != nil {
+		return
+	}
+
+	books := make([]*csvBook, 0)
+	isbnRows := make(map[string]int)
+
+	for {
+		record, errRead := reader.Read()
+		if errRead == io.EOF {
+			break
+		}
+
+		if errRead != nil {
+			cause := "Failed to read CSV row"
+			err = util.NewError(cause, util.ErrorCodeInvalidCSV, util.ErrBadRequest, errRead)
+			return
+		}
+
+		line, _ := reader.FieldPos(0)
+		book := &csvBook{
+			row:     &csvImportRow{Row: line},
+			request: &createBookRequest{},
+		}
+
+		for i, value := range record {
+			if i < len(setters) && setters[i] != nil {
+				setters[i](book.request, value)
+			}
+		}
+
+		report.Total++
+		report.Rows = append(report.Rows, book.row)
+
+		isbn13, _, errValidate := validateBook(book.request)
+		book.row.Title = book.request.BookName
+		if errValidate != nil {
+			report.Failed++
+			book.row.Error = makeErrorResponse(errValidate)
+			continue
+		}
+
+		// The database is not read in a dry run, but the file can
+		// still repeat an ISBN
+		if firstRow, ok := isbnRows[isbn13]; ok && isbn13 != "" {
+			report.Failed++
+			book.row.Error = &util.ErrorResponse{
+				ErrorCode: util.ErrorCodeDuplicateISBN,
+				Cause:     "ISBN is repeated from row " + strconv.Itoa(firstRow),
+			}
+			continue
+		}
+		isbnRows[isbn13] = line
+
+		books = append(books, book)
+	}
+
+	response = report
+
+	if dryRun || report.Failed > 0 {
+		return
+	}
+
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+	err = dbRunner.Transact(ctx, nil, func() (err error) {
+		for _, book := range books {
+			created, errAdd := addBook(ctx, book.request)
+			if errAdd != nil {
+				report.Failed++
+				book.row.Error = makeErrorResponse(errAdd)
+				return errCSVImportFailed
+			}
+
+			book.row.BookID = created.BookID
+		}
+
+		return
+	})
+
+	if err == errCSVImportFailed {
+		// The report lists the row that rolled the import back
+		for _, book := range books {
+			book.row.BookID = ""
+		}
+		err = nil
+		return
+	}
+
+	if err != nil {
+		cause := "Failed to import books"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	report.Committed = true
+	report.Imported = len(books)
+	return
+}
+
+// exportCSV streams the librarian book listing for the search as CSV.
+func exportCSV(ctx context.Context, params *ListParams) (response interface{}, err error) {
+	search, err := makeBookSearch(params, values.UserRoleLibrarian)
+	if err != nil {
+		return
+	}
+
+	stream := &util.StreamResponse{
+		ContentType: "text/csv; charset=utf-8",
+		FileName:    "books.csv",
+	}
+
+	stream.WriteBody = func(writer io.Writer) (err error) {
+		csvWriter := csv.NewWriter(writer)
+
+		err = csvWriter.Write([]string{"BookID", "BookName", "AuthorName", "Publisher", "TotalCopies", "AvailableCopies"})
+		if err != nil {
+			return
+		}
+
+		err = data.ForEachBookForLibrarian(ctx, search, func(book *data.BookInfoLibrarian) error {
+			return csvWriter.Write([]string{
+				book.BookID,
+				book.BookName,
+				book.AuthorName,
+				book.Publisher,
+				strconv.FormatInt(book.TotalCopies, 10),
+				strconv.FormatInt(book.AvailableCopies, 10),
+			})
+		})
+		if err != nil {
+			return
+		}
+
+		csvWriter.Flush()
+		return csvWriter.Error()
+	}
+
+	response = stream
+	return
+}
+
+// mapCSVHeader returns the field setter for every column. Columns that
+// do not match a book field are listed in the report and skipped.
+func mapCSVHeader(header []string, report *csvImportResponse) (setters []func(*createBookRequest, string), err error) {
+	setters = make([]func(*createBookRequest, string), len(header))
+	mapped := make(map[string]bool)
+
+	for i, name := range header {
+		key := normalizeCSVColumn(name)
+		setter, ok := csvColumns[key]
+		if !ok {
+			report.IgnoredColumns = append(report.IgnoredColumns, name)
+			continue
+		}
+
+		setters[i] = setter
+		mapped[key] = true
+	}
+
+	required := [][]string{
+		{"bookname", "title"},
+		{"authorname", "author"},
+		{"publisher"},
+	}
+
+	for _, names := range required {
+		found := false
+		for _, name := range names {
+			found = found || mapped[name]
+		}
+
+		if !found {
+			cause := "CSV header has no column for " + names[0]
+			err = util.NewError(cause, util.ErrorCodeInvalidCSV, util.ErrBadRequest, err)
+			return
+		}
+	}
+
+	return
+}
+
+// normalizeCSVColumn lowercases a column name and drops spaces,
+// underscores and other separators, so "Book Name" and "book_name"
+// both match "bookname".
+func normalizeCSVColumn(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
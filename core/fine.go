@@ -0,0 +1,366 @@
+package core
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/rjseymour66/library-go/config"
+	"github.com/rjseymour66/library-go/data"
+	"github.com/rjseymour66/library-go/util"
+	"github.com/rjseymour66/library-go/values"
+)
+
+var (
+	AccrueFines   = accrueFines
+	GetAccount    = getAccount
+	RecordPayment = recordPayment
+	WaiveCharge   = waiveCharge
+)
+
+const day = 24 * time.Hour
+
+// accrueFines charges every overdue loan the part of its fine that
+// has not been charged yet.
+func accrueFines(ctx context.Context) (err error) {
+	now := time.Now()
+
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+	err = dbRunner.Transact(ctx, nil, func() (err error) {
+		loans, err := data.GetOverdueLoans(ctx, now.Add(-config.GetFineGracePeriod()))
+		if err != nil {
+			cause := "Failed to get overdue loans"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		for _, loan := range loans {
+			err = accrueFine(ctx, loan, now)
+			if err != nil {
+				return
+			}
+		}
+
+		return
+	})
+
+	return
+}
+
+type getAccountResponse struct {
+	UserID    string
+	Balance   int64
+	Entries   []*data.LedgerEntryEntity
+	RowOffset int
+	RowLimit  int
+}
+
+func getAccount(ctx context.Context, userID string, rowOffset, rowLimit int) (response interface{}, err error) {
+	userID = strings.TrimSpace(userID)
+	if userID == "" {
+		cause := "Invalid value for userID parameter"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	if rowOffset < 0 {
+		cause := "Invalid value for row offset parameter"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	if rowLimit < 0 || rowLimit > values.MaxRowLimit {
+		cause := "Invalid value for row limit parameter"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	if rowLimit == 0 {
+		rowLimit = values.MaxRowLimit
+	}
+
+	exists, err := data.UserExists(ctx, userID)
+	if err != nil {
+		cause := "Failed to get user"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if !exists {
+		cause := "User not found"
+		err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+		return
+	}
+
+	balance, err := data.GetUserBalance(ctx, userID)
+	if err != nil {
+		cause := "Failed to get balance"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	entries, err := data.GetLedgerEntries(ctx, userID, rowOffset, rowLimit)
+	if err != nil {
+		cause := "Failed to get ledger entries"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	response = &getAccountResponse{
+		UserID:    userID,
+		Balance:   balance,
+		Entries:   entries,
+		RowOffset: rowOffset,
+		RowLimit:  rowLimit,
+	}
+	return
+}
+
+type paymentRequest struct {
+	UserID string `validate:"trim,required,uuid"`
+	Amount int64  `validate:"min=1"`
+	Note   string `validate:"trim,max=1000"`
+}
+
+func recordPayment(ctx context.Context, token string, requestBody io.Reader) (response interface{}, err error) {
+	request := &paymentRequest{}
+	err = decodeRequest(requestBody, request)
+	if err != nil {
+		return
+	}
+
+	return addCredit(
+		ctx,
+		token,
+		request.UserID,
+		"",
+		values.LedgerEntryTypePayment,
+		request.Amount,
+		request.Note)
+}
+
+type waiverRequest struct {
+	UserID string `validate:"trim,required,uuid"`
+	LoanID string `validate:"trim,uuid"`
+	Amount int64  `validate:"min=1"`
+	Note   string `validate:"trim,required,max=1000"`
+}
+
+func waiveCharge(ctx context.Context, token string, requestBody io.Reader) (response interface{}, err error) {
+	request := &waiverRequest{}
+	err = decodeRequest(requestBody, request)
+	if err != nil {
+		return
+	}
+
+	return addCredit(
+		ctx,
+		token,
+		request.UserID,
+		request.LoanID,
+		values.LedgerEntryTypeWaiver,
+		request.Amount,
+		request.Note)
+}
+
+type creditResponse struct {
+	Entry   *data.LedgerEntryEntity
+	Balance int64
+}
+
+// addCredit records a payment or a waiver that reduces the user's
+// balance by amount.
+func addCredit(
+	ctx context.Context,
+	token,
+	userID,
+	loanID string,
+	entryType int,
+	amount int64,
+	note string) (response interface{}, err error) {
+	librarianID, err := data.GetUserID(ctx, token)
+	if err != nil {
+		cause := "Failed to get userUID"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+	err = dbRunner.Transact(ctx, nil, func() (err error) {
+		// Locking the user serializes credits, so that two of them
+		// cannot both pass the balance check
+		exists, err := data.LockUser(ctx, userID)
+		if err != nil {
+			cause := "Failed to get user"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		if !exists {
+			cause := "User not found"
+			err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+			return
+		}
+
+		if loanID != "" {
+			err = checkLoanBorrower(ctx, loanID, userID)
+			if err != nil {
+				return
+			}
+		}
+
+		balance, err := data.GetUserBalance(ctx, userID)
+		if err != nil {
+			cause := "Failed to get balance"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		if amount > balance {
+			cause := "Amount exceeds the outstanding balance"
+			err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+			return
+		}
+
+		entry, err := data.AddLedgerEntry(
+			ctx,
+			userID,
+			util.NewNullableString(loanID),
+			entryType,
+			-amount,
+			util.NewNullableString(note),
+			util.NewNullableString(librarianID))
+		if err != nil {
+			cause := "Failed to add ledger entry"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		response = &creditResponse{
+			Entry:   entry,
+			Balance: balance - amount,
+		}
+		return
+	})
+
+	return
+}
+
+// checkLoanBorrower refuses a loan that was not lent to the user, so
+// that a waiver cannot be recorded against someone else's loan.
+func checkLoanBorrower(ctx context.Context, loanID, userID string) (err error) {
+	loan, err := data.GetLoanForUpdate(ctx, loanID)
+	if err != nil {
+		cause := "Failed to get loan"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if loan == nil || loan.BorrowerID != userID {
+		cause := "Loan not found"
+		err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+		return
+	}
+
+	return
+}
+
+// accrueFine charges the user the difference between the fine the loan
+// has accrued by asOf and what was already charged for it since its
+// current due date. The caller is expected to run it inside a
+// transaction.
+func accrueFine(ctx context.Context, loan *data.LoanEntity, asOf time.Time) (err error) {
+	// The loan stays locked until the fine is added, so that the
+	// fine accrual job and a checkin or renewal cannot both read the
+	// same fine total
+	loan, err = data.GetLoanForUpdate(ctx, loan.LoanID)
+	if err != nil {
+		cause := "Failed to get loan"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if loan == nil {
+		return
+	}
+
+	fine := calculateFine(loan.DueAt, asOf, loan.EarlierFines)
+	if fine == 0 {
+		return
+	}
+
+	total, err := data.GetLoanFineTotal(ctx, loan.LoanID)
+	if err != nil {
+		cause := "Failed to get loan fine total"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	// What was charged against the earlier due dates of a renewed
+	// loan does not count towards the fine for its current one
+	charged := total - loan.EarlierFines
+	if fine <= charged {
+		return
+	}
+
+	_, err = data.AddLedgerEntry(
+		ctx,
+		loan.BorrowerID,
+		util.NewNullableString(loan.LoanID),
+		values.LedgerEntryTypeFine,
+		fine-charged,
+		util.NullString{},
+		util.NullString{})
+	if err != nil {
+		cause := "Failed to add fine"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	return
+}
+
+// calculateFine returns the fine for a loan due at dueAt as of asOf.
+// Nothing is owed within the grace period; after it every started day
+// past the due date is charged, up to what the per-item cap leaves
+// after the earlier fines of the loan.
+func calculateFine(dueAt, asOf time.Time, earlierFines int64) int64 {
+	overdue := asOf.Sub(dueAt)
+	if overdue <= config.GetFineGracePeriod() {
+		return 0
+	}
+
+	days := int64((overdue + day - 1) / day)
+	fine := days * int64(config.GetFineDailyCharge())
+
+	maxPerItem := int64(config.GetFineMaxPerItem())
+	if maxPerItem > 0 && earlierFines+fine > maxPerItem {
+		fine = maxPerItem - earlierFines
+	}
+
+	if fine < 0 {
+		return 0
+	}
+
+	return fine
+}
+
+// checkBalance refuses new loans to users whose outstanding fines are
+// above the configured threshold.
+func checkBalance(ctx context.Context, userID string) (err error) {
+	balance, err := data.GetUserBalance(ctx, userID)
+	if err != nil {
+		cause := "Failed to get balance"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if balance > int64(config.GetFineBlockThreshold()) {
+		cause := "Outstanding fines exceed the allowed balance"
+		err = util.NewError(cause, util.ErrorCodeOutstandingFines, util.ErrBadRequest, err)
+		return
+	}
+
+	return
+}
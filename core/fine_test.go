@@ -0,0 +1,51 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rjseymour66/library-go/data"
+	"github.com/rjseymour66/library-go/util"
+)
+
+func TestCheckLoanBorrower(t *testing.T) {
+	getLoanForUpdate := data.GetLoanForUpdate
+	t.Cleanup(func() {
+		data.GetLoanForUpdate = getLoanForUpdate
+	})
+
+	loans := map[string]*data.LoanEntity{
+		"loan-1": {LoanID: "loan-1", BorrowerID: "user-1"},
+	}
+	data.GetLoanForUpdate = func(ctx context.Context, loanID string) (*data.LoanEntity, error) {
+		return loans[loanID], nil
+	}
+
+	tests := []struct {
+		name   string
+		loanID string
+		userID string
+		want   error
+	}{
+		{name: "loan of the user", loanID: "loan-1", userID: "user-1"},
+		{name: "loan of another user", loanID: "loan-1", userID: "user-2", want: util.ErrResourceNotFound},
+		{name: "unknown loan", loanID: "loan-2", userID: "user-1", want: util.ErrResourceNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkLoanBorrower(context.Background(), test.loanID, test.userID)
+
+			if test.want == nil {
+				if err != nil {
+					t.Errorf("checkLoanBorrower: %v", err)
+				}
+				return
+			}
+
+			if _, _, _, errorType := util.IsError(err); errorType != test.want {
+				t.Errorf("checkLoanBorrower: got %v, want %v", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,340 @@
+package core
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/rjseymour66/library-go/config"
+	"github.com/rjseymour66/library-go/data"
+	"github.com/rjseymour66/library-go/util"
+	"github.com/rjseymour66/library-go/values"
+)
+
+var (
+	PlaceHold   = placeHold
+	GetHold     = getHold
+	CancelHold  = cancelHold
+	ExpireHolds = expireHolds
+)
+
+type holdResponse struct {
+	HoldID        string
+	BookID        string
+	ItemID        string `json:",omitempty"`
+	Status        int64
+	PlacedAt      time.Time
+	QueuePosition int64      `json:",omitempty"`
+	ExpiresAt     *time.Time `json:",omitempty"`
+}
+
+type placeHoldRequest struct {
+	BookID string `validate:"trim,required,uuid"`
+}
+
+func placeHold(ctx context.Context, token string, requestBody io.Reader) (response interface{}, err error) {
+	request := &placeHoldRequest{}
+	err = decodeRequest(requestBody, request)
+	if err != nil {
+		return
+	}
+
+	userUID, err := data.GetUserID(ctx, token)
+	if err != nil {
+		cause := "Failed to get userUID"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+	err = dbRunner.Transact(ctx, nil, func() (err error) {
+		items, err := data.GetItemsForMember(ctx, request.BookID)
+		if err != nil {
+			cause := "Failed to get items"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		if len(items) == 0 {
+			cause := "Book not found"
+			err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+			return
+		}
+
+		for _, item := range items {
+			if item.Status == values.BookStatusAvailable {
+				cause := "Book has copies available and can be borrowed"
+				err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+				return
+			}
+		}
+
+		hasLoan, err := data.HasActiveLoanForBook(ctx, request.BookID, userUID)
+		if err != nil {
+			cause := "Failed to get active loan"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		if hasLoan {
+			cause := "Book is already borrowed by the user"
+			err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+			return
+		}
+
+		hold, err := data.GetOpenHold(ctx, request.BookID, userUID)
+		if err != nil {
+			cause := "Failed to get hold"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		if hold != nil {
+			cause := "Hold is already placed on the book"
+			err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+			return
+		}
+
+		hold, err = data.PlaceHold(ctx, request.BookID, userUID)
+		if err != nil {
+			cause := "Failed to place hold"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		response, err = makeHoldResponse(ctx, hold)
+		return
+	})
+
+	return
+}
+
+func getHold(ctx context.Context, token, bookID string) (response interface{}, err error) {
+	bookID = strings.TrimSpace(bookID)
+	if bookID == "" {
+		cause := "Invalid value for bookID parameter"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	userUID, err := data.GetUserID(ctx, token)
+	if err != nil {
+		cause := "Failed to get userUID"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	hold, err := data.GetOpenHold(ctx, bookID, userUID)
+	if err != nil {
+		cause := "Failed to get hold"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if hold == nil {
+		cause := "Hold not found"
+		err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+		return
+	}
+
+	return makeHoldResponse(ctx, hold)
+}
+
+func cancelHold(ctx context.Context, token, bookID string) (err error) {
+	bookID = strings.TrimSpace(bookID)
+	if bookID == "" {
+		cause := "Invalid value for bookID parameter"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	userUID, err := data.GetUserID(ctx, token)
+	if err != nil {
+		cause := "Failed to get userUID"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+	err = dbRunner.Transact(ctx, nil, func() (err error) {
+		hold, err := data.GetOpenHold(ctx, bookID, userUID)
+		if err != nil {
+			cause := "Failed to get hold"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		if hold == nil {
+			cause := "Hold not found"
+			err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+			return
+		}
+
+		_, err = data.CloseHold(ctx, hold.HoldID, values.HoldStatusCancelled)
+		if err != nil {
+			cause := "Failed to cancel hold"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		// A copy waiting on the hold shelf passes to the next in line
+		if hold.Status == values.HoldStatusReady {
+			err = releaseItem(ctx, hold.ItemID)
+		}
+
+		return
+	})
+
+	return
+}
+
+// expireHolds closes the holds whose pickup window has passed and
+// passes their copies to the next member in line.
+func expireHolds(ctx context.Context) (err error) {
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+	err = dbRunner.Transact(ctx, nil, func() (err error) {
+		holds, err := data.GetExpiredHolds(ctx)
+		if err != nil {
+			cause := "Failed to get expired holds"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		for _, hold := range holds {
+			err = expireHold(ctx, hold)
+			if err != nil {
+				return
+			}
+		}
+
+		return
+	})
+
+	return
+}
+
+func makeHoldResponse(ctx context.Context, hold *data.HoldEntity) (response *holdResponse, err error) {
+	response = &holdResponse{
+		HoldID:    hold.HoldID,
+		BookID:    hold.BookID,
+		ItemID:    hold.ItemID,
+		Status:    hold.Status,
+		PlacedAt:  hold.PlacedAt,
+		ExpiresAt: hold.ExpiresAt,
+	}
+
+	if hold.Status != values.HoldStatusWaiting {
+		return
+	}
+
+	response.QueuePosition, err = data.GetHoldQueuePosition(ctx, hold.HoldID)
+	if err != nil {
+		cause := "Failed to get hold queue position"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	return
+}
+
+func expireHold(ctx context.Context, hold *data.HoldEntity) (err error) {
+	_, err = data.CloseHold(ctx, hold.HoldID, values.HoldStatusExpired)
+	if err != nil {
+		cause := "Failed to expire hold"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	return releaseItem(ctx, hold.ItemID)
+}
+
+// releaseItem reserves an item that is back in the library for the
+// first member in its book's hold queue, or puts it back on the
+// shelf if nobody is waiting. The caller is expected to run it
+// inside a transaction.
+func releaseItem(ctx context.Context, itemID string) (err error) {
+	// The item was deleted while it was reserved
+	if itemID == "" {
+		return
+	}
+
+	item, err := data.GetItem(ctx, itemID)
+	if err != nil {
+		cause := "Failed to get item"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if item == nil {
+		return
+	}
+
+	hold, err := data.GetNextHold(ctx, item.BookID)
+	if err != nil {
+		cause := "Failed to get next hold"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	status := values.BookStatusAvailable
+
+	if hold != nil {
+		expiresAt := time.Now().Add(config.GetHoldPickupWindow())
+		err = data.ReadyHold(ctx, hold.HoldID, itemID, expiresAt)
+		if err != nil {
+			cause := "Failed to reserve item for hold"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		status = values.BookStatusOnHoldShelf
+	}
+
+	err = data.ChangeItemStatus(ctx, itemID, status)
+	if err != nil {
+		cause := "Failed to change item status"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	return
+}
+
+// claimItem checks that the item can be lent to the borrower. An item
+// on the hold shelf can only be lent to the member it is reserved
+// for, which fulfills their hold. The caller is expected to run it
+// inside a transaction.
+func claimItem(ctx context.Context, item *data.ItemEntity, borrowerID string) (err error) {
+	if item.Status == values.BookStatusAvailable {
+		return
+	}
+
+	if item.Status != values.BookStatusOnHoldShelf {
+		cause := "Item is not available, place a hold to join the queue"
+		err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+		return
+	}
+
+	hold, err := data.GetReadyHold(ctx, item.ItemID)
+	if err != nil {
+		cause := "Failed to get hold"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if hold == nil || hold.UserID != borrowerID || hold.ExpiresAt.Before(time.Now()) {
+		cause := "Item is reserved for another member"
+		err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+		return
+	}
+
+	_, err = data.CloseHold(ctx, hold.HoldID, values.HoldStatusFulfilled)
+	if err != nil {
+		cause := "Failed to fulfill hold"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	return
+}
@@ -0,0 +1,263 @@
+package core
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/rjseymour66/library-go/data"
+	"github.com/rjseymour66/library-go/util"
+	"github.com/rjseymour66/library-go/values"
+)
+
+var (
+	CreateItem = createItem
+	GetItem    = getItem
+	UpdateItem = updateItem
+	DeleteItem = deleteItem
+)
+
+type createItemRequest struct {
+	BookID        string `validate:"trim,required,uuid"`
+	Barcode       string `validate:"trim,required,max=100"`
+	ShelfLocation string `validate:"trim,max=100"`
+	Condition     int
+}
+
+func createItem(ctx context.Context, requestBody io.Reader) (response interface{}, err error) {
+	request := &createItemRequest{}
+	err = decodeRequest(requestBody, request)
+	if err != nil {
+		return
+	}
+
+	if request.Condition == values.ItemConditionUnknown {
+		request.Condition = values.ItemConditionGood
+	}
+
+	err = validateItemCondition(request.Condition)
+	if err != nil {
+		return
+	}
+
+	book, err := data.GetBook(ctx, request.BookID)
+	if err != nil {
+		cause := "Failed to get book"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if book == nil {
+		cause := "Book not found"
+		err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+		return
+	}
+
+	err = checkBarcodeUnused(ctx, request.Barcode, "")
+	if err != nil {
+		return
+	}
+
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+	err = dbRunner.Transact(ctx, nil, func() (err error) {
+		response, err = shelveItem(ctx, request)
+		return
+	})
+
+	return
+}
+
+// shelveItem creates the item and hands it to the first member in its
+// book's hold queue, so that a new copy cannot be borrowed ahead of
+// the members waiting for the book. The caller is expected to run it
+// inside a transaction.
+func shelveItem(ctx context.Context, request *createItemRequest) (item *data.ItemEntity, err error) {
+	item, err = data.CreateItem(
+		ctx,
+		request.BookID,
+		request.Barcode,
+		util.NewNullableString(request.ShelfLocation),
+		request.Condition)
+	if err != nil {
+		cause := "Failed to create item"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	err = releaseItem(ctx, item.ItemID)
+	if err != nil {
+		return
+	}
+
+	// The item is on the hold shelf if somebody was waiting
+	item, err = data.GetItem(ctx, item.ItemID)
+	if err != nil {
+		cause := "Failed to get item"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	return
+}
+
+func getItem(ctx context.Context, itemID string) (response interface{}, err error) {
+	itemID = strings.TrimSpace(itemID)
+	if itemID == "" {
+		cause := "Invalid value for itemID parameter"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	item, err := data.GetItem(ctx, itemID)
+	if err != nil {
+		cause := "Failed to get item"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if item == nil {
+		cause := "Item not found"
+		err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+		return
+	}
+
+	response = item
+	return
+}
+
+type updateItemRequest struct {
+	ItemID        string `validate:"trim,required,uuid"`
+	Barcode       string `validate:"trim,required,max=100"`
+	ShelfLocation string `validate:"trim,max=100"`
+	Condition     int
+}
+
+type updateItemResponse struct {
+	UpdatedAt time.Time
+}
+
+func updateItem(ctx context.Context, requestBody io.Reader) (response interface{}, err error) {
+	request := &updateItemRequest{}
+	err = decodeRequest(requestBody, request)
+	if err != nil {
+		return
+	}
+
+	err = validateItemCondition(request.Condition)
+	if err != nil {
+		return
+	}
+
+	err = checkBarcodeUnused(ctx, request.Barcode, request.ItemID)
+	if err != nil {
+		return
+	}
+
+	updatedAt, err := data.UpdateItem(
+		ctx,
+		request.ItemID,
+		request.Barcode,
+		util.NewNullableString(request.ShelfLocation),
+		request.Condition)
+	if err != nil {
+		cause := "Failed to update item"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if updatedAt.IsZero() {
+		cause := "Item not found"
+		err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+		return
+	}
+
+	response = &updateItemResponse{
+		UpdatedAt: updatedAt,
+	}
+	return
+}
+
+func deleteItem(ctx context.Context, itemID string) (err error) {
+	itemID = strings.TrimSpace(itemID)
+	if itemID == "" {
+		cause := "Invalid value for itemID parameter"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+	err = dbRunner.Transact(ctx, nil, func() (err error) {
+		item, err := data.GetItemForUpdate(ctx, itemID)
+		if err != nil {
+			cause := "Failed to get item"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		if item == nil {
+			cause := "Item not found"
+			err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+			return
+		}
+
+		if item.Status != values.BookStatusAvailable {
+			cause := "Item is on loan or reserved and cannot be deleted"
+			err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+			return
+		}
+
+		hasLoans, err := data.HasLoanHistory(ctx, item.BookID, itemID)
+		if err != nil {
+			cause := "Failed to get loans"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		if hasLoans {
+			cause := "Item has been on loan and cannot be deleted"
+			err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+			return
+		}
+
+		_, err = data.DeleteItem(ctx, itemID)
+		if err != nil {
+			cause := "Failed to delete item"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		return
+	})
+
+	return
+}
+
+func validateItemCondition(condition int) (err error) {
+	if condition < values.ItemConditionNew || condition > values.ItemConditionDamaged {
+		cause := "Invalid value for item condition"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	return
+}
+
+// checkBarcodeUnused fails if another item than itemID already has
+// the barcode.
+func checkBarcodeUnused(ctx context.Context, barcode, itemID string) (err error) {
+	existingID, err := data.GetItemIDByBarcode(ctx, barcode)
+	if err != nil {
+		cause := "Failed to get item by barcode"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if existingID != "" && existingID != itemID {
+		cause := "Barcode is already used by another item"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	return
+}
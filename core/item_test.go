@@ -0,0 +1,75 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rjseymour66/library-go/data"
+	"github.com/rjseymour66/library-go/util"
+	"github.com/rjseymour66/library-go/values"
+)
+
+func TestShelveItem(t *testing.T) {
+	createItem := data.CreateItem
+	getItem := data.GetItem
+	getNextHold := data.GetNextHold
+	readyHold := data.ReadyHold
+	changeItemStatus := data.ChangeItemStatus
+	t.Cleanup(func() {
+		data.CreateItem = createItem
+		data.GetItem = getItem
+		data.GetNextHold = getNextHold
+		data.ReadyHold = readyHold
+		data.ChangeItemStatus = changeItemStatus
+	})
+
+	tests := []struct {
+		name   string
+		hold   *data.HoldEntity
+		status int64
+	}{
+		{name: "nobody waiting", status: values.BookStatusAvailable},
+		{name: "hold waiting", hold: &data.HoldEntity{HoldID: "hold-1", BookID: "book-1"}, status: values.BookStatusOnHoldShelf},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stored *data.ItemEntity
+			data.CreateItem = func(ctx context.Context, bookID, barcode string, shelfLocation util.NullString, condition int) (*data.ItemEntity, error) {
+				stored = &data.ItemEntity{ItemID: "item-1", BookID: bookID, Barcode: barcode, Status: values.BookStatusAvailable}
+				return stored, nil
+			}
+			data.GetItem = func(ctx context.Context, itemID string) (*data.ItemEntity, error) {
+				item := *stored
+				return &item, nil
+			}
+			data.ChangeItemStatus = func(ctx context.Context, itemID string, status int) error {
+				stored.Status = int64(status)
+				return nil
+			}
+			data.GetNextHold = func(ctx context.Context, bookID string) (*data.HoldEntity, error) {
+				return test.hold, nil
+			}
+
+			readied := ""
+			data.ReadyHold = func(ctx context.Context, holdID, itemID string, expiresAt time.Time) error {
+				readied = holdID + " " + itemID
+				return nil
+			}
+
+			item, err := shelveItem(context.Background(), &createItemRequest{BookID: "book-1", Barcode: "0001"})
+			if err != nil {
+				t.Fatalf("shelveItem: %v", err)
+			}
+
+			if item.Status != test.status {
+				t.Errorf("shelveItem: got status %v, want %v", item.Status, test.status)
+			}
+
+			if test.hold != nil && readied != "hold-1 item-1" {
+				t.Errorf("shelveItem: got readied hold %q, want hold-1 item-1", readied)
+			}
+		})
+	}
+}
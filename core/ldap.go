@@ -0,0 +1,190 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/rjseymour66/library-go/config"
+	"github.com/rjseymour66/library-go/data"
+	"github.com/rjseymour66/library-go/ldap"
+	"github.com/rjseymour66/library-go/util"
+	"github.com/rjseymour66/library-go/values"
+)
+
+// groupRole gives the members of a directory group a role
+type groupRole struct {
+	roleName string
+	groupDN  string
+}
+
+// ldapAuthenticator finds a user in the directory with the service
+// account, binds as the user to check the password, and provisions a
+// library_user with the role of the first mapped group of the user.
+type ldapAuthenticator struct {
+	// dial opens a connection to the directory. It is a field so that
+	// the authenticator can run against an in-process stand-in
+	dial func(ctx context.Context) (*ldap.Conn, error)
+
+	bindDN            string
+	bindPassword      string
+	baseDN            string
+	userObjectClass   string
+	usernameAttribute string
+	nameAttribute     string
+	emailAttribute    string
+	groupAttribute    string
+	groupRoles        []groupRole
+}
+
+func newLDAPAuthenticator() (Authenticator, error) {
+	url := config.GetLDAPURL()
+	timeout := config.GetLDAPTimeout()
+
+	authenticator := &ldapAuthenticator{
+		dial: func(ctx context.Context) (*ldap.Conn, error) {
+			return ldap.Dial(ctx, url, nil, timeout)
+		},
+		bindDN:            config.GetLDAPBindDN(),
+		bindPassword:      config.GetLDAPBindPassword(),
+		baseDN:            config.GetLDAPBaseDN(),
+		userObjectClass:   config.GetLDAPUserObjectClass(),
+		usernameAttribute: config.GetLDAPUsernameAttribute(),
+		nameAttribute:     config.GetLDAPNameAttribute(),
+		emailAttribute:    config.GetLDAPEmailAttribute(),
+		groupAttribute:    config.GetLDAPGroupAttribute(),
+	}
+
+	if url == "" || authenticator.baseDN == "" || authenticator.usernameAttribute == "" {
+		return nil, errors.New("url, base_dn and username_attribute are required")
+	}
+
+	for _, mapping := range config.GetLDAPGroupRoles() {
+		parts := strings.SplitN(mapping, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("group role %q is not \"role name=group DN\"", mapping)
+		}
+
+		authenticator.groupRoles = append(authenticator.groupRoles, groupRole{
+			roleName: strings.TrimSpace(parts[0]),
+			groupDN:  strings.TrimSpace(parts[1]),
+		})
+	}
+
+	return authenticator, nil
+}
+
+func (a *ldapAuthenticator) Authenticate(ctx context.Context, username, password string) (userID string, err error) {
+	conn, err := a.dial(ctx)
+	if err != nil {
+		return
+	}
+
+	defer conn.Close()
+
+	if a.bindDN != "" {
+		err = conn.Bind(a.bindDN, a.bindPassword)
+		if err != nil {
+			return "", fmt.Errorf("service bind: %w", err)
+		}
+	}
+
+	filter := ldap.Equal(a.usernameAttribute, username)
+	if a.userObjectClass != "" {
+		filter = ldap.And(ldap.Equal("objectClass", a.userObjectClass), filter)
+	}
+
+	entries, err := conn.Search(&ldap.SearchRequest{
+		BaseDN:     a.baseDN,
+		Scope:      ldap.ScopeWholeSubtree,
+		Filter:     filter,
+		Attributes: []string{a.usernameAttribute, a.nameAttribute, a.emailAttribute, a.groupAttribute},
+		SizeLimit:  2,
+	})
+	if err != nil {
+		return
+	}
+
+	// Users that are not in the directory are left to the other
+	// authenticators
+	if len(entries) == 0 {
+		return
+	}
+
+	if len(entries) > 1 {
+		return "", fmt.Errorf("%v matches %v directory entries", username, len(entries))
+	}
+
+	entry := entries[0]
+
+	err = conn.Bind(entry.DN, password)
+	if ldap.IsInvalidCredentials(err) {
+		return "", nil
+	}
+	if err != nil {
+		return
+	}
+
+	roleName := a.roleName(entry.Values(a.groupAttribute))
+	if roleName == "" {
+		log.Printf("Refusing login of %v, who is in no mapped directory group\n", entry.DN)
+		return
+	}
+
+	role, err := data.GetRoleCodeByName(ctx, roleName)
+	if err != nil {
+		return
+	}
+
+	if role == 0 {
+		return "", fmt.Errorf("role %q of group_roles does not exist", roleName)
+	}
+
+	// The directory spells the username the way it is stored
+	if name := entry.Value(a.usernameAttribute); name != "" {
+		username = name
+	}
+
+	fullName := entry.Value(a.nameAttribute)
+	if fullName == "" {
+		fullName = username
+	}
+
+	email, emailErr := normalizeEmail(entry.Value(a.emailAttribute))
+	if emailErr != nil {
+		email = ""
+	}
+
+	userID, err = data.ProvisionUser(
+		ctx,
+		username,
+		fullName,
+		util.NewNullableString(email),
+		int(role),
+		values.AuthSourceLDAP)
+	if err != nil {
+		return
+	}
+
+	if userID == "" {
+		log.Printf("Refusing directory login of %v, whose username belongs to another user\n", username)
+	}
+
+	return
+}
+
+// roleName returns the role of the first group in group_roles that is
+// one of the groups.
+func (a *ldapAuthenticator) roleName(groups []string) string {
+	for _, mapping := range a.groupRoles {
+		for _, group := range groups {
+			if strings.EqualFold(group, mapping.groupDN) {
+				return mapping.roleName
+			}
+		}
+	}
+
+	return ""
+}
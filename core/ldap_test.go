@@ -0,0 +1,168 @@
+package core
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rjseymour66/library-go/data"
+	"github.com/rjseymour66/library-go/ldap"
+	"github.com/rjseymour66/library-go/ldap/ldaptest"
+	"github.com/rjseymour66/library-go/util"
+	"github.com/rjseymour66/library-go/values"
+)
+
+const (
+	librariansGroup = "cn=librarians,ou=groups,dc=example,dc=org"
+	membersGroup    = "cn=members,ou=groups,dc=example,dc=org"
+)
+
+func newTestLDAPAuthenticator(t *testing.T) *ldapAuthenticator {
+	t.Helper()
+
+	person := func(uid, password string, groups ...string) *ldaptest.Entry {
+		return &ldaptest.Entry{
+			DN:       "uid=" + uid + ",ou=people,dc=example,dc=org",
+			Password: password,
+			Attributes: map[string][]string{
+				"objectClass": {"person"},
+				"uid":         {uid},
+				"cn":          {"Patron " + uid},
+				"mail":        {uid + "@example.org"},
+				"memberOf":    groups,
+			},
+		}
+	}
+
+	server, err := ldaptest.NewServer(
+		&ldaptest.Entry{DN: "cn=library,ou=services,dc=example,dc=org", Password: "service"},
+		person("ada", "secret", librariansGroup, membersGroup),
+		person("bob", "hunter2", membersGroup),
+		person("eve", "letmein", "cn=visitors,ou=groups,dc=example,dc=org"))
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	t.Cleanup(server.Close)
+
+	return &ldapAuthenticator{
+		dial: func(ctx context.Context) (*ldap.Conn, error) {
+			return ldap.Dial(ctx, server.URL, nil, 5*time.Second)
+		},
+		bindDN:            "cn=library,ou=services,dc=example,dc=org",
+		bindPassword:      "service",
+		baseDN:            "dc=example,dc=org",
+		userObjectClass:   "person",
+		usernameAttribute: "uid",
+		nameAttribute:     "cn",
+		emailAttribute:    "mail",
+		groupAttribute:    "memberOf",
+		groupRoles: []groupRole{
+			{roleName: "Librarian", groupDN: librariansGroup},
+			{roleName: "Member", groupDN: membersGroup},
+		},
+	}
+}
+
+// stubProvisioning replaces the data functions the authenticator calls
+// and returns the roles of the users it provisions.
+func stubProvisioning(t *testing.T) map[string]int {
+	t.Helper()
+
+	getRoleCodeByName := data.GetRoleCodeByName
+	provisionUser := data.ProvisionUser
+	t.Cleanup(func() {
+		data.GetRoleCodeByName = getRoleCodeByName
+		data.ProvisionUser = provisionUser
+	})
+
+	roles := map[string]int64{
+		"librarian": values.UserRoleLibrarian,
+		"member":    values.UserRoleMember,
+	}
+	data.GetRoleCodeByName = func(ctx context.Context, name string) (int64, error) {
+		return roles[strings.ToLower(name)], nil
+	}
+
+	provisioned := make(map[string]int)
+	data.ProvisionUser = func(ctx context.Context, username, fullName string, email util.NullString, role int, authSource string) (string, error) {
+		if authSource != values.AuthSourceLDAP {
+			t.Errorf("ProvisionUser: got auth source %q", authSource)
+		}
+		provisioned[username] = role
+		return "id-" + username, nil
+	}
+
+	return provisioned
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	authenticator := newTestLDAPAuthenticator(t)
+	provisioned := stubProvisioning(t)
+
+	tests := []struct {
+		name       string
+		username   string
+		password   string
+		wantUserID string
+		wantRole   int
+	}{
+		{name: "librarian group", username: "ada", password: "secret", wantUserID: "id-ada", wantRole: values.UserRoleLibrarian},
+		{name: "member group", username: "bob", password: "hunter2", wantUserID: "id-bob", wantRole: values.UserRoleMember},
+		{name: "wrong password", username: "bob", password: "wrong"},
+		{name: "empty password", username: "bob", password: ""},
+		{name: "no mapped group", username: "eve", password: "letmein"},
+		{name: "not in directory", username: "mallory", password: "secret"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			userID, err := authenticator.Authenticate(context.Background(), test.username, test.password)
+
+			// An empty password is refused before it reaches the server
+			if test.password == "" {
+				if err != ldap.ErrEmptyPassword {
+					t.Errorf("Authenticate: got %q, %v, want ErrEmptyPassword", userID, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+
+			if userID != test.wantUserID {
+				t.Errorf("Authenticate: got user %q, want %q", userID, test.wantUserID)
+			}
+
+			if role, ok := provisioned[test.username]; test.wantRole != 0 && (!ok || role != test.wantRole) {
+				t.Errorf("Provisioned role: got %v, want %v", role, test.wantRole)
+			}
+		})
+	}
+}
+
+func TestLDAPRoleName(t *testing.T) {
+	authenticator := &ldapAuthenticator{
+		groupRoles: []groupRole{
+			{roleName: "Librarian", groupDN: librariansGroup},
+			{roleName: "Member", groupDN: membersGroup},
+		},
+	}
+
+	tests := []struct {
+		groups []string
+		want   string
+	}{
+		{groups: []string{membersGroup, librariansGroup}, want: "Librarian"},
+		{groups: []string{strings.ToUpper(membersGroup)}, want: "Member"},
+		{groups: []string{"cn=visitors,ou=groups,dc=example,dc=org"}, want: ""},
+		{groups: nil, want: ""},
+	}
+
+	for _, test := range tests {
+		if got := authenticator.roleName(test.groups); got != test.want {
+			t.Errorf("roleName(%q): got %q, want %q", test.groups, got, test.want)
+		}
+	}
+}
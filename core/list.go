@@ -0,0 +1,149 @@
+package core
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rjseymour66/library-go/data"
+	"github.com/rjseymour66/library-go/util"
+	"github.com/rjseymour66/library-go/values"
+)
+
+// ListParams holds the query parameters of a listing
+type ListParams struct {
+	SearchTerm string
+	Fields     []string
+	RowOffset  int
+	RowLimit   int
+
+	// Facet filters, and the facets to count in the response
+	Author     string
+	Publisher  string
+	Status     int
+	BorrowerID string
+	Facets     []string
+
+	// Cursor continues a listing from the NextCursor of a page,
+	// instead of RowOffset
+	Cursor string
+
+	// Sort keys, each descending if it starts with "-", as in
+	// sort=author,-created_at
+	Sort []string
+}
+
+// searchFieldWeights maps the names accepted by the fields parameter
+// onto the search vector weights of the book columns
+var searchFieldWeights = map[string]string{
+	"title":       data.SearchWeightTitle,
+	"author":      data.SearchWeightAuthor,
+	"publisher":   data.SearchWeightPublisher,
+	"description": data.SearchWeightDescription,
+}
+
+// bookSortKeys are the sort keys accepted by the sort parameter
+var bookSortKeys = map[string]string{
+	"title":      data.SortKeyTitle,
+	"author":     data.SortKeyAuthor,
+	"publisher":  data.SortKeyPublisher,
+	"created_at": data.SortKeyCreatedAt,
+	"updated_at": data.SortKeyUpdatedAt,
+	"status":     data.SortKeyStatus,
+}
+
+// makeBookSearch validates the search parameters of a book listing.
+// Only librarians can filter by borrower.
+func makeBookSearch(params *ListParams, userRole int) (search *data.BookSearch, err error) {
+	search = &data.BookSearch{
+		Term:       strings.TrimSpace(params.SearchTerm),
+		Author:     strings.TrimSpace(params.Author),
+		Publisher:  strings.TrimSpace(params.Publisher),
+		Status:     params.Status,
+		BorrowerID: strings.TrimSpace(params.BorrowerID),
+		WithItems:  userRole == values.UserRoleMember,
+		Cursor:     strings.TrimSpace(params.Cursor),
+	}
+
+	for _, field := range params.Fields {
+		weight, ok := searchFieldWeights[strings.ToLower(strings.TrimSpace(field))]
+		if !ok {
+			cause := "Invalid value for fields parameter"
+			err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+			return
+		}
+
+		if !strings.Contains(search.Weights, weight) {
+			search.Weights += weight
+		}
+	}
+
+	for _, sort := range params.Sort {
+		sort = strings.ToLower(strings.TrimSpace(sort))
+
+		descending := strings.HasPrefix(sort, "-")
+		key, ok := bookSortKeys[strings.TrimPrefix(sort, "-")]
+		if !ok || hasBookSortKey(search.Sort, key) {
+			cause := "Invalid value for sort parameter"
+			err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+			return
+		}
+
+		search.Sort = append(search.Sort, data.BookSort{Key: key, Descending: descending})
+	}
+
+	if search.Status < values.BookStatusUnkown || search.Status > values.BookStatusOnHoldShelf {
+		cause := "Invalid value for status parameter"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	if search.BorrowerID != "" && userRole != values.UserRoleLibrarian {
+		cause := "Invalid value for borrower parameter"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	return
+}
+
+// getBookFacets counts the books of the search per value of each
+// requested facet. The borrower facet is only available to
+// librarians. If no facet is requested, returns nil
+func getBookFacets(ctx context.Context, search *data.BookSearch, facets []string, userRole int) (response map[string][]*data.FacetValue, err error) {
+	for _, facet := range facets {
+		facet = strings.ToLower(strings.TrimSpace(facet))
+
+		allowed := facet == data.FacetAuthor ||
+			facet == data.FacetPublisher ||
+			facet == data.FacetStatus ||
+			(facet == data.FacetBorrower && userRole == values.UserRoleLibrarian)
+
+		if !allowed {
+			cause := "Invalid value for facets parameter"
+			err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+			return
+		}
+
+		if response == nil {
+			response = make(map[string][]*data.FacetValue)
+		}
+
+		response[facet], err = data.GetBookFacets(ctx, search, facet)
+		if err != nil {
+			cause := "Failed to get facet counts"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+	}
+
+	return
+}
+
+func hasBookSortKey(sorts []data.BookSort, key string) bool {
+	for _, sort := range sorts {
+		if sort.Key == key {
+			return true
+		}
+	}
+	return false
+}
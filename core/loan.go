@@ -0,0 +1,348 @@
+package core
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/rjseymour66/library-go/config"
+	"github.com/rjseymour66/library-go/data"
+	"github.com/rjseymour66/library-go/util"
+	"github.com/rjseymour66/library-go/values"
+)
+
+var (
+	CheckoutBook  = checkoutBook
+	CheckinBook   = checkinBook
+	GetActiveLoan = getActiveLoan
+	RenewBook     = renewBook
+)
+
+type checkoutRequest struct {
+	ItemID     string `validate:"trim,required,uuid"`
+	BorrowerID string `validate:"trim,required,uuid"`
+
+	// Override lends the item even if the fines of the borrower
+	// exceed the limit
+	Override bool
+}
+
+func checkoutBook(ctx context.Context, token string, requestBody io.Reader) (response interface{}, err error) {
+	request := &checkoutRequest{}
+	err = decodeRequest(requestBody, request)
+	if err != nil {
+		return
+	}
+
+	if request.Override {
+		err = requirePermission(ctx, values.PermissionLoanOverride)
+		if err != nil {
+			return
+		}
+	}
+
+	librarianID, err := data.GetUserID(ctx, token)
+	if err != nil {
+		cause := "Failed to get userUID"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+	err = dbRunner.Transact(ctx, nil, func() (err error) {
+		item, err := data.GetItemForUpdate(ctx, request.ItemID)
+		if err != nil {
+			cause := "Failed to get item"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		if item == nil {
+			cause := "Item not found"
+			err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+			return
+		}
+
+		err = claimItem(ctx, item, request.BorrowerID)
+		if err != nil {
+			return
+		}
+
+		response, err = checkout(ctx, item.ItemID, request.BorrowerID, librarianID, request.Override)
+		return
+	})
+
+	return
+}
+
+type checkinRequest struct {
+	ItemID string `validate:"trim,required,uuid"`
+}
+
+type checkinResponse struct {
+	LoanID     string
+	ReturnedAt time.Time
+}
+
+func checkinBook(ctx context.Context, token string, requestBody io.Reader) (response interface{}, err error) {
+	request := &checkinRequest{}
+	err = decodeRequest(requestBody, request)
+	if err != nil {
+		return
+	}
+
+	librarianID, err := data.GetUserID(ctx, token)
+	if err != nil {
+		cause := "Failed to get userUID"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+	err = dbRunner.Transact(ctx, nil, func() (err error) {
+		// Locking the item serializes checkins of the same copy, so
+		// that it cannot be released twice
+		item, err := data.GetItemForUpdate(ctx, request.ItemID)
+		if err != nil {
+			cause := "Failed to get item"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		if item == nil {
+			cause := "Item not found"
+			err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+			return
+		}
+
+		loan, err := data.GetActiveLoan(ctx, item.ItemID)
+		if err != nil {
+			cause := "Failed to get active loan"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		if loan == nil {
+			cause := "Item is not on loan"
+			err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+			return
+		}
+
+		returnedAt, err := checkin(ctx, loan, librarianID)
+		if err != nil {
+			return
+		}
+
+		response = &checkinResponse{
+			LoanID:     loan.LoanID,
+			ReturnedAt: returnedAt,
+		}
+		return
+	})
+
+	return
+}
+
+func getActiveLoan(ctx context.Context, itemID string) (response interface{}, err error) {
+	itemID = strings.TrimSpace(itemID)
+	if itemID == "" {
+		cause := "Invalid value for itemID parameter"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	loan, err := data.GetActiveLoan(ctx, itemID)
+	if err != nil {
+		cause := "Failed to get active loan"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if loan == nil {
+		cause := "Loan not found"
+		err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+		return
+	}
+
+	response = loan
+	return
+}
+
+type renewRequest struct {
+	ItemID string `validate:"trim,required,uuid"`
+}
+
+type renewResponse struct {
+	LoanID       string
+	DueAt        time.Time
+	RenewalCount int64
+	RenewalsLeft int64
+}
+
+func renewBook(ctx context.Context, token string, requestBody io.Reader) (response interface{}, err error) {
+	request := &renewRequest{}
+	err = decodeRequest(requestBody, request)
+	if err != nil {
+		return
+	}
+
+	userUID, err := data.GetUserID(ctx, token)
+	if err != nil {
+		cause := "Failed to get userUID"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	maxRenewals := config.GetLoanMaxRenewals()
+
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+	err = dbRunner.Transact(ctx, nil, func() (err error) {
+		loan, err := data.GetActiveLoan(ctx, request.ItemID)
+		if err != nil {
+			cause := "Failed to get active loan"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		if loan == nil || loan.BorrowerID != userUID {
+			cause := "Loan not found"
+			err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+			return
+		}
+
+		response, err = renew(ctx, loan, maxRenewals, time.Now())
+		return
+	})
+
+	return
+}
+
+// renew moves the due date of the loan, unless a member is waiting
+// for the book or the loan has reached maxRenewals. The fine accrued
+// by now is charged first. The caller is expected to run it inside a
+// transaction.
+func renew(ctx context.Context, loan *data.LoanEntity, maxRenewals int, now time.Time) (response *renewResponse, err error) {
+	item, err := data.GetItem(ctx, loan.ItemID)
+	if err != nil {
+		cause := "Failed to get item"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	// Holds are placed on the book, so any member waiting for
+	// it blocks renewing the copy
+	holdCount, err := data.CountWaitingHolds(ctx, item.BookID)
+	if err != nil {
+		cause := "Failed to count holds"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if holdCount > 0 {
+		cause := "Book has a pending hold and cannot be renewed"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	if loan.RenewalCount >= int64(maxRenewals) {
+		cause := "Loan has reached the maximum number of renewals"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	// The fine is counted from the due date, so the overdue days
+	// are charged before it moves
+	err = accrueFine(ctx, loan, now)
+	if err != nil {
+		return
+	}
+
+	// An overdue loan is renewed from today, not from its old
+	// due date
+	dueAt := loan.DueAt
+	if dueAt.Before(now) {
+		dueAt = now
+	}
+	dueAt = dueAt.Add(config.GetLoanRenewalPeriod())
+
+	renewalCount, err := data.RenewLoan(ctx, loan.LoanID, dueAt, maxRenewals)
+	if err != nil {
+		cause := "Failed to renew loan"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if renewalCount == 0 {
+		cause := "Loan has reached the maximum number of renewals"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	response = &renewResponse{
+		LoanID:       loan.LoanID,
+		DueAt:        dueAt,
+		RenewalCount: renewalCount,
+		RenewalsLeft: int64(maxRenewals) - renewalCount,
+	}
+	return
+}
+
+// checkout lends the item to the borrower and marks it as borrowed.
+// Unless override is set, borrowers with too many fines are refused.
+// The caller is expected to run it inside a transaction after it
+// has checked that the item is available.
+func checkout(ctx context.Context, itemID, borrowerID, performedBy string, override bool) (loan *data.LoanEntity, err error) {
+	if !override {
+		err = checkBalance(ctx, borrowerID)
+		if err != nil {
+			return
+		}
+	}
+
+	dueAt := time.Now().Add(config.GetLoanPeriod())
+
+	loan, err = data.CheckoutItem(ctx, itemID, borrowerID, performedBy, dueAt)
+	if err != nil {
+		cause := "Failed to create loan"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	err = data.ChangeItemStatus(ctx, itemID, values.BookStatusBorrowed)
+	if err != nil {
+		cause := "Failed to change item status"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	return
+}
+
+// checkin closes the loan and hands the item to the next member in
+// its book's hold queue. A loan that was already returned is refused,
+// so that the item is only released once. The caller is expected to
+// run it inside a transaction with the item locked.
+func checkin(ctx context.Context, loan *data.LoanEntity, performedBy string) (returnedAt time.Time, err error) {
+	err = accrueFine(ctx, loan, time.Now())
+	if err != nil {
+		return
+	}
+
+	returnedAt, err = data.CheckinItem(ctx, loan.LoanID, performedBy)
+	if err != nil {
+		cause := "Failed to close loan"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if returnedAt.IsZero() {
+		cause := "Loan has already been returned"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrConflict, err)
+		return
+	}
+
+	err = releaseItem(ctx, loan.ItemID)
+
+	return
+}
@@ -0,0 +1,178 @@
+package core
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rjseymour66/library-go/config"
+	"github.com/rjseymour66/library-go/data"
+	"github.com/rjseymour66/library-go/util"
+	"github.com/rjseymour66/library-go/values"
+)
+
+// TestCheckinReleasesOnce checks in a loan that another checkin may
+// have returned first, which must not release the item again
+func TestCheckinReleasesOnce(t *testing.T) {
+	getLoanForUpdate := data.GetLoanForUpdate
+	checkinItem := data.CheckinItem
+	getItem := data.GetItem
+	getNextHold := data.GetNextHold
+	changeItemStatus := data.ChangeItemStatus
+	t.Cleanup(func() {
+		data.GetLoanForUpdate = getLoanForUpdate
+		data.CheckinItem = checkinItem
+		data.GetItem = getItem
+		data.GetNextHold = getNextHold
+		data.ChangeItemStatus = changeItemStatus
+	})
+
+	loan := &data.LoanEntity{LoanID: "loan-1", ItemID: "item-1", BorrowerID: "user-1", DueAt: time.Now().Add(day)}
+	data.GetLoanForUpdate = func(ctx context.Context, loanID string) (*data.LoanEntity, error) {
+		return loan, nil
+	}
+	data.GetItem = func(ctx context.Context, itemID string) (*data.ItemEntity, error) {
+		return &data.ItemEntity{ItemID: itemID, BookID: "book-1"}, nil
+	}
+	data.GetNextHold = func(ctx context.Context, bookID string) (*data.HoldEntity, error) {
+		return nil, nil
+	}
+
+	tests := []struct {
+		name       string
+		returnedAt time.Time
+		want       error
+		released   int
+	}{
+		{name: "active loan", returnedAt: time.Now(), released: 1},
+		{name: "loan already returned", want: util.ErrConflict},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data.CheckinItem = func(ctx context.Context, loanID, returnedBy string) (time.Time, error) {
+				return test.returnedAt, nil
+			}
+
+			released := 0
+			data.ChangeItemStatus = func(ctx context.Context, itemID string, status int) error {
+				if status == values.BookStatusAvailable {
+					released++
+				}
+				return nil
+			}
+
+			_, err := checkin(context.Background(), loan, "librarian-1")
+
+			if _, _, _, errorType := util.IsError(err); errorType != test.want {
+				t.Errorf("checkin: got %v, want %v", err, test.want)
+			}
+			if released != test.released {
+				t.Errorf("checkin: released the item %v times, want %v", released, test.released)
+			}
+		})
+	}
+}
+
+// TestRenewOverdueLoan renews a loan three days overdue, of which the
+// fine accrual job has charged two, and accrues its fine two days
+// after the new due date
+func TestRenewOverdueLoan(t *testing.T) {
+	getFineDailyCharge := config.GetFineDailyCharge
+	getFineGracePeriod := config.GetFineGracePeriod
+	getFineMaxPerItem := config.GetFineMaxPerItem
+	getLoanRenewalPeriod := config.GetLoanRenewalPeriod
+	getItem := data.GetItem
+	countWaitingHolds := data.CountWaitingHolds
+	getLoanForUpdate := data.GetLoanForUpdate
+	getLoanFineTotal := data.GetLoanFineTotal
+	addLedgerEntry := data.AddLedgerEntry
+	renewLoan := data.RenewLoan
+	t.Cleanup(func() {
+		config.GetFineDailyCharge = getFineDailyCharge
+		config.GetFineGracePeriod = getFineGracePeriod
+		config.GetFineMaxPerItem = getFineMaxPerItem
+		config.GetLoanRenewalPeriod = getLoanRenewalPeriod
+		data.GetItem = getItem
+		data.CountWaitingHolds = countWaitingHolds
+		data.GetLoanForUpdate = getLoanForUpdate
+		data.GetLoanFineTotal = getLoanFineTotal
+		data.AddLedgerEntry = addLedgerEntry
+		data.RenewLoan = renewLoan
+	})
+
+	config.GetFineDailyCharge = func() int { return 10 }
+	config.GetFineGracePeriod = func() time.Duration { return 0 }
+	config.GetLoanRenewalPeriod = func() time.Duration { return 14 * day }
+	data.GetItem = func(ctx context.Context, itemID string) (*data.ItemEntity, error) {
+		return &data.ItemEntity{ItemID: itemID, BookID: "book-1"}, nil
+	}
+	data.CountWaitingHolds = func(ctx context.Context, bookID string) (int64, error) {
+		return 0, nil
+	}
+
+	tests := []struct {
+		name       string
+		maxPerItem int
+		want       []int64
+	}{
+		{name: "no cap", want: []int64{20, 10, 20}},
+		{name: "cap across renewals", maxPerItem: 40, want: []int64{20, 10, 10}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config.GetFineMaxPerItem = func() int { return test.maxPerItem }
+
+			now := time.Now()
+			loan := &data.LoanEntity{LoanID: "loan-1", ItemID: "item-1", BorrowerID: "user-1", DueAt: now.Add(-3 * day)}
+
+			// The ledger starts with the fine the accrual job charged
+			// a day ago
+			fines := []int64{20}
+			fineTotal := func() (total int64) {
+				for _, fine := range fines {
+					total += fine
+				}
+				return
+			}
+
+			data.GetLoanForUpdate = func(ctx context.Context, loanID string) (*data.LoanEntity, error) {
+				locked := *loan
+				return &locked, nil
+			}
+			data.GetLoanFineTotal = func(ctx context.Context, loanID string) (int64, error) {
+				return fineTotal(), nil
+			}
+			data.AddLedgerEntry = func(ctx context.Context, userID string, loanID util.NullString, entryType int, amount int64, note, createdBy util.NullString) (*data.LedgerEntryEntity, error) {
+				fines = append(fines, amount)
+				return &data.LedgerEntryEntity{}, nil
+			}
+			data.RenewLoan = func(ctx context.Context, loanID string, dueAt time.Time, maxRenewals int) (int64, error) {
+				loan.DueAt = dueAt
+				loan.RenewalCount++
+				loan.EarlierFines = fineTotal()
+				return loan.RenewalCount, nil
+			}
+
+			response, err := renew(context.Background(), loan, 2, now)
+			if err != nil {
+				t.Fatalf("renew: %v", err)
+			}
+
+			if want := now.Add(14 * day); !response.DueAt.Equal(want) {
+				t.Errorf("renew: got due date %v, want %v", response.DueAt, want)
+			}
+
+			err = accrueFine(context.Background(), loan, now.Add(16*day))
+			if err != nil {
+				t.Fatalf("accrueFine: %v", err)
+			}
+
+			if !reflect.DeepEqual(fines, test.want) {
+				t.Errorf("fines: got %v, want %v", fines, test.want)
+			}
+		})
+	}
+}
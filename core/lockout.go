@@ -0,0 +1,233 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/rjseymour66/library-go/config"
+	"github.com/rjseymour66/library-go/data"
+	"github.com/rjseymour66/library-go/util"
+	"github.com/rjseymour66/library-go/values"
+)
+
+var (
+	UnlockLogin              = unlockLogin
+	DeleteStaleLoginFailures = deleteStaleLoginFailures
+)
+
+// loginSubject is a username or client IP address whose failed logins
+// are counted
+type loginSubject struct {
+	key       string
+	threshold int
+}
+
+func loginSubjects(username, clientIP string) (subjects []loginSubject) {
+	subjects = append(subjects, loginSubject{
+		key:       usernameSubject(username),
+		threshold: config.GetLockoutUsernameThreshold(),
+	})
+
+	if clientIP != "" {
+		subjects = append(subjects, loginSubject{
+			key:       ipSubject(clientIP),
+			threshold: config.GetLockoutIPThreshold(),
+		})
+	}
+
+	return
+}
+
+func usernameSubject(username string) string {
+	return "user:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+func ipSubject(clientIP string) string {
+	return "ip:" + strings.TrimSpace(clientIP)
+}
+
+// reserveLoginAttempt counts a login for the username and the client
+// IP address as failed before its password is checked, and blocks
+// further logins for each of them for the back-off it would earn.
+// Parallel guesses are then refused like sequential ones, instead of
+// all passing the check before any of them is counted. It fails while
+// either of them is backing off or locked out.
+func reserveLoginAttempt(ctx context.Context, username, clientIP string) (err error) {
+	now := time.Now()
+
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+	err = dbRunner.Transact(ctx, nil, func() (err error) {
+		for _, subject := range loginSubjects(username, clientIP) {
+			err = reserveLoginSubject(ctx, subject, now)
+			if err != nil {
+				return
+			}
+		}
+
+		return
+	})
+
+	return
+}
+
+// reserveLoginSubject counts a failed login for the subject and blocks
+// it for an exponential back-off, or for the lockout duration once it
+// reaches its threshold. A subject that is blocked is refused without
+// counting. The caller is expected to run it inside a transaction.
+func reserveLoginSubject(ctx context.Context, subject loginSubject, now time.Time) (err error) {
+	failures, err := data.ReserveLoginAttempt(ctx, subject.key, config.GetLockoutResetAfter())
+	if err != nil {
+		cause := "Failed to reserve login attempt"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if failures == 0 {
+		return loginBlocked(ctx, subject.key)
+	}
+
+	delay := loginBackoff(failures)
+	if subject.threshold > 0 && failures >= int64(subject.threshold) {
+		log.Printf("Locking out %v after %v failed logins\n", subject.key, failures)
+		if lockout := config.GetLockoutDuration(); lockout > delay {
+			delay = lockout
+		}
+	}
+
+	err = data.BlockLogin(ctx, subject.key, now.Add(delay))
+	if err != nil {
+		cause := "Failed to block login"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	return
+}
+
+// loginBlocked returns the error for a login refused while the subject
+// is blocked, with the time left until it may try again.
+func loginBlocked(ctx context.Context, key string) (err error) {
+	blockedUntil, err := data.GetLoginBlock(ctx, key)
+	if err != nil {
+		cause := "Failed to get login block"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	retryAfter := time.Until(blockedUntil).Round(time.Second)
+	if retryAfter < time.Second {
+		retryAfter = time.Second
+	}
+
+	cause := fmt.Sprintf("Too many failed logins, try again in %v", retryAfter)
+	err = util.NewError(cause, util.ErrorCodeLoginLocked, util.ErrTooManyRequests, err)
+	return
+}
+
+// loginBackoff returns the delay after the failures: backoff_base,
+// doubled for every failure after the first, up to backoff_max.
+func loginBackoff(failures int64) (delay time.Duration) {
+	delay = config.GetLockoutBackoffBase()
+	maxDelay := config.GetLockoutBackoffMax()
+
+	for i := int64(1); i < failures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+
+	return
+}
+
+// releaseLoginAttempt takes back the attempt reserved for a successful
+// login. The failures of the username are forgotten, while those of
+// the IP address are kept, so that one valid account does not reset
+// an attack on others.
+func releaseLoginAttempt(ctx context.Context, username, clientIP string) (err error) {
+	_, err = data.ClearLoginFailures(ctx, usernameSubject(username))
+	if err != nil {
+		cause := "Failed to clear login failures"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if clientIP == "" {
+		return
+	}
+
+	_, err = data.ReleaseLoginAttempt(ctx, ipSubject(clientIP))
+	if err != nil {
+		cause := "Failed to release login attempt"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	return
+}
+
+type unlockLoginRequest struct {
+	Username  string `validate:"trim,max=100"`
+	IPAddress string `validate:"trim,max=45"`
+}
+
+// unlockLogin lifts the back-off or lockout of a username, a client IP
+// address, or both.
+func unlockLogin(ctx context.Context, requestBody io.Reader) (err error) {
+	request := &unlockLoginRequest{}
+	err = decodeRequest(requestBody, request)
+	if err != nil {
+		return
+	}
+
+	if request.Username == "" && request.IPAddress == "" {
+		cause := "Username or IP address are empty"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	var keys []string
+	if request.Username != "" {
+		keys = append(keys, usernameSubject(request.Username))
+	}
+	if request.IPAddress != "" {
+		keys = append(keys, ipSubject(request.IPAddress))
+	}
+
+	var cleared int64
+	for _, key := range keys {
+		rowsAffected, err := data.ClearLoginFailures(ctx, key)
+		if err != nil {
+			cause := "Failed to clear login failures"
+			return util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		}
+
+		cleared += rowsAffected
+	}
+
+	if cleared == 0 {
+		cause := "No failed logins found"
+		err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+		return
+	}
+
+	return
+}
+
+// deleteStaleLoginFailures removes the failures that are no longer
+// counted and block nothing.
+func deleteStaleLoginFailures(ctx context.Context) (err error) {
+	_, err = data.DeleteStaleLoginFailures(ctx, time.Now().Add(-config.GetLockoutResetAfter()))
+	if err != nil {
+		cause := "Failed to delete stale login failures"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	return
+}
@@ -0,0 +1,99 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rjseymour66/library-go/config"
+	"github.com/rjseymour66/library-go/data"
+	"github.com/rjseymour66/library-go/util"
+)
+
+// TestReserveLoginSubject makes attempts for a subject in a row, as
+// parallel logins would, without any of them succeeding in between
+func TestReserveLoginSubject(t *testing.T) {
+	getLockoutBackoffBase := config.GetLockoutBackoffBase
+	getLockoutBackoffMax := config.GetLockoutBackoffMax
+	getLockoutDuration := config.GetLockoutDuration
+	getLockoutResetAfter := config.GetLockoutResetAfter
+	reserveLoginAttempt := data.ReserveLoginAttempt
+	blockLogin := data.BlockLogin
+	getLoginBlock := data.GetLoginBlock
+	t.Cleanup(func() {
+		config.GetLockoutBackoffBase = getLockoutBackoffBase
+		config.GetLockoutBackoffMax = getLockoutBackoffMax
+		config.GetLockoutDuration = getLockoutDuration
+		config.GetLockoutResetAfter = getLockoutResetAfter
+		data.ReserveLoginAttempt = reserveLoginAttempt
+		data.BlockLogin = blockLogin
+		data.GetLoginBlock = getLoginBlock
+	})
+
+	config.GetLockoutBackoffBase = func() time.Duration { return time.Second }
+	config.GetLockoutBackoffMax = func() time.Duration { return time.Minute }
+	config.GetLockoutDuration = func() time.Duration { return 15 * time.Minute }
+	config.GetLockoutResetAfter = func() time.Duration { return time.Hour }
+
+	now := time.Now()
+	subject := loginSubject{key: "user:ann", threshold: 3}
+
+	// The fake login_failure row refuses attempts while it is blocked
+	var failures int64
+	var blockedUntil time.Time
+	data.ReserveLoginAttempt = func(ctx context.Context, key string, resetAfter time.Duration) (int64, error) {
+		if blockedUntil.After(now) {
+			return 0, nil
+		}
+		failures++
+		return failures, nil
+	}
+	data.BlockLogin = func(ctx context.Context, key string, until time.Time) error {
+		blockedUntil = until
+		return nil
+	}
+	data.GetLoginBlock = func(ctx context.Context, keys ...string) (time.Time, error) {
+		return blockedUntil, nil
+	}
+
+	err := reserveLoginSubject(context.Background(), subject, now)
+	if err != nil {
+		t.Fatalf("reserveLoginSubject: %v", err)
+	}
+	if want := now.Add(time.Second); !blockedUntil.Equal(want) {
+		t.Errorf("reserveLoginSubject: got blocked until %v, want %v", blockedUntil, want)
+	}
+
+	err = reserveLoginSubject(context.Background(), subject, now)
+	if _, _, _, errorType := util.IsError(err); errorType != util.ErrTooManyRequests {
+		t.Errorf("reserveLoginSubject: got %v, want %v", err, util.ErrTooManyRequests)
+	}
+	if failures != 1 {
+		t.Errorf("reserveLoginSubject: counted %v failures, want 1", failures)
+	}
+
+	// Once the back-off has passed, attempts are counted again, and the
+	// third one locks the subject out
+	tests := []struct {
+		name string
+		want time.Duration
+	}{
+		{name: "second attempt", want: 2 * time.Second},
+		{name: "third attempt", want: 15 * time.Minute},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			blockedUntil = time.Time{}
+
+			err := reserveLoginSubject(context.Background(), subject, now)
+			if err != nil {
+				t.Fatalf("reserveLoginSubject: %v", err)
+			}
+
+			if want := now.Add(test.want); !blockedUntil.Equal(want) {
+				t.Errorf("reserveLoginSubject: got blocked until %v, want %v", blockedUntil, want)
+			}
+		})
+	}
+}
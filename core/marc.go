@@ -0,0 +1,234 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/rjseymour66/library-go/data"
+	"github.com/rjseymour66/library-go/marc"
+	"github.com/rjseymour66/library-go/util"
+	"github.com/rjseymour66/library-go/values"
+)
+
+var (
+	ImportMARC = importMARC
+	ExportMARC = exportMARC
+)
+
+type marcRecordReader interface {
+	Read() (*marc.Record, error)
+}
+
+type marcRecordWriter interface {
+	Write(record *marc.Record) error
+}
+
+type marcImportRecord struct {
+	Index  int
+	BookID string              `json:",omitempty"`
+	Title  string              `json:",omitempty"`
+	Error  *util.ErrorResponse `json:",omitempty"`
+}
+
+type marcImportResponse struct {
+	Total    int
+	Imported int
+	Failed   int
+	Records  []*marcImportRecord
+}
+
+// importMARC adds a book for every record in a MARC21 or MARCXML
+// file. Each record is imported on its own, so a bad record does not
+// stop the others, and the response reports the outcome per record.
+func importMARC(ctx context.Context, format string, requestBody io.Reader) (response interface{}, err error) {
+	var reader marcRecordReader
+
+	switch format {
+	case "", values.MARCFormatMARC21:
+		reader = marc.NewReader(requestBody)
+	case values.MARCFormatMARCXML:
+		reader = marc.NewXMLReader(requestBody)
+	default:
+		cause := "Invalid value for format parameter"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	report := &marcImportResponse{Records: make([]*marcImportRecord, 0)}
+
+	for {
+		record, errRead := reader.Read()
+		if errRead == io.EOF {
+			break
+		}
+
+		result := &marcImportRecord{Index: report.Total}
+		report.Total++
+		report.Records = append(report.Records, result)
+
+		if errRead != nil {
+			cause := "Failed to read MARC record"
+			report.Failed++
+			result.Error = &util.ErrorResponse{
+				ErrorCode: util.ErrorCodeInvalidMARCRecord,
+				Cause:     cause,
+			}
+			log.Printf("error: %v %v: %v", cause, result.Index, errRead)
+
+			// Only a malformed binary record can be skipped, any
+			// other error leaves the reader at an unknown position
+			if !errors.Is(errRead, marc.ErrMalformedRecord) {
+				break
+			}
+			continue
+		}
+
+		request := bookRequestFromMARC(record)
+		result.Title = request.BookName
+
+		book, errAdd := addBook(ctx, request)
+		if errAdd != nil {
+			report.Failed++
+			result.Error = makeErrorResponse(errAdd)
+			continue
+		}
+
+		report.Imported++
+		result.BookID = book.BookID
+	}
+
+	response = report
+	return
+}
+
+// exportMARC streams the books matching the search as a MARC21 or
+// MARCXML file.
+func exportMARC(ctx context.Context, format string, params *ListParams) (response interface{}, err error) {
+	search, err := makeBookSearch(params, values.UserRoleLibrarian)
+	if err != nil {
+		return
+	}
+
+	stream := &util.StreamResponse{}
+
+	switch format {
+	case "", values.MARCFormatMARC21:
+		stream.ContentType = "application/marc"
+		stream.FileName = "catalog.mrc"
+	case values.MARCFormatMARCXML:
+		stream.ContentType = "application/marcxml+xml"
+		stream.FileName = "catalog.xml"
+	default:
+		cause := "Invalid value for format parameter"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	stream.WriteBody = func(writer io.Writer) (err error) {
+		var recordWriter marcRecordWriter
+		if format == values.MARCFormatMARCXML {
+			xmlWriter := marc.NewXMLWriter(writer)
+			defer func() {
+				errClose := xmlWriter.Close()
+				if err == nil {
+					err = errClose
+				}
+			}()
+			recordWriter = xmlWriter
+		} else {
+			recordWriter = marc.NewWriter(writer)
+		}
+
+		return data.ForEachBook(ctx, search, func(book *data.BookDetails) (err error) {
+			err = recordWriter.Write(marcRecordFromBook(book))
+
+			// Skip a book that does not fit in a record rather than
+			// cut the file short
+			if errors.Is(err, marc.ErrRecordTooLong) {
+				log.Printf("Skipping book %v in MARC export: %v\n", book.BookID, err)
+				err = nil
+			}
+
+			return
+		})
+	}
+
+	response = stream
+	return
+}
+
+// bookRequestFromMARC maps the title (245), main entry (100),
+// publisher (260, or 264 in RDA records), ISBN (020) and summary
+// (520) fields onto a new book.
+func bookRequestFromMARC(record *marc.Record) (request *createBookRequest) {
+	request = &createBookRequest{}
+
+	request.BookName = marc.TrimPunctuation(record.SubfieldValue("245", "a"))
+	subtitle := marc.TrimPunctuation(record.SubfieldValue("245", "b"))
+	if subtitle != "" {
+		request.BookName += ": " + subtitle
+	}
+
+	request.AuthorName = marc.TrimPunctuation(record.SubfieldValue("100", "a"))
+
+	request.Publisher = marc.TrimPunctuation(record.SubfieldValue("260", "b"))
+	if request.Publisher == "" {
+		request.Publisher = marc.TrimPunctuation(record.SubfieldValue("264", "b"))
+	}
+
+	// 020$a often carries a qualifier, such as "9780261103344 (pbk.)"
+	isbn := strings.Fields(record.SubfieldValue("020", "a"))
+	if len(isbn) > 0 {
+		request.ISBN = isbn[0]
+	}
+
+	request.Description = strings.TrimSpace(record.SubfieldValue("520", "a"))
+
+	return
+}
+
+func marcRecordFromBook(book *data.BookDetails) (record *marc.Record) {
+	record = marc.NewRecord()
+
+	record.AddControlField("001", book.BookID)
+
+	if book.ISBN13 != "" {
+		record.AddDataField("020", " ", " ", "a", book.ISBN13)
+	}
+
+	if book.ISBN10 != "" {
+		record.AddDataField("020", " ", " ", "a", book.ISBN10)
+	}
+
+	record.AddDataField("100", "1", " ", "a", book.AuthorName)
+	record.AddDataField("245", "1", "0", "a", book.BookName)
+	record.AddDataField("260", " ", " ", "b", book.Publisher)
+
+	if book.Description != "" {
+		record.AddDataField("520", " ", " ", "a", book.Description)
+	}
+
+	return
+}
+
+// makeErrorResponse converts an error returned by a core function into
+// the payload sent to clients.
+func makeErrorResponse(err error) (response *util.ErrorResponse) {
+	isError, errorCode, cause, _ := util.IsError(err)
+	if !isError {
+		return &util.ErrorResponse{
+			ErrorCode: util.ErrorCodeInternal,
+			Cause:     "Internal error",
+		}
+	}
+
+	return &util.ErrorResponse{
+		ErrorCode: errorCode,
+		Cause:     cause,
+		Reference: util.GetErrorReference(err),
+		Fields:    util.GetErrorFields(err),
+	}
+}
@@ -0,0 +1,371 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rjseymour66/library-go/config"
+	"github.com/rjseymour66/library-go/data"
+	"github.com/rjseymour66/library-go/oidc"
+	"github.com/rjseymour66/library-go/util"
+	"github.com/rjseymour66/library-go/values"
+)
+
+var (
+	StartOIDCLogin          = startOIDCLogin
+	FinishOIDCLogin         = finishOIDCLogin
+	DeleteExpiredOIDCLogins = deleteExpiredOIDCLogins
+)
+
+// oidcProviderCache holds the provider once it has been discovered.
+// Discovery happens on the first sign-in, so that the server starts
+// while the provider is unreachable.
+var oidcProviderCache struct {
+	sync.Mutex
+	issuer   string
+	provider *oidc.Provider
+}
+
+// getOIDCProvider returns the provider of the configured issuer.
+func getOIDCProvider(ctx context.Context) (provider *oidc.Provider, err error) {
+	issuer := config.GetOIDCIssuer()
+	if issuer == "" {
+		cause := "OpenID Connect sign-in is not enabled"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	oidcProviderCache.Lock()
+	defer oidcProviderCache.Unlock()
+
+	if oidcProviderCache.provider != nil && oidcProviderCache.issuer == issuer {
+		return oidcProviderCache.provider, nil
+	}
+
+	client := &http.Client{Timeout: config.GetOIDCHTTPTimeout()}
+	provider, err = oidc.Discover(ctx, client, issuer)
+	if err != nil {
+		cause := "Failed to discover OpenID Connect provider"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	oidcProviderCache.issuer = issuer
+	oidcProviderCache.provider = provider
+	return
+}
+
+type startOIDCLoginResponse struct {
+	AuthorizationURL string
+	State            string
+	ExpiresAt        time.Time
+}
+
+// startOIDCLogin begins a sign-in with the provider. The client sends
+// the user to the authorization URL, and the provider sends them back
+// to the redirect URI with a code and the state for finishOIDCLogin.
+func startOIDCLogin(ctx context.Context) (response interface{}, err error) {
+	provider, err := getOIDCProvider(ctx)
+	if err != nil {
+		return
+	}
+
+	codeVerifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		cause := "Failed to generate code verifier"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	state, err := oidc.NewState()
+	if err != nil {
+		cause := "Failed to generate state"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	nonce, err := oidc.NewState()
+	if err != nil {
+		cause := "Failed to generate nonce"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	expiresAt := time.Now().Add(config.GetOIDCLoginTimeout())
+
+	err = data.CreateOIDCLogin(ctx, hashOIDCState(state), codeVerifier, nonce, expiresAt)
+	if err != nil {
+		cause := "Failed to create sign-in"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	response = &startOIDCLoginResponse{
+		AuthorizationURL: provider.AuthorizationURL(&oidc.AuthRequest{
+			ClientID:      config.GetOIDCClientID(),
+			RedirectURI:   config.GetOIDCRedirectURI(),
+			Scopes:        config.GetOIDCScopes(),
+			State:         state,
+			Nonce:         nonce,
+			CodeChallenge: oidc.CodeChallenge(codeVerifier),
+		}),
+		State:     state,
+		ExpiresAt: expiresAt,
+	}
+	return
+}
+
+type finishOIDCLoginRequest struct {
+	Code        string `validate:"trim,required"`
+	State       string `validate:"trim,required"`
+	AccessToken bool
+}
+
+// finishOIDCLogin redeems the code the provider returned with the
+// state, links the subject of the ID token to a user, and starts a
+// session in the same way login does.
+func finishOIDCLogin(ctx context.Context, requestBody io.Reader) (response interface{}, err error) {
+	request := &finishOIDCLoginRequest{}
+	err = decodeRequest(requestBody, request)
+	if err != nil {
+		return
+	}
+
+	idToken, role, err := redeemOIDCLogin(ctx, request.Code, request.State)
+	if err != nil {
+		return
+	}
+
+	var userID string
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+	err = dbRunner.Transact(ctx, nil, func() (err error) {
+		userID, err = linkOIDCUser(ctx, idToken, role)
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	return startSession(ctx, userID, request.AccessToken)
+}
+
+// redeemOIDCLogin uses up the sign-in of the state, redeems the code
+// and verifies the ID token. It returns the token and the role its
+// claims map to.
+func redeemOIDCLogin(ctx context.Context, code, state string) (idToken *oidc.IDToken, role int, err error) {
+	provider, err := getOIDCProvider(ctx)
+	if err != nil {
+		return
+	}
+
+	// The state can only be used once
+	login, err := data.UseOIDCLogin(ctx, hashOIDCState(state))
+	if err != nil {
+		cause := "Failed to get sign-in"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if login == nil {
+		cause := "Invalid or expired sign-in state"
+		err = util.NewError(cause, util.ErrorCodeInvalidCredentials, util.ErrNotAuthenticated, err)
+		return
+	}
+
+	clientID := config.GetOIDCClientID()
+
+	token, err := provider.Exchange(
+		ctx,
+		clientID,
+		config.GetOIDCClientSecret(),
+		config.GetOIDCRedirectURI(),
+		code,
+		login.CodeVerifier)
+	if err != nil {
+		cause := "Failed to redeem authorization code"
+		err = util.NewError(cause, util.ErrorCodeInvalidCredentials, util.ErrNotAuthenticated, err)
+		return
+	}
+
+	idToken, err = provider.VerifyIDToken(ctx, token.IDToken, clientID, login.Nonce, time.Now())
+	if err != nil {
+		cause := "Invalid ID token"
+		err = util.NewError(cause, util.ErrorCodeInvalidCredentials, util.ErrNotAuthenticated, err)
+		return
+	}
+
+	role, err = getOIDCRole(ctx, idToken)
+	return
+}
+
+// getOIDCRole returns the role of the first claim_roles entry whose
+// value is in the role claim, or the default role.
+func getOIDCRole(ctx context.Context, idToken *oidc.IDToken) (response int, err error) {
+	roleName := config.GetOIDCDefaultRole()
+
+	claimValues := idToken.StringsClaim(config.GetOIDCRoleClaim())
+
+	for _, mapping := range config.GetOIDCClaimRoles() {
+		parts := strings.SplitN(mapping, "=", 2)
+		if len(parts) != 2 {
+			log.Printf("Ignoring claim role %q, which is not \"role name=claim value\"\n", mapping)
+			continue
+		}
+
+		if hasString(claimValues, strings.TrimSpace(parts[1])) {
+			roleName = strings.TrimSpace(parts[0])
+			break
+		}
+	}
+
+	if roleName == "" {
+		cause := "The account has no library role"
+		err = util.NewError(cause, util.ErrorCodePermissionDenied, util.ErrForbidden, err)
+		return
+	}
+
+	code, err := data.GetRoleCodeByName(ctx, roleName)
+	if err != nil {
+		cause := "Failed to get role"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if code == 0 {
+		cause := "Role " + roleName + " of the OpenID Connect config does not exist"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	response = int(code)
+	return
+}
+
+// linkOIDCUser returns the user linked to the subject of the ID token.
+// On the first sign-in the subject is linked to the database user with
+// its verified email if link_verified_email is set, or to a new user.
+// Users created here take their role from the claims on every sign-in.
+func linkOIDCUser(ctx context.Context, idToken *oidc.IDToken, role int) (userID string, err error) {
+	userID, err = data.LoginIdentity(ctx, idToken.Issuer, idToken.Subject)
+	if err != nil {
+		cause := "Failed to get linked user"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if userID != "" {
+		user, err := data.GetUser(ctx, userID)
+		if err != nil {
+			cause := "Failed to get user"
+			return "", util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		}
+
+		if user != nil && user.AuthSource == values.AuthSourceOIDC && user.Role != int64(role) {
+			_, err = data.ChangeUserRole(ctx, userID, role)
+			if err != nil {
+				cause := "Failed to change user role"
+				return "", util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			}
+		}
+
+		return userID, nil
+	}
+
+	email, emailErr := normalizeEmail(idToken.StringClaim("email"))
+	if emailErr != nil {
+		email = ""
+	}
+
+	if email != "" && idToken.BoolClaim("email_verified") && config.GetOIDCLinkVerifiedEmail() {
+		userID, err = data.GetUserIDByEmail(ctx, email, values.AuthSourceDatabase)
+		if err != nil {
+			cause := "Failed to get user by email"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+	}
+
+	if userID == "" {
+		userID, err = createOIDCUser(ctx, idToken, email, role)
+		if err != nil {
+			return
+		}
+	}
+
+	err = data.CreateIdentity(ctx, idToken.Issuer, idToken.Subject, userID)
+	if err != nil {
+		cause := "Failed to link user"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	return
+}
+
+// createOIDCUser creates a user for the subject of the ID token. The
+// username comes from the username claim or the email; if another user
+// has it, a suffix derived from the subject tells them apart.
+func createOIDCUser(ctx context.Context, idToken *oidc.IDToken, email string, role int) (userID string, err error) {
+	username := strings.TrimSpace(idToken.StringClaim(config.GetOIDCUsernameClaim()))
+	if username == "" {
+		username = email
+	}
+	if username == "" {
+		username = "oidc-" + idToken.Subject
+	}
+
+	fullName := strings.TrimSpace(idToken.StringClaim("name"))
+	if fullName == "" {
+		fullName = username
+	}
+
+	suffix := hashOIDCState(idToken.Issuer + " " + idToken.Subject)[:8]
+
+	for _, candidate := range []string{username, username + "-" + suffix} {
+		userID, err = data.CreateExternalUser(
+			ctx,
+			candidate,
+			fullName,
+			util.NewNullableString(email),
+			role,
+			values.AuthSourceOIDC)
+		if err != nil {
+			cause := "Failed to create user"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		if userID != "" {
+			return
+		}
+	}
+
+	cause := "Username " + username + " is already taken"
+	err = util.NewError(cause, util.ErrorCodeDuplicateUsername, util.ErrConflict, err)
+	return
+}
+
+// deleteExpiredOIDCLogins removes the sign-ins that were started but
+// not finished in time.
+func deleteExpiredOIDCLogins(ctx context.Context) (err error) {
+	_, err = data.DeleteExpiredOIDCLogins(ctx)
+	if err != nil {
+		cause := "Failed to delete expired sign-ins"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	return
+}
+
+func hashOIDCState(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
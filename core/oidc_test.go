@@ -0,0 +1,278 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rjseymour66/library-go/config"
+	"github.com/rjseymour66/library-go/data"
+	"github.com/rjseymour66/library-go/oidc"
+	"github.com/rjseymour66/library-go/oidc/oidctest"
+	"github.com/rjseymour66/library-go/util"
+	"github.com/rjseymour66/library-go/values"
+)
+
+// stubOIDCConfig points the [oidc] settings at the mock provider. The
+// librarians value of the groups claim maps to the Librarian role,
+// everyone else is a Member.
+func stubOIDCConfig(t *testing.T, mock *oidctest.Provider, linkVerifiedEmail bool) {
+	t.Helper()
+
+	getIssuer := config.GetOIDCIssuer
+	getClientID := config.GetOIDCClientID
+	getClientSecret := config.GetOIDCClientSecret
+	getRedirectURI := config.GetOIDCRedirectURI
+	getScopes := config.GetOIDCScopes
+	getUsernameClaim := config.GetOIDCUsernameClaim
+	getRoleClaim := config.GetOIDCRoleClaim
+	getClaimRoles := config.GetOIDCClaimRoles
+	getDefaultRole := config.GetOIDCDefaultRole
+	getLinkVerifiedEmail := config.GetOIDCLinkVerifiedEmail
+	getLoginTimeout := config.GetOIDCLoginTimeout
+	getHTTPTimeout := config.GetOIDCHTTPTimeout
+
+	t.Cleanup(func() {
+		config.GetOIDCIssuer = getIssuer
+		config.GetOIDCClientID = getClientID
+		config.GetOIDCClientSecret = getClientSecret
+		config.GetOIDCRedirectURI = getRedirectURI
+		config.GetOIDCScopes = getScopes
+		config.GetOIDCUsernameClaim = getUsernameClaim
+		config.GetOIDCRoleClaim = getRoleClaim
+		config.GetOIDCClaimRoles = getClaimRoles
+		config.GetOIDCDefaultRole = getDefaultRole
+		config.GetOIDCLinkVerifiedEmail = getLinkVerifiedEmail
+		config.GetOIDCLoginTimeout = getLoginTimeout
+		config.GetOIDCHTTPTimeout = getHTTPTimeout
+
+		oidcProviderCache.Lock()
+		oidcProviderCache.issuer = ""
+		oidcProviderCache.provider = nil
+		oidcProviderCache.Unlock()
+	})
+
+	config.GetOIDCIssuer = func() string { return mock.Issuer }
+	config.GetOIDCClientID = func() string { return mock.ClientID }
+	config.GetOIDCClientSecret = func() string { return "" }
+	config.GetOIDCRedirectURI = func() string { return "https://library.example.org/oidc/callback" }
+	config.GetOIDCScopes = func() []string { return []string{"openid", "email", "profile"} }
+	config.GetOIDCUsernameClaim = func() string { return "preferred_username" }
+	config.GetOIDCRoleClaim = func() string { return "groups" }
+	config.GetOIDCClaimRoles = func() []string { return []string{"Librarian=librarians"} }
+	config.GetOIDCDefaultRole = func() string { return "Member" }
+	config.GetOIDCLinkVerifiedEmail = func() bool { return linkVerifiedEmail }
+	config.GetOIDCLoginTimeout = func() time.Duration { return 10 * time.Minute }
+	config.GetOIDCHTTPTimeout = func() time.Duration { return 5 * time.Second }
+}
+
+// oidcStore keeps the sign-ins, identities and users the data layer
+// would, so that the OpenID Connect flow runs without a database
+type oidcStore struct {
+	logins       map[string]*data.OIDCLoginEntity
+	identities   map[string]string
+	emails       map[string]string
+	createdUsers map[string]int
+}
+
+func stubOIDCData(t *testing.T) *oidcStore {
+	t.Helper()
+
+	store := &oidcStore{
+		logins:       make(map[string]*data.OIDCLoginEntity),
+		identities:   make(map[string]string),
+		emails:       make(map[string]string),
+		createdUsers: make(map[string]int),
+	}
+
+	createOIDCLogin := data.CreateOIDCLogin
+	useOIDCLogin := data.UseOIDCLogin
+	getRoleCodeByName := data.GetRoleCodeByName
+	loginIdentity := data.LoginIdentity
+	createIdentity := data.CreateIdentity
+	getUserIDByEmail := data.GetUserIDByEmail
+	createExternalUser := data.CreateExternalUser
+	getUser := data.GetUser
+
+	t.Cleanup(func() {
+		data.CreateOIDCLogin = createOIDCLogin
+		data.UseOIDCLogin = useOIDCLogin
+		data.GetRoleCodeByName = getRoleCodeByName
+		data.LoginIdentity = loginIdentity
+		data.CreateIdentity = createIdentity
+		data.GetUserIDByEmail = getUserIDByEmail
+		data.CreateExternalUser = createExternalUser
+		data.GetUser = getUser
+	})
+
+	data.CreateOIDCLogin = func(ctx context.Context, stateHash, codeVerifier, nonce string, expiresAt time.Time) error {
+		store.logins[stateHash] = &data.OIDCLoginEntity{CodeVerifier: codeVerifier, Nonce: nonce}
+		return nil
+	}
+	data.UseOIDCLogin = func(ctx context.Context, stateHash string) (*data.OIDCLoginEntity, error) {
+		login := store.logins[stateHash]
+		delete(store.logins, stateHash)
+		return login, nil
+	}
+	data.GetRoleCodeByName = func(ctx context.Context, name string) (int64, error) {
+		switch name {
+		case "Librarian":
+			return values.UserRoleLibrarian, nil
+		case "Member":
+			return values.UserRoleMember, nil
+		}
+		return 0, nil
+	}
+	data.LoginIdentity = func(ctx context.Context, issuer, subject string) (string, error) {
+		return store.identities[issuer+" "+subject], nil
+	}
+	data.CreateIdentity = func(ctx context.Context, issuer, subject, userID string) error {
+		store.identities[issuer+" "+subject] = userID
+		return nil
+	}
+	data.GetUserIDByEmail = func(ctx context.Context, email, authSource string) (string, error) {
+		return store.emails[email], nil
+	}
+	data.CreateExternalUser = func(ctx context.Context, username, fullName string, email util.NullString, role int, authSource string) (string, error) {
+		store.createdUsers[username] = role
+		return "new-" + username, nil
+	}
+	data.GetUser = func(ctx context.Context, userID string) (*data.UserEntity, error) {
+		return &data.UserEntity{UserID: userID, Role: values.UserRoleMember, AuthSource: values.AuthSourceDatabase}, nil
+	}
+
+	return store
+}
+
+func newMockOIDCProvider(t *testing.T) *oidctest.Provider {
+	t.Helper()
+
+	mock, err := oidctest.NewProvider("library")
+	if err != nil {
+		t.Fatalf("NewProvider: %v", err)
+	}
+	t.Cleanup(mock.Close)
+	return mock
+}
+
+func TestRedeemOIDCLogin(t *testing.T) {
+	mock := newMockOIDCProvider(t)
+	stubOIDCConfig(t, mock, false)
+	stubOIDCData(t)
+	ctx := context.Background()
+
+	response, err := startOIDCLogin(ctx)
+	if err != nil {
+		t.Fatalf("startOIDCLogin: %v", err)
+	}
+	started := response.(*startOIDCLoginResponse)
+
+	claims := mock.Claims("subject-1")
+	claims["groups"] = []string{"staff", "librarians"}
+
+	code, state, err := mock.Authorize(started.AuthorizationURL, claims)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	if state != started.State {
+		t.Fatalf("Authorize: got state %q, want %q", state, started.State)
+	}
+
+	idToken, role, err := redeemOIDCLogin(ctx, code, state)
+	if err != nil {
+		t.Fatalf("redeemOIDCLogin: %v", err)
+	}
+	if idToken.Subject != "subject-1" || role != values.UserRoleLibrarian {
+		t.Errorf("redeemOIDCLogin: got subject %q with role %v", idToken.Subject, role)
+	}
+
+	// A second callback with the same state is refused, even with a
+	// new code
+	code, _, err = mock.Authorize(started.AuthorizationURL, claims)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+
+	_, _, err = redeemOIDCLogin(ctx, code, state)
+	if _, _, _, errorType := util.IsError(err); errorType != util.ErrNotAuthenticated {
+		t.Errorf("redeemOIDCLogin with used state: got %v, want ErrNotAuthenticated", err)
+	}
+}
+
+func TestRedeemOIDCLoginWrongNonce(t *testing.T) {
+	mock := newMockOIDCProvider(t)
+	stubOIDCConfig(t, mock, false)
+	store := stubOIDCData(t)
+	ctx := context.Background()
+
+	response, err := startOIDCLogin(ctx)
+	if err != nil {
+		t.Fatalf("startOIDCLogin: %v", err)
+	}
+	started := response.(*startOIDCLoginResponse)
+
+	code, state, err := mock.Authorize(started.AuthorizationURL, mock.Claims("subject-1"))
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+
+	// The ID token carries the nonce of the request, which no longer
+	// matches the stored one
+	store.logins[hashOIDCState(state)].Nonce = "other"
+
+	_, _, err = redeemOIDCLogin(ctx, code, state)
+	if _, _, _, errorType := util.IsError(err); errorType != util.ErrNotAuthenticated {
+		t.Errorf("redeemOIDCLogin: got %v, want ErrNotAuthenticated", err)
+	}
+}
+
+func TestLinkOIDCUser(t *testing.T) {
+	tests := []struct {
+		name              string
+		emailVerified     bool
+		linkVerifiedEmail bool
+		wantUserID        string
+	}{
+		{name: "verified email", emailVerified: true, linkVerifiedEmail: true, wantUserID: "db-user"},
+		{name: "unverified email", emailVerified: false, linkVerifiedEmail: true, wantUserID: "new-ada"},
+		{name: "linking disabled", emailVerified: true, linkVerifiedEmail: false, wantUserID: "new-ada"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mock := newMockOIDCProvider(t)
+			stubOIDCConfig(t, mock, test.linkVerifiedEmail)
+			store := stubOIDCData(t)
+			store.emails["ada@example.org"] = "db-user"
+			ctx := context.Background()
+
+			idToken := &oidc.IDToken{
+				Issuer:  mock.Issuer,
+				Subject: "subject-1",
+				Claims: map[string]interface{}{
+					"preferred_username": "ada",
+					"email":              "ada@example.org",
+					"email_verified":     test.emailVerified,
+				},
+			}
+
+			userID, err := linkOIDCUser(ctx, idToken, values.UserRoleMember)
+			if err != nil {
+				t.Fatalf("linkOIDCUser: %v", err)
+			}
+			if userID != test.wantUserID {
+				t.Errorf("linkOIDCUser: got %q, want %q", userID, test.wantUserID)
+			}
+
+			if linked := store.identities[mock.Issuer+" subject-1"]; linked != test.wantUserID {
+				t.Errorf("identity linked to %q, want %q", linked, test.wantUserID)
+			}
+
+			// Later sign-ins find the linked user
+			again, err := linkOIDCUser(ctx, idToken, values.UserRoleMember)
+			if err != nil || again != userID {
+				t.Errorf("second linkOIDCUser: got %q, %v", again, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,314 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/rjseymour66/library-go/config"
+	"github.com/rjseymour66/library-go/data"
+	"github.com/rjseymour66/library-go/notify"
+	"github.com/rjseymour66/library-go/util"
+	"github.com/rjseymour66/library-go/values"
+)
+
+var (
+	InitNotifier         = initNotifier
+	ChangePassword       = changePassword
+	RequestPasswordReset = requestPasswordReset
+	ResetPassword        = resetPassword
+)
+
+// notifier delivers password reset tokens to users
+var notifier notify.Notifier
+
+// initNotifier creates the notifier configured in the [notifier]
+// section.
+func initNotifier() (err error) {
+	notifier, err = notify.New(config.GetNotifierType(), config.GetNotifierTarget())
+	return
+}
+
+// checkPasswordPolicy validates a new password against the configured
+// policy. login trims passwords, so a password that starts or ends
+// with whitespace could never be used.
+func checkPasswordPolicy(password string) (err error) {
+	var cause string
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+
+	minLength := config.GetPasswordMinLength()
+	maxLength := config.GetPasswordMaxLength()
+
+	switch {
+	case password != strings.TrimSpace(password):
+		cause = "Password cannot start or end with whitespace"
+	case len([]rune(password)) < minLength:
+		cause = fmt.Sprintf("Password must be at least %v characters long", minLength)
+	case maxLength > 0 && len(password) > maxLength:
+		cause = fmt.Sprintf("Password must be at most %v bytes long", maxLength)
+	case config.GetPasswordRequireUppercase() && !hasUpper:
+		cause = "Password must contain an uppercase letter"
+	case config.GetPasswordRequireLowercase() && !hasLower:
+		cause = "Password must contain a lowercase letter"
+	case config.GetPasswordRequireDigit() && !hasDigit:
+		cause = "Password must contain a digit"
+	case config.GetPasswordRequireSymbol() && !hasSymbol:
+		cause = "Password must contain a symbol"
+	default:
+		return
+	}
+
+	err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+	return
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `validate:"trim,required"`
+	NewPassword     string
+}
+
+type changePasswordResponse struct {
+	Token     string
+	ExpiresAt time.Time
+}
+
+// changePassword sets a new password for the user with the token once
+// it has confirmed the current one. Every session of the user ends,
+// and the response holds a new one.
+func changePassword(ctx context.Context, token string, requestBody io.Reader) (response interface{}, err error) {
+	err = requireNotAPIKey(ctx)
+	if err != nil {
+		return
+	}
+
+	request := &changePasswordRequest{}
+	err = decodeRequest(requestBody, request)
+	if err != nil {
+		return
+	}
+
+	err = checkPasswordPolicy(request.NewPassword)
+	if err != nil {
+		return
+	}
+
+	userID, err := data.GetUserID(ctx, token)
+	if err != nil {
+		cause := "Failed to get userUID"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	err = checkDatabasePassword(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	ok, err := data.CheckUserPassword(ctx, userID, request.CurrentPassword)
+	if err != nil {
+		cause := "Failed to check password"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if !ok {
+		cause := "Current password is wrong"
+		err = util.NewError(cause, util.ErrorCodeInvalidCredentials, util.ErrBadRequest, err)
+		return
+	}
+
+	var session *data.SessionEntity
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+	err = dbRunner.Transact(ctx, nil, func() (err error) {
+		_, err = data.ResetUserPassword(ctx, userID, request.NewPassword)
+		if err != nil {
+			cause := "Failed to change password"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		session, err = data.CreateSession(
+			ctx,
+			userID,
+			config.GetAuthSessionIdleTimeout(),
+			config.GetAuthSessionMaxLifetime())
+		if err != nil {
+			cause := "Failed to create session"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	response = &changePasswordResponse{
+		Token:     session.Token,
+		ExpiresAt: session.ExpiresAt,
+	}
+	return
+}
+
+type requestPasswordResetRequest struct {
+	Username string `validate:"trim,required,max=100"`
+}
+
+// requestPasswordReset sends a single-use reset token to an active
+// user. It succeeds whether or not the username exists, so that it
+// cannot be used to find out which users do.
+func requestPasswordReset(ctx context.Context, requestBody io.Reader) (err error) {
+	request := &requestPasswordResetRequest{}
+	err = decodeRequest(requestBody, request)
+	if err != nil {
+		return
+	}
+
+	userID, err := data.GetUserIDByUsername(ctx, request.Username)
+	if err != nil {
+		cause := "Failed to get user by username"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if userID == "" {
+		return
+	}
+
+	user, err := data.GetUser(ctx, userID)
+	if err != nil {
+		cause := "Failed to get user"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	// Users of other authenticators reset their password there
+	if user == nil || user.Status != values.UserStatusActive || user.AuthSource != values.AuthSourceDatabase {
+		return
+	}
+
+	token, tokenHash, err := makeResetToken()
+	if err != nil {
+		cause := "Failed to generate reset token"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	expiresAt := time.Now().Add(config.GetPasswordResetTokenLifetime())
+
+	err = data.CreatePasswordReset(ctx, userID, tokenHash, expiresAt)
+	if err != nil {
+		cause := "Failed to create password reset"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	message := &notify.Message{
+		To: notify.Recipient{
+			UserID:   user.UserID,
+			Username: user.Username,
+			FullName: user.FullName,
+			Email:    user.Email,
+		},
+		Subject: "Reset your library password",
+		Body: fmt.Sprintf("Use this token to set a new password. It can be used once, until %v.\n\n%v",
+			expiresAt.Format(time.RFC1123), token),
+	}
+
+	// A failed delivery is not reported to the caller, who could
+	// otherwise tell that the user exists
+	notifyErr := notifier.Notify(ctx, message)
+	if notifyErr != nil {
+		log.Printf("Failed to send password reset to %v: %v\n", user.Username, notifyErr)
+	}
+
+	return
+}
+
+type resetPasswordRequest struct {
+	Token       string `validate:"trim,required"`
+	NewPassword string
+}
+
+// resetPassword sets a new password with a reset token and ends every
+// session of the user.
+func resetPassword(ctx context.Context, requestBody io.Reader) (err error) {
+	request := &resetPasswordRequest{}
+	err = decodeRequest(requestBody, request)
+	if err != nil {
+		return
+	}
+
+	err = checkPasswordPolicy(request.NewPassword)
+	if err != nil {
+		return
+	}
+
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+	err = dbRunner.Transact(ctx, nil, func() (err error) {
+		userID, err := data.UsePasswordReset(ctx, hashResetToken(request.Token))
+		if err != nil {
+			cause := "Failed to use reset token"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		if userID == "" {
+			cause := "Invalid or expired reset token"
+			err = util.NewError(cause, util.ErrorCodeInvalidCredentials, util.ErrBadRequest, err)
+			return
+		}
+
+		_, err = data.ResetUserPassword(ctx, userID, request.NewPassword)
+		if err != nil {
+			cause := "Failed to reset password"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		return
+	})
+
+	return
+}
+
+// makeResetToken returns a random reset token and the hash that is
+// stored in its place.
+func makeResetToken() (token, tokenHash string, err error) {
+	raw := make([]byte, 32)
+	_, err = rand.Read(raw)
+	if err != nil {
+		return
+	}
+
+	token = base64.RawURLEncoding.EncodeToString(raw)
+	tokenHash = hashResetToken(token)
+	return
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
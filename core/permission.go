@@ -0,0 +1,106 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rjseymour66/library-go/config"
+	"github.com/rjseymour66/library-go/data"
+	"github.com/rjseymour66/library-go/util"
+	"github.com/rjseymour66/library-go/values"
+)
+
+var (
+	RequirePermission = requirePermission
+	HasPermission     = hasPermission
+)
+
+// permissionCache holds the permissions of every role, so that
+// checking a permission does not query the database on every request.
+// It is reloaded after the configured TTL and whenever a role changes.
+var permissionCache struct {
+	sync.RWMutex
+	roles    map[int]map[string]bool
+	loadedAt time.Time
+}
+
+// requirePermission fails unless the user the request is authorized
+// for has a role that grants the permission, and the API key of the
+// request, if any, is scoped to it.
+func requirePermission(ctx context.Context, permission string) (err error) {
+	ok, err := hasPermission(ctx, permission)
+	if err != nil {
+		return
+	}
+
+	if !ok {
+		cause := "Missing permission " + permission
+		err = util.NewError(cause, util.ErrorCodePermissionDenied, util.ErrForbidden, err)
+		return
+	}
+
+	return
+}
+
+// hasPermission returns whether the user the request is authorized for
+// has a role that grants the permission. A scoped API key only has the
+// permissions of the role that are in its scopes.
+func hasPermission(ctx context.Context, permission string) (response bool, err error) {
+	principal, ok := ctx.Value(values.ContextKeyPrincipal).(*values.Principal)
+	if !ok {
+		return
+	}
+
+	if principal.Scopes != nil && !hasString(principal.Scopes, permission) {
+		return
+	}
+
+	permissionCache.RLock()
+	roles := permissionCache.roles
+	stale := time.Since(permissionCache.loadedAt) > config.GetAuthPermissionCacheTTL()
+	permissionCache.RUnlock()
+
+	if roles == nil || stale {
+		roles, err = loadPermissionCache(ctx)
+		if err != nil {
+			return
+		}
+	}
+
+	response = roles[principal.Role][permission]
+	return
+}
+
+func loadPermissionCache(ctx context.Context) (roles map[int]map[string]bool, err error) {
+	permissions, err := data.GetRolePermissions(ctx)
+	if err != nil {
+		cause := "Failed to get role permissions"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	roles = make(map[int]map[string]bool)
+	for _, permission := range permissions {
+		role := int(permission.RoleCode)
+		if roles[role] == nil {
+			roles[role] = make(map[string]bool)
+		}
+		roles[role][permission.Permission] = true
+	}
+
+	permissionCache.Lock()
+	permissionCache.roles = roles
+	permissionCache.loadedAt = time.Now()
+	permissionCache.Unlock()
+
+	return
+}
+
+// invalidatePermissionCache makes the next permission check reload the
+// permissions of every role.
+func invalidatePermissionCache() {
+	permissionCache.Lock()
+	permissionCache.roles = nil
+	permissionCache.Unlock()
+}
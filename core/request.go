@@ -0,0 +1,57 @@
+package core
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/rjseymour66/library-go/util"
+	"github.com/rjseymour66/library-go/validate"
+)
+
+// decodeRequest decodes a JSON request body into request and checks
+// the rules in its validate tags. The error lists every invalid field.
+func decodeRequest(requestBody io.Reader, request interface{}) (err error) {
+	fields, err := validate.Decode(requestBody, request)
+	if errors.Is(err, validate.ErrInvalidTag) {
+		cause := "Failed to validate request"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if err != nil {
+		cause := "Failed to decode JSON"
+		err = util.NewError(cause, util.ErrorCodeInvalidJSONBody, util.ErrBadRequest, err)
+		return
+	}
+
+	return makeValidationError(fields)
+}
+
+// validateRequest checks the rules in the validate tags of a request
+// that was not decoded from JSON, such as an imported book.
+func validateRequest(request interface{}) (err error) {
+	fields, err := validate.Struct(request)
+	if err != nil {
+		cause := "Failed to validate request"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	return makeValidationError(fields)
+}
+
+func makeValidationError(fields []util.FieldError) (err error) {
+	if len(fields) == 0 {
+		return
+	}
+
+	messages := make([]string, 0, len(fields))
+	for _, field := range fields {
+		messages = append(messages, field.Message)
+	}
+
+	cause := strings.Join(messages, "; ")
+	err = util.NewValidationError(cause, fields)
+	return
+}
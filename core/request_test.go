@@ -0,0 +1,98 @@
+package core
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/rjseymour66/library-go/validate"
+)
+
+// requests holds every struct of the package with validate tags
+var requests = map[string]interface{}{
+	"borrowOrReturnRequest":       &borrowOrReturnRequest{},
+	"changePasswordRequest":       &changePasswordRequest{},
+	"changeUserRoleRequest":       &changeUserRoleRequest{},
+	"changeUserStatusRequest":     &changeUserStatusRequest{},
+	"checkinRequest":              &checkinRequest{},
+	"checkoutRequest":             &checkoutRequest{},
+	"createAPIKeyRequest":         &createAPIKeyRequest{},
+	"createBookRequest":           &createBookRequest{},
+	"createItemRequest":           &createItemRequest{},
+	"createUserRequest":           &createUserRequest{},
+	"finishOIDCLoginRequest":      &finishOIDCLoginRequest{},
+	"loginRequest":                &loginRequest{},
+	"paymentRequest":              &paymentRequest{},
+	"placeHoldRequest":            &placeHoldRequest{},
+	"refreshAccessTokenRequest":   &refreshAccessTokenRequest{},
+	"registerRequest":             &registerRequest{},
+	"renewRequest":                &renewRequest{},
+	"requestPasswordResetRequest": &requestPasswordResetRequest{},
+	"resetPasswordRequest":        &resetPasswordRequest{},
+	"resetUserPasswordRequest":    &resetUserPasswordRequest{},
+	"roleRequest":                 &roleRequest{},
+	"unlockLoginRequest":          &unlockLoginRequest{},
+	"updateBookRequest":           &updateBookRequest{},
+	"updateItemRequest":           &updateItemRequest{},
+	"updateUserRequest":           &updateUserRequest{},
+	"waiverRequest":               &waiverRequest{},
+}
+
+func TestRequestTags(t *testing.T) {
+	for name, request := range requests {
+		if err := validate.CheckTags(request); err != nil {
+			t.Errorf("%v: %v", name, err)
+		}
+	}
+}
+
+// TestRequestsComplete finds the structs with validate tags in the
+// source of the package, so that a new request cannot be left out of
+// requests
+func TestRequestsComplete(t *testing.T) {
+	fileSet := token.NewFileSet()
+	packages, err := parser.ParseDir(fileSet, ".", func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatalf("ParseDir: %v", err)
+	}
+
+	var missing []string
+	for _, pkg := range packages {
+		ast.Inspect(pkg, func(node ast.Node) bool {
+			spec, ok := node.(*ast.TypeSpec)
+			if !ok {
+				return true
+			}
+
+			structType, ok := spec.Type.(*ast.StructType)
+			if !ok || !hasValidateTag(structType) {
+				return true
+			}
+
+			if _, ok := requests[spec.Name.Name]; !ok {
+				missing = append(missing, spec.Name.Name)
+			}
+			return true
+		})
+	}
+
+	sort.Strings(missing)
+	for _, name := range missing {
+		t.Errorf("%v has validate tags but is not in requests", name)
+	}
+}
+
+func hasValidateTag(structType *ast.StructType) bool {
+	for _, field := range structType.Fields.List {
+		if field.Tag != nil && strings.Contains(field.Tag.Value, `validate:"`) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,277 @@
+package core
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/rjseymour66/library-go/data"
+	"github.com/rjseymour66/library-go/util"
+	"github.com/rjseymour66/library-go/values"
+)
+
+var (
+	GetRoles       = getRoles
+	GetPermissions = getPermissions
+	CreateRole     = createRole
+	UpdateRole     = updateRole
+	DeleteRole     = deleteRole
+)
+
+type roleRequest struct {
+	Code        int
+	Name        string `validate:"trim,required,max=100"`
+	Description string `validate:"trim,max=1000"`
+	Permissions []string
+}
+
+func getRoles(ctx context.Context) (response interface{}, err error) {
+	response, err = data.GetRoles(ctx)
+	if err != nil {
+		cause := "Failed to get roles"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	return
+}
+
+func getPermissions(ctx context.Context) (response interface{}, err error) {
+	response, err = data.GetPermissions(ctx)
+	if err != nil {
+		cause := "Failed to get permissions"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	return
+}
+
+type createRoleResponse struct {
+	Code int64
+}
+
+func createRole(ctx context.Context, requestBody io.Reader) (response interface{}, err error) {
+	request, err := decodeRoleRequest(ctx, requestBody)
+	if err != nil {
+		return
+	}
+
+	err = checkRoleNameUnused(ctx, request.Name, 0)
+	if err != nil {
+		return
+	}
+
+	var code int64
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+	err = dbRunner.Transact(ctx, nil, func() (err error) {
+		code, err = data.CreateRole(ctx, request.Name, request.Description)
+		if err != nil {
+			cause := "Failed to create role"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		err = data.SetRolePermissions(ctx, int(code), request.Permissions)
+		if err != nil {
+			cause := "Failed to set role permissions"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	invalidatePermissionCache()
+
+	response = &createRoleResponse{
+		Code: code,
+	}
+	return
+}
+
+// updateRole renames a role and replaces its permissions. Librarians
+// cannot take role:manage away from their own role, so that roles can
+// always be managed by someone.
+func updateRole(ctx context.Context, requestBody io.Reader) (err error) {
+	request, err := decodeRoleRequest(ctx, requestBody)
+	if err != nil {
+		return
+	}
+
+	if request.Code <= values.UserRoleUnknown {
+		cause := "Invalid value for role code"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	principal, _ := ctx.Value(values.ContextKeyPrincipal).(*values.Principal)
+	if principal != nil && principal.Role == request.Code && !hasString(request.Permissions, values.PermissionRoleManage) {
+		cause := "Cannot remove " + values.PermissionRoleManage + " from your own role"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	err = checkRoleNameUnused(ctx, request.Name, request.Code)
+	if err != nil {
+		return
+	}
+
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+	err = dbRunner.Transact(ctx, nil, func() (err error) {
+		rowsAffected, err := data.UpdateRole(ctx, request.Code, request.Name, request.Description)
+		if err != nil {
+			cause := "Failed to update role"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		if rowsAffected == 0 {
+			cause := "Role not found"
+			err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+			return
+		}
+
+		err = data.SetRolePermissions(ctx, request.Code, request.Permissions)
+		if err != nil {
+			cause := "Failed to set role permissions"
+			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+			return
+		}
+
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	invalidatePermissionCache()
+	return
+}
+
+// deleteRole deletes a role that is not built in and that no user has.
+func deleteRole(ctx context.Context, code string) (err error) {
+	roleCode, err := strconv.Atoi(strings.TrimSpace(code))
+	if err != nil || roleCode <= values.UserRoleUnknown {
+		cause := "Invalid value for role code"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	role, err := data.GetRole(ctx, roleCode)
+	if err != nil {
+		cause := "Failed to get role"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if role == nil {
+		cause := "Role not found"
+		err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+		return
+	}
+
+	if role.BuiltIn {
+		cause := "Built-in roles cannot be deleted"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	users, err := data.CountRoleUsers(ctx, roleCode)
+	if err != nil {
+		cause := "Failed to count role users"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if users > 0 {
+		cause := "Role is still assigned to users"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrConflict, err)
+		return
+	}
+
+	_, err = data.DeleteRole(ctx, roleCode)
+	if err != nil {
+		cause := "Failed to delete role"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	invalidatePermissionCache()
+	return
+}
+
+// decodeRoleRequest decodes and validates a role. Its permissions must
+// exist, and are returned without duplicates.
+func decodeRoleRequest(ctx context.Context, requestBody io.Reader) (request *roleRequest, err error) {
+	request = &roleRequest{}
+	err = decodeRequest(requestBody, request)
+	if err != nil {
+		return
+	}
+
+	known, err := data.GetPermissions(ctx)
+	if err != nil {
+		cause := "Failed to get permissions"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	permissions := make([]string, 0, len(request.Permissions))
+	for _, permission := range request.Permissions {
+		permission = strings.ToLower(strings.TrimSpace(permission))
+		if !isKnownPermission(known, permission) {
+			cause := "Unknown permission " + permission
+			err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+			return
+		}
+
+		if !hasString(permissions, permission) {
+			permissions = append(permissions, permission)
+		}
+	}
+
+	request.Permissions = permissions
+	return
+}
+
+// checkRoleNameUnused fails if a role other than the one with the code
+// has the name.
+func checkRoleNameUnused(ctx context.Context, name string, code int) (err error) {
+	existingCode, err := data.GetRoleCodeByName(ctx, name)
+	if err != nil {
+		cause := "Failed to get role by name"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if existingCode != 0 && int(existingCode) != code {
+		cause := "Role name is already taken"
+		err = util.NewErrorWithReference(cause, util.ErrorCodeDuplicateRoleName, strconv.FormatInt(existingCode, 10), util.ErrConflict, err)
+		return
+	}
+
+	return
+}
+
+func isKnownPermission(known []*data.PermissionEntity, permission string) bool {
+	for _, entity := range known {
+		if entity.Permission == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func hasString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
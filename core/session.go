@@ -0,0 +1,99 @@
+package core
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/rjseymour66/library-go/data"
+	"github.com/rjseymour66/library-go/util"
+)
+
+var (
+	Logout                = logout
+	LogoutEverywhere      = logoutEverywhere
+	DeleteExpiredSessions = deleteExpiredSessions
+)
+
+// logout ends the session of the token.
+func logout(ctx context.Context, token string) (err error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		cause := "Invalid value for token parameter"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	// Access tokens expire on their own; logging out ends the
+	// session they were refreshed from
+	if isAccessToken(token) {
+		cause := "Log out with the session token"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	// API keys are revoked instead
+	if isAPIKey(token) {
+		cause := "Revoke the API key instead of logging out"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	_, err = data.DeleteSession(ctx, token)
+	if err != nil {
+		cause := "Failed to end session"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	return
+}
+
+// logoutEverywhere ends every session of the user with the token,
+// including the one of the token.
+func logoutEverywhere(ctx context.Context, token string) (err error) {
+	err = requireNotAPIKey(ctx)
+	if err != nil {
+		return
+	}
+
+	userID, err := data.GetUserID(ctx, token)
+	if err != nil {
+		cause := "Failed to get userUID"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if userID == "" {
+		cause := "Session not found"
+		err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+		return
+	}
+
+	_, err = data.DeleteUserSessions(ctx, userID)
+	if err != nil {
+		cause := "Failed to end sessions"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	return
+}
+
+// deleteExpiredSessions removes the sessions that can no longer be
+// used. Expired sessions are already rejected by authorizeUser, so
+// this only keeps the session table small.
+func deleteExpiredSessions(ctx context.Context) (err error) {
+	deleted, err := data.DeleteExpiredSessions(ctx)
+	if err != nil {
+		cause := "Failed to delete expired sessions"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if deleted > 0 {
+		log.Printf("Deleted %v expired sessions\n", deleted)
+	}
+
+	return
+}
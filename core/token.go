@@ -0,0 +1,153 @@
+package core
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rjseymour66/library-go/config"
+	"github.com/rjseymour66/library-go/jwt"
+	"github.com/rjseymour66/library-go/util"
+	"github.com/rjseymour66/library-go/values"
+)
+
+var (
+	InitAccessTokens     = initAccessTokens
+	IsAccessToken        = isAccessToken
+	AuthorizeAccessToken = authorizeAccessToken
+	RefreshAccessToken   = refreshAccessToken
+)
+
+// accessTokenKeys signs and verifies access tokens. It is nil if no
+// key is configured, which disables access tokens.
+var accessTokenKeys *jwt.KeySet
+
+// initAccessTokens loads the access token keys from the files in the
+// config. The name of each file without its extension is the kid of
+// its key.
+func initAccessTokens() (err error) {
+	fileNames := config.GetAuthJWTKeyFiles()
+	if len(fileNames) == 0 {
+		return
+	}
+
+	keys := make([]*jwt.Key, 0, len(fileNames))
+	for _, fileName := range fileNames {
+		id := strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+
+		key, err := jwt.LoadKey(id, fileName)
+		if err != nil {
+			return err
+		}
+
+		keys = append(keys, key)
+	}
+
+	accessTokenKeys, err = jwt.NewKeySet(config.GetAuthJWTSigningKey(), keys...)
+	return
+}
+
+// isAccessToken returns whether the token is an access token rather
+// than a session token.
+func isAccessToken(token string) bool {
+	return jwt.IsToken(token)
+}
+
+// authorizeAccessToken verifies the access token without a database
+// query and returns the user and role in it.
+func authorizeAccessToken(ctx context.Context, token string) (response *values.Principal, err error) {
+	if accessTokenKeys == nil {
+		cause := "Access tokens are not enabled"
+		err = util.NewError(cause, util.ErrorCodeInvalidCredentials, util.ErrNotAuthenticated, err)
+		return
+	}
+
+	claims, err := accessTokenKeys.Verify(strings.TrimSpace(token), time.Now())
+	if err != nil {
+		cause := "Invalid access token"
+		err = util.NewError(cause, util.ErrorCodeInvalidCredentials, util.ErrNotAuthenticated, err)
+		return
+	}
+
+	response = &values.Principal{
+		UserID: claims.Subject,
+		Role:   claims.Role,
+	}
+	return
+}
+
+type refreshAccessTokenRequest struct {
+	RefreshToken string `validate:"trim,required"`
+}
+
+type refreshAccessTokenResponse struct {
+	AccessToken string
+	ExpiresAt   time.Time
+}
+
+// refreshAccessToken issues a new access token for a session. The
+// session token is the refresh token.
+func refreshAccessToken(ctx context.Context, requestBody io.Reader) (response interface{}, err error) {
+	request := &refreshAccessTokenRequest{}
+	err = decodeRequest(requestBody, request)
+	if err != nil {
+		return
+	}
+
+	// An API key would lose its scopes in an access token
+	if isAccessToken(request.RefreshToken) || isAPIKey(request.RefreshToken) {
+		cause := "Invalid value for refresh token"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	accessToken, expiresAt, err := issueAccessToken(ctx, request.RefreshToken)
+	if err != nil {
+		return
+	}
+
+	response = &refreshAccessTokenResponse{
+		AccessToken: accessToken,
+		ExpiresAt:   expiresAt,
+	}
+	return
+}
+
+// issueAccessToken signs an access token for the user of a live
+// session, which also counts as a use of the session.
+func issueAccessToken(ctx context.Context, sessionToken string) (token string, expiresAt time.Time, err error) {
+	if accessTokenKeys == nil {
+		cause := "Access tokens are not enabled"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	principal, err := authorizeUser(ctx, sessionToken)
+	if err != nil {
+		// The session expired or its user is no longer active
+		if _, _, _, errorType := util.IsError(err); errorType == util.ErrResourceNotFound {
+			cause := "Invalid or expired refresh token"
+			err = util.NewError(cause, util.ErrorCodeInvalidCredentials, util.ErrNotAuthenticated, err)
+		}
+		return
+	}
+
+	now := time.Now()
+	expiresAt = now.Add(config.GetAuthJWTLifetime())
+
+	token, err = accessTokenKeys.Sign(&jwt.Claims{
+		Subject:   principal.UserID,
+		Role:      principal.Role,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		cause := "Failed to sign access token"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	return
+}
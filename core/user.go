@@ -2,10 +2,12 @@ package core
 
 import (
 	"context"
-	"encoding/json"
 	"io"
 	"strings"
+	"time"
 
+	"github.com/rjseymour66/library-go/config"
+	"github.com/rjseymour66/library-go/data"
 	"github.com/rjseymour66/library-go/util"
 	"github.com/rjseymour66/library-go/values"
 )
@@ -13,74 +15,299 @@ import (
 var (
 	Login         = login
 	AuthorizeUser = authorizeUser
+	Register      = register
+	GetUsers      = getUsers
+	ApproveUser   = approveUser
+	RejectUser    = rejectUser
+	SuspendUser   = suspendUser
 )
 
-func login(ctx context.Context, requestBody io.Reader) (response interface{}, err error) {
-	type loginRequest struct {
-		Username string
-		Password string
-	}
+type loginRequest struct {
+	Username string `validate:"trim,required,max=100"`
+	Password string `validate:"trim,required"`
+
+	// AccessToken also issues a signed access token, for services
+	// that authorize requests without a database
+	AccessToken bool
+}
 
+// login starts a session for the user once an authenticator accepts
+// the password. Failed logins back off and lock out the username and
+// the client IP address.
+func login(ctx context.Context, clientIP string, requestBody io.Reader) (response interface{}, err error) {
 	request := &loginRequest{}
-	err = json.NewDecoder(requestBody).Decode(request)
+	err = decodeRequest(requestBody, request)
 	if err != nil {
-		cause := "Failed to decode JSON"
-		err = util.NewError(cause, util.ErrorCodeInvalidJSONBody, util.ErrBadRequest, err)
 		return
 	}
 
-	request.Username = strings.TrimSpace(request.Username)
-	request.Password = strings.TrimSpace(request.Password)
-	if request.Username == "" || request.Password == "" {
-		cause := "Username or password are empty"
-		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+	err = reserveLoginAttempt(ctx, request.Username, clientIP)
+	if err != nil {
 		return
 	}
 
-	token, err := data.LoginUser(ctx, request.Username, request.Password)
+	userID, err := authenticate(ctx, request.Username, request.Password)
 	if err != nil {
 		cause := "Failed to login user"
 		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
 		return
 	}
 
-	if token == "" {
+	// The attempt was counted as failed when it was reserved
+	if userID == "" {
 		cause := "Invalid username or password"
 		err = util.NewError(cause, util.ErrorCodeInvalidCredentials, util.ErrNotAuthenticated, err)
 		return
 	}
 
-	type loginResponse struct {
-		Token string
+	err = releaseLoginAttempt(ctx, request.Username, clientIP)
+	if err != nil {
+		return
+	}
+
+	return startSession(ctx, userID, request.AccessToken)
+}
+
+type loginResponse struct {
+	Token                string
+	ExpiresAt            time.Time
+	AccessToken          string     `json:",omitempty"`
+	AccessTokenExpiresAt *time.Time `json:",omitempty"`
+}
+
+// startSession starts a session for a user who signed in, and also
+// issues an access token if asked to.
+func startSession(ctx context.Context, userID string, withAccessToken bool) (response interface{}, err error) {
+	status, err := data.GetUserStatus(ctx, userID)
+	if err != nil {
+		cause := "Failed to get user status"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if status != values.UserStatusActive {
+		cause := "Account is not active"
+		if status == values.UserStatusPending {
+			cause = "Account is waiting for approval by a librarian"
+		}
+		err = util.NewError(cause, util.ErrorCodeAccountNotActive, util.ErrNotAuthenticated, err)
+		return
+	}
+
+	session, err := data.CreateSession(
+		ctx,
+		userID,
+		config.GetAuthSessionIdleTimeout(),
+		config.GetAuthSessionMaxLifetime())
+	if err != nil {
+		cause := "Failed to create session"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	loginResp := &loginResponse{
+		Token:     session.Token,
+		ExpiresAt: session.ExpiresAt,
 	}
 
-	response = &loginResponse{
-		Token: token,
+	if withAccessToken {
+		accessToken, expiresAt, err := issueAccessToken(ctx, session.Token)
+		if err != nil {
+			return nil, err
+		}
+
+		loginResp.AccessToken = accessToken
+		loginResp.AccessTokenExpiresAt = &expiresAt
 	}
+
+	response = loginResp
 	return
 }
 
-func authorizeUser(ctx context.Context, token string) (response int, err error) {
+// authorizeUser returns the user of a session token or an API key and
+// its role.
+func authorizeUser(ctx context.Context, token string) (response *values.Principal, err error) {
 	token = strings.TrimSpace(token)
 	if token == "" {
 		cause := "Invalid value for token parameter"
 		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
 		return
 	}
-	userRole, err := data.AuthorizeUser(ctx, token) {
-		if err != nil {
-			cause := "Failed to authorize user"
-			err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
-			return
-		}
+	// Expired sessions and API keys, and pending, rejected and
+	// suspended users have no role
+	if isAPIKey(token) {
+		response, err = data.AuthorizeAPIKey(ctx, hashAPIKey(token))
+	} else {
+		response, err = data.AuthorizeUser(
+			ctx,
+			token,
+			config.GetAuthSessionIdleTimeout(),
+			config.GetAuthSessionMaxLifetime())
+	}
+	if err != nil {
+		cause := "Failed to authorize user"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
 
-		if userRole == values.UserRoleUnknown {
-			cause := "User not found"
-			err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
-			return
-		}
-		response = int(userRole)
+	if response == nil {
+		cause := "User not found"
+		err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+		return
+	}
+
+	return
+}
+
+type registerRequest struct {
+	Username string `validate:"trim,required,max=100"`
+	Password string
+	FullName string `validate:"trim,required,max=255"`
+}
+
+type registerResponse struct {
+	UserID string
+	Status int
+}
+
+// register creates a member account that can only log in once a
+// librarian approves it.
+func register(ctx context.Context, requestBody io.Reader) (response interface{}, err error) {
+	request := &registerRequest{}
+	err = decodeRequest(requestBody, request)
+	if err != nil {
+		return
+	}
+
+	err = checkPasswordPolicy(request.Password)
+	if err != nil {
+		return
+	}
+
+	existingID, err := data.GetUserIDByUsername(ctx, request.Username)
+	if err != nil {
+		cause := "Failed to get user by username"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
 
+	if existingID != "" {
+		cause := "Username is already taken"
+		err = util.NewError(cause, util.ErrorCodeDuplicateUsername, util.ErrConflict, err)
 		return
 	}
+
+	userID, err := data.RegisterUser(ctx, request.Username, request.Password, request.FullName)
+	if err != nil {
+		cause := "Failed to register user"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	response = &registerResponse{
+		UserID: userID,
+		Status: values.UserStatusPending,
+	}
+	return
+}
+
+type getUsersResponse struct {
+	Users     []*data.UserInfo
+	RowOffset int
+	RowLimit  int
+}
+
+func getUsers(ctx context.Context, status, rowOffset, rowLimit int) (response interface{}, err error) {
+	if status < values.UserStatusUnknown || status > values.UserStatusDeactivated {
+		cause := "Invalid value for status parameter"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	if rowOffset < 0 {
+		cause := "Invalid value for row offset parameter"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	if rowLimit < 0 || rowLimit > values.MaxRowLimit {
+		cause := "Invalid value for row limit parameter"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	if rowLimit == 0 {
+		rowLimit = values.MaxRowLimit
+	}
+
+	users, err := data.GetUsersByStatus(ctx, status, rowOffset, rowLimit)
+	if err != nil {
+		cause := "Failed to get users"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	response = &getUsersResponse{
+		Users:     users,
+		RowOffset: rowOffset,
+		RowLimit:  rowLimit,
+	}
+	return
+}
+
+// approveUser activates a pending account, or reinstates a suspended
+// or deactivated one.
+func approveUser(ctx context.Context, requestBody io.Reader) (err error) {
+	return changeUserStatus(ctx, requestBody, values.UserStatusActive,
+		values.UserStatusPending, values.UserStatusSuspended, values.UserStatusDeactivated)
+}
+
+func rejectUser(ctx context.Context, requestBody io.Reader) (err error) {
+	return changeUserStatus(ctx, requestBody, values.UserStatusRejected, values.UserStatusPending)
+}
+
+func suspendUser(ctx context.Context, requestBody io.Reader) (err error) {
+	return changeUserStatus(ctx, requestBody, values.UserStatusSuspended, values.UserStatusActive)
+}
+
+type changeUserStatusRequest struct {
+	UserID string `validate:"trim,required,uuid"`
+}
+
+// changeUserStatus moves the user in the request body to the status,
+// if its current status is one of fromStatuses.
+func changeUserStatus(ctx context.Context, requestBody io.Reader, status int, fromStatuses ...int) (err error) {
+	request := &changeUserStatusRequest{}
+	err = decodeRequest(requestBody, request)
+	if err != nil {
+		return
+	}
+
+	exists, err := data.UserExists(ctx, request.UserID)
+	if err != nil {
+		cause := "Failed to get user"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if !exists {
+		cause := "User not found"
+		err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+		return
+	}
+
+	rowsAffected, err := data.ChangeUserStatus(ctx, request.UserID, status, fromStatuses...)
+	if err != nil {
+		cause := "Failed to change user status"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if rowsAffected == 0 {
+		cause := "User status does not allow this change"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	return
 }
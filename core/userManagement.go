@@ -0,0 +1,440 @@
+package core
+
+import (
+	"context"
+	"io"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/rjseymour66/library-go/data"
+	"github.com/rjseymour66/library-go/util"
+	"github.com/rjseymour66/library-go/values"
+)
+
+var (
+	CreateUser        = createUser
+	GetUser           = getUser
+	GetAllUsers       = getAllUsers
+	UpdateUser        = updateUser
+	ChangeUserRole    = changeUserRole
+	ResetUserPassword = resetUserPassword
+	DeactivateUser    = deactivateUser
+)
+
+type createUserRequest struct {
+	Username string `validate:"trim,required,max=100"`
+	Password string
+	FullName string `validate:"trim,required,max=255"`
+	Email    string `validate:"trim,max=255,email"`
+	Phone    string `validate:"trim,max=50"`
+	Role     int
+}
+
+func createUser(ctx context.Context, requestBody io.Reader) (response interface{}, err error) {
+	request := &createUserRequest{}
+	err = decodeRequest(requestBody, request)
+	if err != nil {
+		return
+	}
+
+	err = checkPasswordPolicy(request.Password)
+	if err != nil {
+		return
+	}
+
+	err = validateUserRole(ctx, request.Role)
+	if err != nil {
+		return
+	}
+
+	err = checkRoleAssignable(ctx, request.Role)
+	if err != nil {
+		return
+	}
+
+	email, err := normalizeEmail(request.Email)
+	if err != nil {
+		return
+	}
+
+	existingID, err := data.GetUserIDByUsername(ctx, request.Username)
+	if err != nil {
+		cause := "Failed to get user by username"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if existingID != "" {
+		cause := "Username is already taken"
+		err = util.NewErrorWithReference(cause, util.ErrorCodeDuplicateUsername, existingID, util.ErrConflict, err)
+		return
+	}
+
+	response, err = data.CreateUser(
+		ctx,
+		request.Username,
+		request.Password,
+		request.FullName,
+		util.NewNullableString(email),
+		util.NewNullableString(request.Phone),
+		request.Role)
+	if err != nil {
+		cause := "Failed to create user"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	return
+}
+
+func getUser(ctx context.Context, userID string) (response interface{}, err error) {
+	userID = strings.TrimSpace(userID)
+	if userID == "" {
+		cause := "Invalid value for userID parameter"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	user, err := data.GetUser(ctx, userID)
+	if err != nil {
+		cause := "Failed to get user"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if user == nil {
+		cause := "User not found"
+		err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+		return
+	}
+
+	response = user
+	return
+}
+
+func getAllUsers(ctx context.Context, params *ListParams) (response interface{}, err error) {
+	rowOffset, rowLimit := params.RowOffset, params.RowLimit
+
+	if rowOffset < 0 {
+		cause := "Invalid value for row offset parameter"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	if rowLimit < 0 || rowLimit > values.MaxRowLimit {
+		cause := "Invalid value for row limit parameter"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	if rowLimit == 0 {
+		rowLimit = values.MaxRowLimit
+	}
+
+	searchTerm := strings.TrimSpace(params.SearchTerm)
+
+	users, err := data.GetAllUsers(ctx, searchTerm, rowOffset, rowLimit)
+	if err != nil {
+		cause := "Failed to get all users"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	totalCount, err := data.CountUsers(ctx, searchTerm)
+	if err != nil {
+		cause := "Failed to count users"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	type metaData struct {
+		SearchTerm string `json:",omitempty"`
+		RowOffset  int    `json:",omitempty"`
+		RowLimit   int
+		TotalCount int64
+	}
+
+	response = &getAllResponse{
+		Data: users,
+		Meta: &metaData{
+			SearchTerm: searchTerm,
+			RowOffset:  rowOffset,
+			RowLimit:   rowLimit,
+			TotalCount: totalCount,
+		},
+		links: makePageLinks(false, rowOffset, rowLimit, totalCount, ""),
+	}
+	return
+}
+
+type updateUserRequest struct {
+	UserID   string `validate:"trim,required,uuid"`
+	FullName string `validate:"trim,required,max=255"`
+	Email    string `validate:"trim,max=255,email"`
+	Phone    string `validate:"trim,max=50"`
+}
+
+func updateUser(ctx context.Context, requestBody io.Reader) (response interface{}, err error) {
+	request := &updateUserRequest{}
+	err = decodeRequest(requestBody, request)
+	if err != nil {
+		return
+	}
+
+	email, err := normalizeEmail(request.Email)
+	if err != nil {
+		return
+	}
+
+	err = checkUserManageable(ctx, request.UserID)
+	if err != nil {
+		return
+	}
+
+	updatedAt, err := data.UpdateUser(
+		ctx,
+		request.UserID,
+		request.FullName,
+		util.NewNullableString(email),
+		util.NewNullableString(request.Phone))
+	if err != nil {
+		cause := "Failed to update user"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	return makeUserUpdatedResponse(updatedAt)
+}
+
+type changeUserRoleRequest struct {
+	UserID string `validate:"trim,required,uuid"`
+	Role   int
+}
+
+// changeUserRole changes the role of a user. Librarians cannot change
+// their own role, so that the library is never left without one.
+func changeUserRole(ctx context.Context, token string, requestBody io.Reader) (response interface{}, err error) {
+	request := &changeUserRoleRequest{}
+	err = decodeRequest(requestBody, request)
+	if err != nil {
+		return
+	}
+
+	err = validateUserRole(ctx, request.Role)
+	if err != nil {
+		return
+	}
+
+	err = checkNotSelf(ctx, token, request.UserID)
+	if err != nil {
+		return
+	}
+
+	updatedAt, err := data.ChangeUserRole(ctx, request.UserID, request.Role)
+	if err != nil {
+		cause := "Failed to change user role"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	return makeUserUpdatedResponse(updatedAt)
+}
+
+type resetUserPasswordRequest struct {
+	UserID   string `validate:"trim,required,uuid"`
+	Password string
+}
+
+// resetUserPassword sets a new password for a user and ends their
+// sessions.
+func resetUserPassword(ctx context.Context, requestBody io.Reader) (err error) {
+	request := &resetUserPasswordRequest{}
+	err = decodeRequest(requestBody, request)
+	if err != nil {
+		return
+	}
+
+	err = checkPasswordPolicy(request.Password)
+	if err != nil {
+		return
+	}
+
+	err = checkUserManageable(ctx, request.UserID)
+	if err != nil {
+		return
+	}
+
+	err = checkDatabasePassword(ctx, request.UserID)
+	if err != nil {
+		return
+	}
+
+	rowsAffected, err := data.ResetUserPassword(ctx, request.UserID, request.Password)
+	if err != nil {
+		cause := "Failed to reset password"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if rowsAffected == 0 {
+		cause := "User not found"
+		err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+		return
+	}
+
+	return
+}
+
+// deactivateUser closes an account. The user keeps their loans and
+// ledger, and a librarian can reinstate them with approveUser.
+func deactivateUser(ctx context.Context, token, userID string) (err error) {
+	userID = strings.TrimSpace(userID)
+	if userID == "" {
+		cause := "Invalid value for userID parameter"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	err = checkNotSelf(ctx, token, userID)
+	if err != nil {
+		return
+	}
+
+	rowsAffected, err := data.ChangeUserStatus(
+		ctx,
+		userID,
+		values.UserStatusDeactivated,
+		values.UserStatusPending,
+		values.UserStatusActive,
+		values.UserStatusSuspended)
+	if err != nil {
+		cause := "Failed to deactivate user"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if rowsAffected == 0 {
+		cause := "User not found or already closed"
+		err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+		return
+	}
+
+	_, err = data.DeleteUserSessions(ctx, userID)
+	if err != nil {
+		cause := "Failed to end sessions"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	return
+}
+
+func validateUserRole(ctx context.Context, role int) (err error) {
+	if role <= values.UserRoleUnknown {
+		cause := "Invalid value for user role"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	existing, err := data.GetRole(ctx, role)
+	if err != nil {
+		cause := "Failed to get role"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if existing == nil {
+		cause := "Invalid value for user role"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	return
+}
+
+// checkRoleAssignable fails unless the role is member or the user the
+// request is authorized for can manage roles, so that managing users
+// is not enough to hand out more permissions than a member has.
+func checkRoleAssignable(ctx context.Context, role int) (err error) {
+	if role == values.UserRoleMember {
+		return
+	}
+
+	return requirePermission(ctx, values.PermissionRoleManage)
+}
+
+// checkUserManageable fails unless the role of the user could be
+// assigned by the user the request is authorized for, so that the
+// password or email of an account with more permissions cannot be
+// changed to take it over.
+func checkUserManageable(ctx context.Context, userID string) (err error) {
+	user, err := data.GetUser(ctx, userID)
+	if err != nil {
+		cause := "Failed to get user"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if user == nil {
+		cause := "User not found"
+		err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+		return
+	}
+
+	return checkRoleAssignable(ctx, int(user.Role))
+}
+
+// normalizeEmail validates an optional email address and returns it
+// without a display name.
+func normalizeEmail(email string) (response string, err error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return
+	}
+
+	address, err := mail.ParseAddress(email)
+	if err != nil {
+		cause := "Invalid value for email"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	response = address.Address
+	return
+}
+
+// checkNotSelf fails if the user with the token is the user.
+func checkNotSelf(ctx context.Context, token, userID string) (err error) {
+	callerID, err := data.GetUserID(ctx, token)
+	if err != nil {
+		cause := "Failed to get userUID"
+		err = util.NewError(cause, util.ErrorCodeInternal, util.ErrInternal, err)
+		return
+	}
+
+	if callerID == userID {
+		cause := "Librarians cannot change their own role or status"
+		err = util.NewError(cause, util.ErrorCodeValidation, util.ErrBadRequest, err)
+		return
+	}
+
+	return
+}
+
+type updateUserResponse struct {
+	UpdatedAt time.Time
+}
+
+func makeUserUpdatedResponse(updatedAt time.Time) (response interface{}, err error) {
+	if updatedAt.IsZero() {
+		cause := "User not found"
+		err = util.NewError(cause, util.ErrorCodeEntityNotFound, util.ErrResourceNotFound, err)
+		return
+	}
+
+	response = &updateUserResponse{
+		UpdatedAt: updatedAt,
+	}
+	return
+}
@@ -0,0 +1,195 @@
+package data
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/rjseymour66/library-go/values"
+)
+
+type APIKeyEntity struct {
+	APIKeyID   string
+	Name       string
+	Prefix     string
+	Scopes     []string `json:",omitempty"`
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time `json:",omitempty"`
+	LastUsedAt *time.Time `json:",omitempty"`
+}
+
+var (
+	// CreateAPIKey stores the hash of an API key for the user and
+	// returns its ID. A nil expiresAt never expires; nil scopes give
+	// the key every permission of the role of the user
+	CreateAPIKey = createAPIKey
+
+	// GetUserAPIKeys returns the API keys of the user that are not
+	// revoked, newest first
+	GetUserAPIKeys = getUserAPIKeys
+
+	// RevokeAPIKey revokes the API key if it belongs to the user.
+	// Returns the rows affected
+	RevokeAPIKey = revokeAPIKey
+
+	// AuthorizeAPIKey records the use of the unrevoked, unexpired API
+	// key with the hash of an active user, and returns the user, role
+	// and scopes. If there is none, returns nil
+	AuthorizeAPIKey = authorizeAPIKey
+)
+
+func createAPIKey(ctx context.Context, userID, name, prefix, keyHash string, scopes []string, expiresAt *time.Time) (response string, err error) {
+	query := `
+		INSERT INTO api_key(user_id, key_name, key_prefix, key_hash, scoped, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING api_key_id`
+
+	response, err = executeQueryWithStringResponse(ctx, query, userID, name, prefix, keyHash, scopes != nil, expiresAt)
+	if err != nil {
+		return
+	}
+
+	query = `INSERT INTO api_key_scope(api_key_id, permission) VALUES ($1, $2)`
+
+	for _, scope := range scopes {
+		_, err = executeQueryWithRowsAffected(ctx, query, response, scope)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func getUserAPIKeys(ctx context.Context, userID string) (response []*APIKeyEntity, err error) {
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+
+	// expires_at and last_used_at are NULL until set, so they are
+	// read behind a flag
+	query := `
+		SELECT
+			k.api_key_id,
+			k.key_name,
+			k.key_prefix,
+			k.scoped::int,
+			coalesce((
+				SELECT string_agg(s.permission, ',' ORDER BY s.permission)
+				FROM api_key_scope s
+				WHERE s.api_key_id = k.api_key_id), ''),
+			k.created_at,
+			(k.expires_at IS NOT NULL)::int,
+			coalesce(k.expires_at, k.created_at),
+			(k.last_used_at IS NOT NULL)::int,
+			coalesce(k.last_used_at, k.created_at)
+		FROM api_key k
+		WHERE k.user_id = $1
+			and k.revoked_at IS NULL
+		ORDER BY k.created_at DESC`
+
+	rows, err := dbRunner.Query(ctx, query, userID)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	rr, err := dbserver.GetRowReader(rows)
+	if err != nil {
+		return
+	}
+
+	response = make([]*APIKeyEntity, 0)
+	for rr.ScanNext() {
+		apiKey := &APIKeyEntity{}
+		apiKey.APIKeyID = rr.ReadByIdxString(0)
+		apiKey.Name = rr.ReadByIdxString(1)
+		apiKey.Prefix = rr.ReadByIdxString(2)
+		apiKey.Scopes = readScopes(rr.ReadByIdxInt64(3) == 1, rr.ReadByIdxString(4))
+		apiKey.CreatedAt = rr.ReadByIdxTime(5)
+
+		if rr.ReadByIdxInt64(6) == 1 {
+			expiresAt := rr.ReadByIdxTime(7)
+			apiKey.ExpiresAt = &expiresAt
+		}
+
+		if rr.ReadByIdxInt64(8) == 1 {
+			lastUsedAt := rr.ReadByIdxTime(9)
+			apiKey.LastUsedAt = &lastUsedAt
+		}
+
+		response = append(response, apiKey)
+	}
+
+	err = rr.Error()
+	return
+}
+
+func revokeAPIKey(ctx context.Context, userID, apiKeyID string) (response int64, err error) {
+	query := `
+		UPDATE api_key
+		SET revoked_at = now()
+		WHERE api_key_id = $1
+			and user_id = $2
+			and revoked_at IS NULL`
+
+	return executeQueryWithRowsAffected(ctx, query, apiKeyID, userID)
+}
+
+func authorizeAPIKey(ctx context.Context, keyHash string) (response *values.Principal, err error) {
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+
+	query := `
+		UPDATE api_key k
+		SET last_used_at = now()
+		FROM library_user u
+		WHERE k.key_hash = $1
+			and k.revoked_at IS NULL
+			and (k.expires_at IS NULL or k.expires_at > now())
+			and u.user_id = k.user_id
+			and u.user_status = $2
+		RETURNING
+			u.user_id,
+			u.user_role,
+			k.scoped::int,
+			coalesce((
+				SELECT string_agg(s.permission, ',')
+				FROM api_key_scope s
+				WHERE s.api_key_id = k.api_key_id), '')`
+
+	rows, err := dbRunner.Query(ctx, query, keyHash, values.UserStatusActive)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	rr, err := dbserver.GetRowReader(rows)
+	if err != nil {
+		return
+	}
+
+	if rr.ScanNext() {
+		response = &values.Principal{}
+		response.UserID = rr.ReadByIdxString(0)
+		response.Role = int(rr.ReadByIdxInt64(1))
+		response.Scopes = readScopes(rr.ReadByIdxInt64(2) == 1, rr.ReadByIdxString(3))
+		response.APIKey = true
+	}
+
+	err = rr.Error()
+	return
+}
+
+// readScopes splits the aggregated scopes of a key. An unscoped key
+// has nil scopes, a scoped key at least an empty slice.
+func readScopes(scoped bool, scopes string) []string {
+	if !scoped {
+		return nil
+	}
+
+	if scopes == "" {
+		return make([]string, 0)
+	}
+
+	return strings.Split(scopes, ",")
+}
@@ -2,6 +2,8 @@ package data
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/rjseymour66/library-go/util"
@@ -13,11 +15,11 @@ type BookEntity struct {
 	BookName    string
 	AuthorName  string
 	Publisher   string
-	Description string `json:", omitempty"`
-	Status      int
+	Description string `json:",omitempty"`
+	ISBN13      string `json:",omitempty"`
+	ISBN10      string `json:",omitempty"`
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
-	BorrowerID  string `json:", omitempty"`
 }
 
 type BookDetails struct {
@@ -25,25 +27,37 @@ type BookDetails struct {
 	BookName    string
 	AuthorName  string
 	Publisher   string
-	Description string `json:", omitempty"`
+	Description string `json:",omitempty"`
+	ISBN13      string `json:",omitempty"`
+	ISBN10      string `json:",omitempty"`
 }
 
 type BookInfoLibrarian struct {
-	BookID     string
-	BookName   string
-	AuthorName string
-	Publisher  string
-	Status     int64
-	Borrower   string `json:", omitempty"`
+	BookID          string
+	BookName        string
+	AuthorName      string
+	Publisher       string
+	TotalCopies     int64
+	AvailableCopies int64
+	CursorKey       string `json:"-"`
 }
 
 type BookInfoMember struct {
-	BookID     string
-	BookName   string
-	AuthorName string
-	Publisher  string
+	BookID          string
+	BookName        string
+	AuthorName      string
+	Publisher       string
+	AvailableCopies int64
+	CursorKey       string `json:"-"`
 }
 
+// ErrDuplicateISBN is returned by CreateBook and UpdateBook when
+// another book already has the ISBN-13
+var ErrDuplicateISBN = errors.New("Duplicate ISBN")
+
+// bookISBNConstraint is the UNIQUE constraint of book.isbn_13
+const bookISBNConstraint = "book_isbn_13_key"
+
 var (
 	CreateBook              = createBook
 	GetBook                 = getBook
@@ -51,20 +65,45 @@ var (
 	GetAllBooksForLibrarian = getAllBooksForLibrarian
 	UpdateBook              = updateBook
 	DeleteBook              = deleteBook
-	GetBookStatus           = getBookStatus
-	GetBorrowerID           = getBorrowerID
-	ChangeBookStatus        = changeBookStatus
+
+	// GetBookIDByISBN returns the ID of the book with the
+	// normalized ISBN-13. If there is none, returns empty string
+	GetBookIDByISBN = getBookIDByISBN
+
+	// ForEachBook calls fn with the details of every book that
+	// matches the search, without loading them all in memory
+	ForEachBook = forEachBook
+
+	// ForEachBookForLibrarian calls fn with every row of the
+	// librarian book listing, without loading them all in memory
+	ForEachBookForLibrarian = forEachBookForLibrarian
+
+	// CountBooks returns the number of books that match the search,
+	// ignoring its cursor
+	CountBooks = countBooks
 )
 
-func createBook(ctx context.Context, bookName, authorName, publisher string, description util.NullString) (response *BookEntity, err error) {
+func createBook(
+	ctx context.Context,
+	bookName,
+	authorName,
+	publisher string,
+	description,
+	isbn13,
+	isbn10 util.NullString) (response *BookEntity, err error) {
 	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
 	query := `
 		INSERT into book(
-			book_name, author_name, publisher, book_description)
-		values ($1 $2 $3 $4)
+			book_name, author_name, publisher, book_description, isbn_13, isbn_10)
+		values ($1, $2, $3, $4, $5, $6)
 		returning book_id, created_at`
 
-	rows, err = dbRunner.Query(ctx, query, bookName, authorName, publisher, description)
+	rows, err := dbRunner.Query(ctx, query, bookName, authorName, publisher, description, isbn13, isbn10)
+
+	if isUniqueViolation(err, bookISBNConstraint) {
+		err = ErrDuplicateISBN
+		return
+	}
 
 	if err != nil {
 		return
@@ -84,13 +123,16 @@ func createBook(ctx context.Context, bookName, authorName, publisher string, des
 		response.AuthorName = authorName
 		response.Publisher = publisher
 		response.Description = util.GetNullStringValue(description)
-		response.Status = values.BookStatusAvailable
+		response.ISBN13 = util.GetNullStringValue(isbn13)
+		response.ISBN10 = util.GetNullStringValue(isbn10)
 		response.CreatedAt = rr.ReadByIdxTime(1)
 		response.UpdatedAt = rr.ReadByIdxTime(1)
-		response.BorrowerID = ""
 	}
 
 	err = rr.Error()
+	if isUniqueViolation(err, bookISBNConstraint) {
+		err = ErrDuplicateISBN
+	}
 
 	return
 }
@@ -104,7 +146,9 @@ func getBook(ctx context.Context, bookID string) (response *BookDetails, err err
 			book_name as "BookName",
 			author_name as "AuthorName",
 			publisher as "Publisher",
-			book_description as "Description"
+			book_description as "Description",
+			isbn_13 as "ISBN13",
+			isbn_10 as "ISBN10"
 		FROM book
 		WHERE book_id = $1`
 
@@ -130,22 +174,40 @@ func getBook(ctx context.Context, bookID string) (response *BookDetails, err err
 	return
 }
 
-func getAllBooksForMember(ctx context.Context, searchTerm string, rowOffset, rowLimit int) (response []*BookInfoMember, err error) {
+func getAllBooksForMember(ctx context.Context, search *BookSearch, rowOffset, rowLimit int) (response []*BookInfoMember, err error) {
 	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
 
-	query := `
+	searchQuery, err := makeBookSearchQuery(search, 4)
+	if err != nil {
+		return
+	}
+
+	query := fmt.Sprintf(`
 		SELECT
-			book_id as "BookID",
-			book_name as "BookName",
-			author_name as "AuthorName",
-			publisher as "Publisher"
-		FROM book
-		WHERE book_name like '%%' || $1 || '%%' and book_status = $2
-		OFFSET $3
-		LIMIT $4`
+			b.book_id as "BookID",
+			b.book_name as "BookName",
+			b.author_name as "AuthorName",
+			b.publisher as "Publisher",
+			count(i.item_id) FILTER (WHERE i.item_status = $1) as "AvailableCopies",
+			%v as "CursorKey"
+		FROM book b
+		JOIN item i on i.book_id = b.book_id
+		WHERE %v
+		GROUP BY b.book_id
+		ORDER BY %v
+		OFFSET $2
+		LIMIT $3`, searchQuery.cursorKey, searchQuery.condition, searchQuery.order)
 
-	rows, err := dbRunner.Query(ctx, query, searchTerm, values.BookStatusAvailable, rowOffset, rowLimit)
+	args := append([]interface{}{values.BookStatusAvailable, rowOffset, rowLimit}, searchQuery.args...)
 
+	rows, err := dbRunner.Query(ctx, query, args...)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	rr, err := dbserver.GetRowReader(rows)
 	if err != nil {
 		return
 	}
@@ -163,43 +225,76 @@ func getAllBooksForMember(ctx context.Context, searchTerm string, rowOffset, row
 }
 
 func getAllBooksForLibrarian(
-	ctx context.Context, 
-	searchTerm string, 
-	rowOffset, 
+	ctx context.Context,
+	search *BookSearch,
+	rowOffset,
 	rowLimit int) (response []*BookInfoLibrarian, err error) {
+	response = make([]*BookInfoLibrarian, 0)
+	err = queryBooksForLibrarian(ctx, search, rowOffset, rowLimit, func(book *BookInfoLibrarian) error {
+		response = append(response, book)
+		return nil
+	})
+
+	return
+}
+
+func forEachBookForLibrarian(ctx context.Context, search *BookSearch, fn func(book *BookInfoLibrarian) error) (err error) {
+	// A NULL limit returns every row
+	return queryBooksForLibrarian(ctx, search, 0, nil, fn)
+}
+
+func queryBooksForLibrarian(
+	ctx context.Context,
+	search *BookSearch,
+	rowOffset int,
+	rowLimit interface{},
+	fn func(book *BookInfoLibrarian) error) (err error) {
 	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
 
-	query := `
+	searchQuery, err := makeBookSearchQuery(search, 4)
+	if err != nil {
+		return
+	}
+
+	query := fmt.Sprintf(`
 		SELECT
 			b.book_id as "BookID",
 			b.book_name as "BookName",
 			b.author_name as "AuthorName",
 			b.publisher as "Publisher",
-			b.book_status as "Status",
-			u.full_name as "Borrower"
+			count(i.item_id) as "TotalCopies",
+			count(i.item_id) FILTER (WHERE i.item_status = $1) as "AvailableCopies",
+			%v as "CursorKey"
 		FROM book b
-		LEFT JOIN library_user u on u.user_id = b.borrower_id
-		WHERE b.book_name LIKE '%%' || $1 || '%%'
+		LEFT JOIN item i on i.book_id = b.book_id
+		WHERE %v
+		GROUP BY b.book_id
+		ORDER BY %v
 		OFFSET $2
-		LIMIT $3`
+		LIMIT $3`, searchQuery.cursorKey, searchQuery.condition, searchQuery.order)
+
+	args := append([]interface{}{values.BookStatusAvailable, rowOffset, rowLimit}, searchQuery.args...)
 
-	rows, err := dbRunner.Query(ctx, query, searchTerm, rowOffset, rowLimit)
+	rows, err := dbRunner.Query(ctx, query, args...)
 	if err != nil {
 		return
 	}
 
 	defer rows.Close()
 
-	rr, err :+ dbserver.GetRowReader(rows)
+	rr, err := dbserver.GetRowReader(rows)
 	if err != nil {
 		return
 	}
 
-	response = make([]*BookInfoLibrarian, 0)
 	for rr.ScanNext() {
-		book :+ &BookInfoLibrarian{}
+		book := &BookInfoLibrarian{}
 		rr.ReadAllToStruct(book)
-		response = append(response, book)
+
+		err = fn(book)
+		if err != nil {
+			return
+		}
 	}
 
 	err = rr.Error()
@@ -207,33 +302,41 @@ func getAllBooksForLibrarian(
 }
 
 func updateBook(
-		ctx context.Context, 
-		bookID, 
-		bookName, 
-		authorName, 
-		publisher string, 
-		description util.NullString
-	) (response time.Time, err error) {
+	ctx context.Context,
+	bookID,
+	bookName,
+	authorName,
+	publisher string,
+	description,
+	isbn13,
+	isbn10 util.NullString) (response time.Time, err error) {
 	query := `
 		UPDATE book
 		SET
 			book_name = $1,
 			author_name = $2,
 			publisher = $3,
-			book_description = $4
-		WHERE book_id = $5
+			book_description = $4,
+			isbn_13 = $5,
+			isbn_10 = $6
+		WHERE book_id = $7
 		RETURNING updated_at`
 
-	return executeQueryWithTimeResponse(
-		ctx, 
-		query, 
-		bookName, 
-		authorName, 
-		publisher, 
-		description, 
-		bookID
-	)
+	response, err = executeQueryWithTimeResponse(
+		ctx,
+		query,
+		bookName,
+		authorName,
+		publisher,
+		description,
+		isbn13,
+		isbn10,
+		bookID)
+	if isUniqueViolation(err, bookISBNConstraint) {
+		err = ErrDuplicateISBN
+	}
 
+	return
 }
 
 func deleteBook(ctx context.Context, bookID string) (response int64, err error) {
@@ -241,27 +344,67 @@ func deleteBook(ctx context.Context, bookID string) (response int64, err error)
 	return executeQueryWithRowsAffected(ctx, query, bookID)
 }
 
-func getBookStatus(ctx context.Context, bookID string) (response int64, err error) {
-	query := `SELECT book_status FROM book WHERE book_id = $1`
-	return executeQueryWithInt64Response(ctx, query, bookID)
+func getBookIDByISBN(ctx context.Context, isbn13 string) (response string, err error) {
+	query := `SELECT book_id FROM book WHERE isbn_13 = $1`
+	return executeQueryWithStringResponse(ctx, query, isbn13)
 }
 
-func changeBookStatus(ctx context.Context, bookID string, status int, userID util.NullString) (err error) {
+func forEachBook(ctx context.Context, search *BookSearch, fn func(book *BookDetails) error) (err error) {
 	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
 
-	query := `
-		UPDATE book
-		SET
-			book_status = $1,
-			borrower_id = $2
-		WHERE book_id = $3`
+	searchQuery, err := makeBookSearchQuery(search, 1)
+	if err != nil {
+		return
+	}
 
-	_, err = dbRunner.Exec(ctx, query, status, userID, bookID)
+	query := fmt.Sprintf(`
+		SELECT
+			b.book_id as "BookID",
+			b.book_name as "BookName",
+			b.author_name as "AuthorName",
+			b.publisher as "Publisher",
+			b.book_description as "Description",
+			b.isbn_13 as "ISBN13",
+			b.isbn_10 as "ISBN10"
+		FROM book b
+		WHERE %v
+		ORDER BY %v`, searchQuery.condition, searchQuery.order)
 
+	rows, err := dbRunner.Query(ctx, query, searchQuery.args...)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	rr, err := dbserver.GetRowReader(rows)
+	if err != nil {
+		return
+	}
+
+	for rr.ScanNext() {
+		book := &BookDetails{}
+		rr.ReadAllToStruct(book)
+
+		err = fn(book)
+		if err != nil {
+			return
+		}
+	}
+
+	err = rr.Error()
 	return
 }
 
-func getBorrower(ctx context.Context, bookID string) (response string, err error) {
-	query := `SELECT borrower_id FROM book WHERE book_id = $1`
-	return executeQueryWithStringResponse(ctx, query, bookID)
-}
\ No newline at end of file
+func countBooks(ctx context.Context, search *BookSearch) (response int64, err error) {
+	uncursored := *search
+	uncursored.Cursor = ""
+
+	searchQuery, err := makeBookSearchQuery(&uncursored, 1)
+	if err != nil {
+		return
+	}
+
+	query := fmt.Sprintf(`SELECT count(*) FROM book b WHERE %v`, searchQuery.condition)
+	return executeQueryWithInt64Response(ctx, query, searchQuery.args...)
+}
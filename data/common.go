@@ -2,10 +2,24 @@ package data
 
 import (
 	"context"
+	"errors"
+	"time"
 
+	"github.com/lib/pq"
 	"github.com/rjseymour66/library-go/values"
 )
 
+// uniqueViolation is the SQLSTATE of a write that breaks a UNIQUE
+// constraint
+const uniqueViolation = "23505"
+
+// isUniqueViolation returns whether err is a unique violation of the
+// constraint
+func isUniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation && pqErr.Constraint == constraint
+}
+
 func executeQueryWithStringResponse(ctx context.Context, query string, params ...interface{}) (result string, err error) {
 	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
 
@@ -57,7 +71,7 @@ func executeQueryWithInt64Response(ctx context.Context, query string, params ...
 	return
 }
 
-func executeQueryWithTimeResponse(ctx context.Context, query string, params ..interface{}) (result time.Time, err error) {
+func executeQueryWithTimeResponse(ctx context.Context, query string, params ...interface{}) (result time.Time, err error) {
 	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
 
 	rows, err := dbRunner.Query(ctx, query, params...)
@@ -79,7 +93,7 @@ func executeQueryWithTimeResponse(ctx context.Context, query string, params ..in
 
 	err = rr.Error()
 
-	return 
+	return
 }
 
 func executeQueryWithRowsAffected(ctx context.Context, query string, params ...interface{}) (result int64, err error) {
@@ -90,7 +104,7 @@ func executeQueryWithRowsAffected(ctx context.Context, query string, params ...i
 		return
 	}
 
-	return, err := res.RowsAffected()
+	result, err = res.RowsAffected()
 
 	return
-}
\ No newline at end of file
+}
@@ -0,0 +1,84 @@
+package data
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ErrInvalidCursor is returned for a cursor that is malformed or was
+// made for a listing with another order
+var ErrInvalidCursor = errors.New("Invalid cursor")
+
+// cursor is the content of a cursor token. Keys holds the sort key
+// values of the last book of a page, as text.
+type cursor struct {
+	Sort string
+	Keys []string
+}
+
+var (
+	// MakeBookCursor returns the token that continues a listing after
+	// the book with the cursor key
+	MakeBookCursor = makeBookCursor
+)
+
+// makeBookCursor encodes the cursor key column of a listing, which is
+// already a JSON cursor.
+func makeBookCursor(cursorKey string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorKey))
+}
+
+// makeKeysetCondition returns the condition that selects the books
+// after the cursor in the order of the keys. For keys a and b, both
+// ascending, it is (a > $1) OR (a = $1 AND b > $2).
+func makeKeysetCondition(token string, keys []sortKey, addArg func(value interface{}) string) (condition string, err error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", ErrInvalidCursor
+	}
+
+	after := &cursor{}
+	err = json.Unmarshal(raw, after)
+	if err != nil || after.Sort != sortSignature(keys) || len(after.Keys) != len(keys) {
+		return "", ErrInvalidCursor
+	}
+
+	placeholders := make([]string, len(keys))
+	for i, key := range keys {
+		placeholders[i] = addArg(after.Keys[i]) + "::" + key.sqlType
+	}
+
+	alternatives := make([]string, len(keys))
+	for i, key := range keys {
+		terms := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			terms = append(terms, keys[j].expression+" = "+placeholders[j])
+		}
+
+		operator := " > "
+		if key.descending {
+			operator = " < "
+		}
+		terms = append(terms, key.expression+operator+placeholders[i])
+
+		alternatives[i] = "(" + strings.Join(terms, " AND ") + ")"
+	}
+
+	condition = "(" + strings.Join(alternatives, " OR ") + ")"
+	return
+}
+
+// sortSignature names the keys of a listing order, such as
+// "rank,title,id"
+func sortSignature(keys []sortKey) string {
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = key.name
+		if key.descending {
+			names[i] = "-" + names[i]
+		}
+	}
+	return strings.Join(names, ",")
+}
@@ -1,17 +1,110 @@
--- enum_user_role
-INSERT INTO enum_user_role
+-- user_role
+INSERT INTO user_role(code, role_name, role_description, built_in)
 VALUES
-    (1, 'member'),
-    (2, 'librarian');
+    (1, 'member', 'Borrows books and places holds', true),
+    (2, 'librarian', 'Has every permission', true),
+    (3, 'circulation desk', 'Lends books and takes payments', false),
+    (4, 'cataloguer', 'Maintains the catalogue', false),
+    (5, 'auditor', 'Reads everything, changes nothing', false);
+
+-- permission
+INSERT INTO permission
+VALUES
+    ('book:read', 'Browse and search the catalogue'),
+    ('book:inspect', 'See the items, loans and borrowers of books'),
+    ('book:create', 'Create books and import them from MARC and CSV files'),
+    ('book:update', 'Update books'),
+    ('book:delete', 'Delete books'),
+    ('book:export', 'Export books to MARC and CSV files'),
+    ('item:read', 'See items'),
+    ('item:manage', 'Create, update and delete items'),
+    ('loan:self', 'Borrow, return and renew books for oneself'),
+    ('hold:self', 'Place, see and cancel holds for oneself'),
+    ('loan:read', 'See the active loan of an item'),
+    ('loan:manage', 'Check items out to members and back in'),
+    ('loan:override', 'Check items out to members whose fines exceed the limit'),
+    ('ledger:read', 'See member accounts'),
+    ('ledger:manage', 'Record payments and waive charges'),
+    ('user:read', 'See users and registrations'),
+    ('user:manage', 'Create, update, approve, suspend and deactivate users'),
+    ('role:manage', 'Manage roles and change the role of users');
+
+-- role_permission
+INSERT INTO role_permission
+VALUES
+    (1, 'book:read'),
+    (1, 'loan:self'),
+    (1, 'hold:self'),
+    (3, 'book:read'),
+    (3, 'book:inspect'),
+    (3, 'item:read'),
+    (3, 'loan:read'),
+    (3, 'loan:manage'),
+    (3, 'ledger:read'),
+    (3, 'ledger:manage'),
+    (3, 'user:read'),
+    (4, 'book:read'),
+    (4, 'book:inspect'),
+    (4, 'book:create'),
+    (4, 'book:update'),
+    (4, 'book:delete'),
+    (4, 'book:export'),
+    (4, 'item:read'),
+    (4, 'item:manage'),
+    (5, 'book:read'),
+    (5, 'book:inspect'),
+    (5, 'book:export'),
+    (5, 'item:read'),
+    (5, 'loan:read'),
+    (5, 'ledger:read'),
+    (5, 'user:read');
+
+INSERT INTO role_permission
+SELECT 2, permission FROM permission;
+
+-- enum_user_status
+INSERT INTO enum_user_status
+VALUES
+    (1, 'pending'),
+    (2, 'active'),
+    (3, 'rejected'),
+    (4, 'suspended'),
+    (5, 'deactivated');
 
 -- enum_book_status
 INSERT INTO enum_book_status
 VALUES 
-    (1, 'available')
-    (2, 'borrowed')
+    (1, 'available'),
+    (2, 'borrowed'),
+    (3, 'on hold shelf');
+
+-- enum_item_condition
+INSERT INTO enum_item_condition
+VALUES
+    (1, 'new'),
+    (2, 'good'),
+    (3, 'fair'),
+    (4, 'poor'),
+    (5, 'damaged');
+
+-- enum_hold_status
+INSERT INTO enum_hold_status
+VALUES
+    (1, 'waiting'),
+    (2, 'ready'),
+    (3, 'fulfilled'),
+    (4, 'cancelled'),
+    (5, 'expired');
+
+-- enum_ledger_entry_type
+INSERT INTO enum_ledger_entry_type
+VALUES
+    (1, 'fine'),
+    (2, 'payment'),
+    (3, 'waiver');
 
 -- library_user
 INSERT INTO library_user(username, user_password, full_name, user_role)
 VALUES
-    ('joe', crypt('joe', gen_salt('bf')), 'Average Joe', 1)
+    ('joe', crypt('joe', gen_salt('bf')), 'Average Joe', 1),
     ('smith', crypt('smith', gen_salt('bf')), 'John Smith', 2);
\ No newline at end of file
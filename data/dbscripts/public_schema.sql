@@ -24,13 +24,46 @@ BEGIN
 END;
 $$;
 
--- enum_user_role
-CREATE TABLE enum_user_role (
-	code integer NOT NULL,
-	user_role text NOT NULL,
-	CONSTRAINT enum_user_status_pk PRIMARY KEY (code)
+-- user_role
+-- a role is a named set of permissions; built-in roles cannot be
+-- deleted. Codes below 100 are reserved for the seeded roles
+CREATE TABLE user_role (
+	code integer GENERATED BY DEFAULT AS IDENTITY (START WITH 100),
+	role_name text NOT NULL UNIQUE,
+	role_description text NOT NULL DEFAULT '',
+	built_in boolean NOT NULL DEFAULT false,
+	CONSTRAINT user_role_pk PRIMARY KEY (code)
+);
+
+-- permission
+CREATE TABLE permission (
+	permission text NOT NULL,
+	permission_description text NOT NULL,
+	CONSTRAINT permission_pk PRIMARY KEY (permission)
+);
+
+-- role_permission
+CREATE TABLE role_permission (
+	role_code integer NOT NULL,
+	permission text NOT NULL,
+	CONSTRAINT role_permission_pk PRIMARY KEY (role_code, permission),
+	CONSTRAINT fk_role_permission_role_code FOREIGN KEY (role_code)
+		REFERENCES user_role (code) MATCH SIMPLE
+		ON UPDATE NO ACTION
+		ON DELETE CASCADE,
+	CONSTRAINT fk_role_permission_permission FOREIGN KEY (permission)
+		REFERENCES permission (permission) MATCH SIMPLE
+		ON UPDATE NO ACTION
+		ON DELETE CASCADE
 );
 	
+-- enum_user_status
+CREATE TABLE enum_user_status (
+	code integer NOT NULL,
+	user_status text NOT NULL,
+	CONSTRAINT enum_user_status_code_pk PRIMARY KEY (code)
+);
+
 -- enum_book_status
 CREATE TABLE enum_book_status (
 	code integer NOT NULL,
@@ -38,21 +71,196 @@ CREATE TABLE enum_book_status (
 	CONSTRAINT enum_book_status_pk PRIMARY KEY (code)
 );
 
+-- enum_item_condition
+CREATE TABLE enum_item_condition (
+	code integer NOT NULL,
+	item_condition text NOT NULL,
+	CONSTRAINT enum_item_condition_pk PRIMARY KEY (code)
+);
+
+-- enum_hold_status
+CREATE TABLE enum_hold_status (
+	code integer NOT NULL,
+	hold_status text NOT NULL,
+	CONSTRAINT enum_hold_status_pk PRIMARY KEY (code)
+);
+
+-- enum_ledger_entry_type
+CREATE TABLE enum_ledger_entry_type (
+	code integer NOT NULL,
+	entry_type text NOT NULL,
+	CONSTRAINT enum_ledger_entry_type_pk PRIMARY KEY (code)
+);
+
 -- library_user
+-- auth_source is the authenticator that checks the password of the
+-- user; only "database" users log in with user_password
 CREATE TABLE library_user (
 	user_id uuid NOT NULL DEFAULT uuid_generate_v1mc(),
 	username text NOT NULL UNIQUE,
 	user_password text NOT NULL,
 	full_name text NOT NULL,
+	email text,
+	phone text,
 	user_role integer DEFAULT 1,
-	token uuid NOT NULL DEFAULT uuid_generate_v1mc(),
+	user_status integer NOT NULL DEFAULT 2,
+	auth_source text NOT NULL DEFAULT 'database',
+	created_at timestamp with time zone NOT NULL DEFAULT now(),
+	updated_at timestamp with time zone NOT NULL DEFAULT now(),
 	CONSTRAINT library_user_pk PRIMARY KEY (user_id),
 	CONSTRAINT fk_library_user_user_role FOREIGN KEY (user_role)
-		REFERENCES enum_user_role (code) MATCH SIMPLE
+		REFERENCES user_role (code) MATCH SIMPLE
+		ON UPDATE NO ACTION
+		ON DELETE NO ACTION,
+	CONSTRAINT fk_library_user_user_status FOREIGN KEY (user_status)
+		REFERENCES enum_user_status (code) MATCH SIMPLE
 		ON UPDATE NO ACTION
 		ON DELETE NO ACTION
 );
 
+CREATE INDEX library_user_user_status
+ON library_user (user_status);
+
+CREATE INDEX library_user_user_role
+ON library_user (user_role);
+
+CREATE TRIGGER update_library_user_updated_at_column
+	BEFORE UPDATE
+	ON library_user
+	FOR EACH ROW
+	EXECUTE PROCEDURE update_updated_at_column();
+
+-- session
+-- a bearer token issued at login; expires_at slides forward while the
+-- session is used, up to a maximum lifetime from created_at
+CREATE TABLE session (
+	session_id uuid NOT NULL DEFAULT uuid_generate_v1mc(),
+	user_id uuid NOT NULL,
+	token uuid NOT NULL UNIQUE DEFAULT gen_random_uuid(),
+	created_at timestamp with time zone NOT NULL DEFAULT now(),
+	last_used_at timestamp with time zone NOT NULL DEFAULT now(),
+	expires_at timestamp with time zone NOT NULL,
+	CONSTRAINT session_pk PRIMARY KEY (session_id),
+	CONSTRAINT fk_session_user_id FOREIGN KEY (user_id)
+		REFERENCES library_user (user_id) MATCH SIMPLE
+		ON UPDATE NO ACTION
+		ON DELETE CASCADE
+);
+
+CREATE INDEX session_user_id
+ON session (user_id);
+
+CREATE INDEX session_expires_at
+ON session (expires_at);
+
+-- password_reset
+-- a single-use token that lets a user set a new password; only the
+-- SHA-256 hash of the token is stored
+CREATE TABLE password_reset (
+	password_reset_id uuid NOT NULL DEFAULT uuid_generate_v1mc(),
+	user_id uuid NOT NULL,
+	token_hash text NOT NULL UNIQUE,
+	created_at timestamp with time zone NOT NULL DEFAULT now(),
+	expires_at timestamp with time zone NOT NULL,
+	used_at timestamp with time zone,
+	CONSTRAINT password_reset_pk PRIMARY KEY (password_reset_id),
+	CONSTRAINT fk_password_reset_user_id FOREIGN KEY (user_id)
+		REFERENCES library_user (user_id) MATCH SIMPLE
+		ON UPDATE NO ACTION
+		ON DELETE CASCADE
+);
+
+CREATE INDEX password_reset_user_id
+ON password_reset (user_id);
+
+-- login_failure
+-- failed logins per subject, which is a username ("user:<name>") or a
+-- client IP address ("ip:<address>"); logins for the subject are
+-- refused until blocked_until
+CREATE TABLE login_failure (
+	subject text NOT NULL,
+	failure_count integer NOT NULL DEFAULT 1,
+	last_failure_at timestamp with time zone NOT NULL DEFAULT now(),
+	blocked_until timestamp with time zone NOT NULL DEFAULT now(),
+	CONSTRAINT login_failure_pk PRIMARY KEY (subject)
+);
+
+-- user_identity
+-- links the subject of an OpenID Connect issuer to a user
+CREATE TABLE user_identity (
+	issuer text NOT NULL,
+	subject text NOT NULL,
+	user_id uuid NOT NULL,
+	created_at timestamp with time zone NOT NULL DEFAULT now(),
+	last_login_at timestamp with time zone NOT NULL DEFAULT now(),
+	CONSTRAINT user_identity_pk PRIMARY KEY (issuer, subject),
+	CONSTRAINT fk_user_identity_user_id FOREIGN KEY (user_id)
+		REFERENCES library_user (user_id) MATCH SIMPLE
+		ON UPDATE NO ACTION
+		ON DELETE CASCADE
+);
+
+CREATE INDEX user_identity_user_id
+ON user_identity (user_id);
+
+-- oidc_login
+-- an OpenID Connect sign-in in progress; the PKCE code verifier and
+-- nonce wait here for the callback with the state, of which only the
+-- SHA-256 hash is stored
+CREATE TABLE oidc_login (
+	state_hash text NOT NULL,
+	code_verifier text NOT NULL,
+	nonce text NOT NULL,
+	created_at timestamp with time zone NOT NULL DEFAULT now(),
+	expires_at timestamp with time zone NOT NULL,
+	CONSTRAINT oidc_login_pk PRIMARY KEY (state_hash)
+);
+
+CREATE INDEX oidc_login_expires_at
+ON oidc_login (expires_at);
+
+-- api_key
+-- a long-lived key for scripts and integrations; only the SHA-256 hash
+-- of the key is stored, key_prefix identifies it in listings. A scoped
+-- key only has the permissions in api_key_scope
+CREATE TABLE api_key (
+	api_key_id uuid NOT NULL DEFAULT uuid_generate_v1mc(),
+	user_id uuid NOT NULL,
+	key_name text NOT NULL,
+	key_prefix text NOT NULL,
+	key_hash text NOT NULL UNIQUE,
+	scoped boolean NOT NULL DEFAULT false,
+	created_at timestamp with time zone NOT NULL DEFAULT now(),
+	expires_at timestamp with time zone,
+	last_used_at timestamp with time zone,
+	revoked_at timestamp with time zone,
+	CONSTRAINT api_key_pk PRIMARY KEY (api_key_id),
+	CONSTRAINT fk_api_key_user_id FOREIGN KEY (user_id)
+		REFERENCES library_user (user_id) MATCH SIMPLE
+		ON UPDATE NO ACTION
+		ON DELETE CASCADE
+);
+
+CREATE INDEX api_key_user_id
+ON api_key (user_id);
+
+-- api_key_scope
+-- the permissions a scoped API key is limited to, within those of the
+-- role of its user
+CREATE TABLE api_key_scope (
+	api_key_id uuid NOT NULL,
+	permission text NOT NULL,
+	CONSTRAINT api_key_scope_pk PRIMARY KEY (api_key_id, permission),
+	CONSTRAINT fk_api_key_scope_api_key_id FOREIGN KEY (api_key_id)
+		REFERENCES api_key (api_key_id) MATCH SIMPLE
+		ON UPDATE NO ACTION
+		ON DELETE CASCADE,
+	CONSTRAINT fk_api_key_scope_permission FOREIGN KEY (permission)
+		REFERENCES permission (permission) MATCH SIMPLE
+		ON UPDATE NO ACTION
+		ON DELETE CASCADE
+);
+
 -- book
 
 CREATE TABLE book (
@@ -61,26 +269,188 @@ CREATE TABLE book (
 	author_name text NOT NULL,
 	publisher text NOT NULL,
 	book_description text,
-	book_status integer DEFAULT 1,
+	isbn_13 text,
+	isbn_10 text,
+	search_vector tsvector GENERATED ALWAYS AS (
+		setweight(to_tsvector('english', book_name), 'A') ||
+		setweight(to_tsvector('english', author_name), 'B') ||
+		setweight(to_tsvector('english', publisher), 'C') ||
+		setweight(to_tsvector('english', coalesce(book_description, '')), 'D')
+	) STORED,
 	created_at timestamp with time zone NOT NULL DEFAULT now(),
 	updated_at timestamp with time zone NOT NULL DEFAULT now(),
-	borrower_id uuid,
 	CONSTRAINT book_pk PRIMARY KEY (book_id),
-	CONSTRAINT fk_book_book_status FOREIGN KEY (book_status)
+	CONSTRAINT book_isbn_13_key UNIQUE (isbn_13)
+);
+
+CREATE INDEX book_search_vector
+ON book USING gin (search_vector);
+
+CREATE TRIGGER update_book_updated_at_column
+	BEFORE UPDATE
+	ON book
+	FOR EACH ROW
+	EXECUTE PROCEDURE update_updated_at_column();
+
+-- item (a physical copy of a book)
+CREATE TABLE item (
+	item_id uuid NOT NULL DEFAULT uuid_generate_v1mc(),
+	book_id uuid NOT NULL,
+	barcode text NOT NULL UNIQUE,
+	shelf_location text,
+	item_condition integer NOT NULL DEFAULT 2,
+	item_status integer NOT NULL DEFAULT 1,
+	created_at timestamp with time zone NOT NULL DEFAULT now(),
+	updated_at timestamp with time zone NOT NULL DEFAULT now(),
+	CONSTRAINT item_pk PRIMARY KEY (item_id),
+	CONSTRAINT fk_item_book_id FOREIGN KEY (book_id)
+		REFERENCES book (book_id) MATCH SIMPLE
+		ON UPDATE NO ACTION
+		ON DELETE CASCADE,
+	CONSTRAINT fk_item_item_condition FOREIGN KEY (item_condition)
+		REFERENCES enum_item_condition (code) MATCH SIMPLE
+		ON UPDATE NO ACTION
+		ON DELETE NO ACTION,
+	CONSTRAINT fk_item_item_status FOREIGN KEY (item_status)
 		REFERENCES enum_book_status (code) MATCH SIMPLE
 		ON UPDATE NO ACTION
+		ON DELETE NO ACTION
+);
+
+CREATE INDEX item_book_id
+ON item (book_id);
+
+CREATE INDEX item_item_status
+ON item (item_status);
+
+CREATE TRIGGER update_item_updated_at_column
+	BEFORE UPDATE
+	ON item
+	FOR EACH ROW
+	EXECUTE PROCEDURE update_updated_at_column();
+
+-- loan
+-- loans are the circulation history of an item, so an item that
+-- has been on loan cannot be deleted. earlier_fines is what was
+-- charged against the due dates the loan had before it was renewed
+CREATE TABLE loan (
+	loan_id uuid NOT NULL DEFAULT uuid_generate_v1mc(),
+	item_id uuid NOT NULL,
+	borrower_id uuid NOT NULL,
+	checked_out_at timestamp with time zone NOT NULL DEFAULT now(),
+	checked_out_by uuid NOT NULL,
+	due_at timestamp with time zone NOT NULL,
+	renewal_count integer NOT NULL DEFAULT 0,
+	earlier_fines bigint NOT NULL DEFAULT 0,
+	returned_at timestamp with time zone,
+	returned_by uuid,
+	CONSTRAINT loan_pk PRIMARY KEY (loan_id),
+	CONSTRAINT fk_loan_item_id FOREIGN KEY (item_id)
+		REFERENCES item (item_id) MATCH SIMPLE
+		ON UPDATE NO ACTION
+		ON DELETE RESTRICT,
+	CONSTRAINT fk_loan_borrower_id FOREIGN KEY (borrower_id)
+		REFERENCES library_user (user_id) MATCH SIMPLE
+		ON UPDATE NO ACTION
+		ON DELETE NO ACTION,
+	CONSTRAINT fk_loan_checked_out_by FOREIGN KEY (checked_out_by)
+		REFERENCES library_user (user_id) MATCH SIMPLE
+		ON UPDATE NO ACTION
 		ON DELETE NO ACTION,
-	CONSTRAINT fk_book_borrower_id FOREIGN KEY (borrower_id)
+	CONSTRAINT fk_loan_returned_by FOREIGN KEY (returned_by)
 		REFERENCES library_user (user_id) MATCH SIMPLE
 		ON UPDATE NO ACTION
 		ON DELETE NO ACTION
 );
 
-CREATE INDEX book_book_status
-ON book (book_status);
+-- an item can only be on one active loan at a time
+CREATE UNIQUE INDEX loan_active_item
+ON loan (item_id)
+WHERE returned_at IS NULL;
 
-CREATE TRIGGER update_book_updated_at_column
+CREATE INDEX loan_borrower_id
+ON loan (borrower_id);
+
+-- hold
+-- holds are placed on a book; item_id is the copy reserved for the
+-- hold once it is on the hold shelf
+CREATE TABLE hold (
+	hold_id uuid NOT NULL DEFAULT uuid_generate_v1mc(),
+	book_id uuid NOT NULL,
+	user_id uuid NOT NULL,
+	item_id uuid,
+	hold_status integer NOT NULL DEFAULT 1,
+	placed_at timestamp with time zone NOT NULL DEFAULT now(),
+	ready_at timestamp with time zone,
+	expires_at timestamp with time zone,
+	updated_at timestamp with time zone NOT NULL DEFAULT now(),
+	CONSTRAINT hold_pk PRIMARY KEY (hold_id),
+	CONSTRAINT fk_hold_book_id FOREIGN KEY (book_id)
+		REFERENCES book (book_id) MATCH SIMPLE
+		ON UPDATE NO ACTION
+		ON DELETE CASCADE,
+	CONSTRAINT fk_hold_item_id FOREIGN KEY (item_id)
+		REFERENCES item (item_id) MATCH SIMPLE
+		ON UPDATE NO ACTION
+		ON DELETE SET NULL,
+	CONSTRAINT fk_hold_user_id FOREIGN KEY (user_id)
+		REFERENCES library_user (user_id) MATCH SIMPLE
+		ON UPDATE NO ACTION
+		ON DELETE NO ACTION,
+	CONSTRAINT fk_hold_hold_status FOREIGN KEY (hold_status)
+		REFERENCES enum_hold_status (code) MATCH SIMPLE
+		ON UPDATE NO ACTION
+		ON DELETE NO ACTION
+);
+
+-- a member can only be queued once per book
+CREATE UNIQUE INDEX hold_open_book_user
+ON hold (book_id, user_id)
+WHERE hold_status IN (1, 2);
+
+CREATE INDEX hold_queue
+ON hold (book_id, placed_at)
+WHERE hold_status = 1;
+
+CREATE TRIGGER update_hold_updated_at_column
 	BEFORE UPDATE
-	ON book
+	ON hold
 	FOR EACH ROW
-	EXECUTE PROCEDURE update_updated_at_column();
\ No newline at end of file
+	EXECUTE PROCEDURE update_updated_at_column();
+
+-- ledger_entry
+-- amounts are in minor currency units: charges are positive,
+-- payments and waivers are negative
+CREATE TABLE ledger_entry (
+	entry_id uuid NOT NULL DEFAULT uuid_generate_v1mc(),
+	user_id uuid NOT NULL,
+	loan_id uuid,
+	entry_type integer NOT NULL,
+	amount bigint NOT NULL,
+	note text,
+	created_by uuid,
+	created_at timestamp with time zone NOT NULL DEFAULT now(),
+	CONSTRAINT ledger_entry_pk PRIMARY KEY (entry_id),
+	CONSTRAINT fk_ledger_entry_user_id FOREIGN KEY (user_id)
+		REFERENCES library_user (user_id) MATCH SIMPLE
+		ON UPDATE NO ACTION
+		ON DELETE NO ACTION,
+	CONSTRAINT fk_ledger_entry_loan_id FOREIGN KEY (loan_id)
+		REFERENCES loan (loan_id) MATCH SIMPLE
+		ON UPDATE NO ACTION
+		ON DELETE SET NULL,
+	CONSTRAINT fk_ledger_entry_entry_type FOREIGN KEY (entry_type)
+		REFERENCES enum_ledger_entry_type (code) MATCH SIMPLE
+		ON UPDATE NO ACTION
+		ON DELETE NO ACTION,
+	CONSTRAINT fk_ledger_entry_created_by FOREIGN KEY (created_by)
+		REFERENCES library_user (user_id) MATCH SIMPLE
+		ON UPDATE NO ACTION
+		ON DELETE NO ACTION
+);
+
+CREATE INDEX ledger_entry_user_id
+ON ledger_entry (user_id);
+
+CREATE INDEX ledger_entry_loan_id
+ON ledger_entry (loan_id);
\ No newline at end of file
@@ -0,0 +1,124 @@
+package data
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rjseymour66/library-go/values"
+)
+
+// Facet names
+const (
+	FacetAuthor    = "author"
+	FacetPublisher = "publisher"
+	FacetStatus    = "status"
+	FacetBorrower  = "borrower"
+)
+
+// MaxFacetValues is the number of values returned per facet, the ones
+// with the most books first
+const MaxFacetValues = 20
+
+// FacetValue is the number of books of a listing that share a value.
+// Value is what the facet filter takes, Label is what to display.
+type FacetValue struct {
+	Value string
+	Label string
+	Count int64
+}
+
+// facetQueries select the value, label and book count of every facet
+// from the books of the listing, aliased as b
+var facetQueries = map[string]string{
+	FacetAuthor: `
+		SELECT
+			b.author_name as "Value",
+			b.author_name as "Label",
+			count(*) as "Count"
+		FROM book b
+		WHERE %v
+		GROUP BY b.author_name`,
+	FacetPublisher: `
+		SELECT
+			b.publisher as "Value",
+			b.publisher as "Label",
+			count(*) as "Count"
+		FROM book b
+		WHERE %v
+		GROUP BY b.publisher`,
+	FacetStatus: `
+		SELECT
+			e.code::text as "Value",
+			e.book_status as "Label",
+			count(DISTINCT b.book_id) as "Count"
+		FROM book b
+		JOIN item i on i.book_id = b.book_id
+		JOIN enum_book_status e on e.code = i.item_status
+		WHERE %v
+		GROUP BY e.code`,
+	FacetBorrower: `
+		SELECT
+			u.user_id::text as "Value",
+			u.full_name as "Label",
+			count(DISTINCT b.book_id) as "Count"
+		FROM book b
+		JOIN item i on i.book_id = b.book_id
+		JOIN loan l on l.item_id = i.item_id AND l.returned_at IS NULL
+		JOIN library_user u on u.user_id = l.borrower_id
+		WHERE %v
+		GROUP BY u.user_id`,
+}
+
+var (
+	// GetBookFacets returns the values of the facet for the books
+	// that match the search
+	GetBookFacets = getBookFacets
+)
+
+func getBookFacets(ctx context.Context, search *BookSearch, facet string) (response []*FacetValue, err error) {
+	facetQuery, ok := facetQueries[facet]
+	if !ok {
+		err = fmt.Errorf("unknown facet %q", facet)
+		return
+	}
+
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+
+	// Facets count the whole listing, not just the page after the
+	// cursor
+	uncursored := *search
+	uncursored.Cursor = ""
+
+	searchQuery, err := makeBookSearchQuery(&uncursored, 2)
+	if err != nil {
+		return
+	}
+
+	query := fmt.Sprintf(facetQuery, searchQuery.condition) + `
+		ORDER BY "Count" DESC, "Label"
+		LIMIT $1`
+
+	args := append([]interface{}{MaxFacetValues}, searchQuery.args...)
+
+	rows, err := dbRunner.Query(ctx, query, args...)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	rr, err := dbserver.GetRowReader(rows)
+	if err != nil {
+		return
+	}
+
+	response = make([]*FacetValue, 0)
+	for rr.ScanNext() {
+		value := &FacetValue{}
+		rr.ReadAllToStruct(value)
+		response = append(response, value)
+	}
+
+	err = rr.Error()
+	return
+}
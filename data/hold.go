@@ -0,0 +1,256 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/rjseymour66/library-go/values"
+)
+
+type HoldEntity struct {
+	HoldID    string
+	BookID    string
+	UserID    string
+	ItemID    string `json:",omitempty"`
+	Status    int64
+	PlacedAt  time.Time
+	ExpiresAt *time.Time `json:",omitempty"`
+}
+
+var (
+	// PlaceHold adds the user to the end of the hold queue for
+	// the book and returns the new hold
+	PlaceHold = placeHold
+
+	// GetOpenHold returns the waiting or ready hold the user has
+	// on the book. If there is none, returns nil
+	GetOpenHold = getOpenHold
+
+	// GetHoldQueuePosition returns the 1-based position of a
+	// waiting hold in its book's queue
+	GetHoldQueuePosition = getHoldQueuePosition
+
+	// GetNextHold returns the waiting hold at the front of the
+	// queue for the book. If the queue is empty, returns nil
+	GetNextHold = getNextHold
+
+	// GetReadyHold returns the hold the item is reserved for on
+	// the hold shelf. If there is none, returns nil
+	GetReadyHold = getReadyHold
+
+	// GetExpiredHolds returns the ready holds whose pickup window
+	// has passed
+	GetExpiredHolds = getExpiredHolds
+
+	// CountWaitingHolds returns the number of waiting holds for
+	// the book
+	CountWaitingHolds = countWaitingHolds
+
+	// CloseHold moves a waiting or ready hold to status and
+	// returns the number of rows affected
+	CloseHold = closeHold
+
+	// ReadyHold reserves the item for the hold until expiresAt
+	ReadyHold = readyHold
+)
+
+const holdColumns = `
+			hold_id,
+			book_id,
+			user_id,
+			coalesce(item_id::text, ''),
+			hold_status,
+			placed_at,
+			expires_at`
+
+func placeHold(ctx context.Context, bookID, userID string) (response *HoldEntity, err error) {
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+
+	query := `
+		INSERT INTO hold(book_id, user_id)
+		VALUES ($1, $2)
+		RETURNING hold_id, placed_at`
+
+	rows, err := dbRunner.Query(ctx, query, bookID, userID)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	rr, err := dbserver.GetRowReader(rows)
+	if err != nil {
+		return
+	}
+
+	if rr.ScanNext() {
+		response = &HoldEntity{}
+		response.HoldID = rr.ReadByIdxString(0)
+		response.BookID = bookID
+		response.UserID = userID
+		response.Status = values.HoldStatusWaiting
+		response.PlacedAt = rr.ReadByIdxTime(1)
+	}
+
+	err = rr.Error()
+
+	return
+}
+
+func getOpenHold(ctx context.Context, bookID, userID string) (response *HoldEntity, err error) {
+	query := `
+		SELECT` + holdColumns + `
+		FROM hold
+		WHERE
+			book_id = $1
+			and user_id = $2
+			and hold_status IN ($3, $4)`
+
+	return queryHold(ctx, query, bookID, userID, values.HoldStatusWaiting, values.HoldStatusReady)
+}
+
+func getHoldQueuePosition(ctx context.Context, holdID string) (response int64, err error) {
+	query := `
+		SELECT count(*)
+		FROM hold h
+		JOIN hold mine on mine.book_id = h.book_id
+		WHERE
+			mine.hold_id = $1
+			and h.hold_status = $2
+			and (h.placed_at, h.hold_id) <= (mine.placed_at, mine.hold_id)`
+
+	return executeQueryWithInt64Response(ctx, query, holdID, values.HoldStatusWaiting)
+}
+
+func getNextHold(ctx context.Context, bookID string) (response *HoldEntity, err error) {
+	query := `
+		SELECT` + holdColumns + `
+		FROM hold
+		WHERE book_id = $1 and hold_status = $2
+		ORDER BY placed_at, hold_id
+		LIMIT 1
+		FOR UPDATE`
+
+	return queryHold(ctx, query, bookID, values.HoldStatusWaiting)
+}
+
+func getReadyHold(ctx context.Context, itemID string) (response *HoldEntity, err error) {
+	query := `
+		SELECT` + holdColumns + `
+		FROM hold
+		WHERE item_id = $1 and hold_status = $2
+		FOR UPDATE`
+
+	return queryHold(ctx, query, itemID, values.HoldStatusReady)
+}
+
+func getExpiredHolds(ctx context.Context) (response []*HoldEntity, err error) {
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+
+	query := `
+		SELECT` + holdColumns + `
+		FROM hold
+		WHERE hold_status = $1 and expires_at < now()
+		FOR UPDATE SKIP LOCKED`
+
+	rows, err := dbRunner.Query(ctx, query, values.HoldStatusReady)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	rr, err := dbserver.GetRowReader(rows)
+	if err != nil {
+		return
+	}
+
+	response = make([]*HoldEntity, 0)
+	for rr.ScanNext() {
+		response = append(response, readHold(rr))
+	}
+
+	err = rr.Error()
+
+	return
+}
+
+func countWaitingHolds(ctx context.Context, bookID string) (response int64, err error) {
+	query := `SELECT count(*) FROM hold WHERE book_id = $1 and hold_status = $2`
+	return executeQueryWithInt64Response(ctx, query, bookID, values.HoldStatusWaiting)
+}
+
+func closeHold(ctx context.Context, holdID string, status int) (response int64, err error) {
+	query := `
+		UPDATE hold
+		SET hold_status = $1
+		WHERE hold_id = $2 and hold_status IN ($3, $4)`
+
+	return executeQueryWithRowsAffected(
+		ctx,
+		query,
+		status,
+		holdID,
+		values.HoldStatusWaiting,
+		values.HoldStatusReady)
+}
+
+func readyHold(ctx context.Context, holdID, itemID string, expiresAt time.Time) (err error) {
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+
+	query := `
+		UPDATE hold
+		SET
+			hold_status = $1,
+			item_id = $2,
+			ready_at = now(),
+			expires_at = $3
+		WHERE hold_id = $4`
+
+	_, err = dbRunner.Exec(ctx, query, values.HoldStatusReady, itemID, expiresAt, holdID)
+
+	return
+}
+
+func queryHold(ctx context.Context, query string, params ...interface{}) (response *HoldEntity, err error) {
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+
+	rows, err := dbRunner.Query(ctx, query, params...)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	rr, err := dbserver.GetRowReader(rows)
+	if err != nil {
+		return
+	}
+
+	if rr.ScanNext() {
+		response = readHold(rr)
+	}
+
+	err = rr.Error()
+
+	return
+}
+
+// readHold reads a row selected with holdColumns
+func readHold(rr dbserver.RowReader) (hold *HoldEntity) {
+	hold = &HoldEntity{}
+	hold.HoldID = rr.ReadByIdxString(0)
+	hold.BookID = rr.ReadByIdxString(1)
+	hold.UserID = rr.ReadByIdxString(2)
+	hold.ItemID = rr.ReadByIdxString(3)
+	hold.Status = rr.ReadByIdxInt64(4)
+	hold.PlacedAt = rr.ReadByIdxTime(5)
+
+	// expires_at is only meaningful while the book is on the hold shelf
+	if hold.Status == values.HoldStatusReady {
+		expiresAt := rr.ReadByIdxTime(6)
+		hold.ExpiresAt = &expiresAt
+	}
+
+	return
+}
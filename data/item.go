@@ -0,0 +1,294 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/rjseymour66/library-go/util"
+	"github.com/rjseymour66/library-go/values"
+)
+
+type ItemEntity struct {
+	ItemID        string
+	BookID        string
+	Barcode       string
+	ShelfLocation string `json:",omitempty"`
+	Condition     int64
+	Status        int64
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+type ItemInfoLibrarian struct {
+	ItemID        string
+	Barcode       string
+	ShelfLocation string `json:",omitempty"`
+	Condition     int64
+	Status        int64
+	Borrower      string `json:",omitempty"`
+}
+
+type ItemInfoMember struct {
+	ItemID        string
+	ShelfLocation string `json:",omitempty"`
+	Status        int64
+}
+
+var (
+	CreateItem           = createItem
+	GetItem              = getItem
+	GetItemForUpdate     = getItemForUpdate
+	GetItemIDByBarcode   = getItemIDByBarcode
+	GetItemsForMember    = getItemsForMember
+	GetItemsForLibrarian = getItemsForLibrarian
+	CountAvailableItems  = countAvailableItems
+	LockItemsOfBook      = lockItemsOfBook
+	UpdateItem           = updateItem
+	DeleteItem           = deleteItem
+	ChangeItemStatus     = changeItemStatus
+)
+
+const itemColumns = `
+			item_id,
+			book_id,
+			barcode,
+			coalesce(shelf_location, ''),
+			item_condition,
+			item_status,
+			created_at,
+			updated_at`
+
+func createItem(
+	ctx context.Context,
+	bookID,
+	barcode string,
+	shelfLocation util.NullString,
+	condition int) (response *ItemEntity, err error) {
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+
+	query := `
+		INSERT INTO item(
+			book_id, barcode, shelf_location, item_condition)
+		VALUES ($1, $2, $3, $4)
+		RETURNING item_id, created_at`
+
+	rows, err := dbRunner.Query(ctx, query, bookID, barcode, shelfLocation, condition)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	rr, err := dbserver.GetRowReader(rows)
+	if err != nil {
+		return
+	}
+
+	if rr.ScanNext() {
+		response = &ItemEntity{}
+		response.ItemID = rr.ReadByIdxString(0)
+		response.BookID = bookID
+		response.Barcode = barcode
+		response.ShelfLocation = util.GetNullStringValue(shelfLocation)
+		response.Condition = int64(condition)
+		response.Status = values.BookStatusAvailable
+		response.CreatedAt = rr.ReadByIdxTime(1)
+		response.UpdatedAt = rr.ReadByIdxTime(1)
+	}
+
+	err = rr.Error()
+
+	return
+}
+
+func getItem(ctx context.Context, itemID string) (response *ItemEntity, err error) {
+	query := `
+		SELECT` + itemColumns + `
+		FROM item
+		WHERE item_id = $1`
+
+	return queryItem(ctx, query, itemID)
+}
+
+// getItemForUpdate locks the item row until the end of the
+// transaction so that concurrent circulation requests are serialized.
+func getItemForUpdate(ctx context.Context, itemID string) (response *ItemEntity, err error) {
+	query := `
+		SELECT` + itemColumns + `
+		FROM item
+		WHERE item_id = $1
+		FOR UPDATE`
+
+	return queryItem(ctx, query, itemID)
+}
+
+func getItemIDByBarcode(ctx context.Context, barcode string) (response string, err error) {
+	query := `SELECT item_id FROM item WHERE barcode = $1`
+	return executeQueryWithStringResponse(ctx, query, barcode)
+}
+
+func getItemsForMember(ctx context.Context, bookID string) (response []*ItemInfoMember, err error) {
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+
+	query := `
+		SELECT
+			item_id as "ItemID",
+			shelf_location as "ShelfLocation",
+			item_status as "Status"
+		FROM item
+		WHERE book_id = $1
+		ORDER BY barcode`
+
+	rows, err := dbRunner.Query(ctx, query, bookID)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	rr, err := dbserver.GetRowReader(rows)
+	if err != nil {
+		return
+	}
+
+	response = make([]*ItemInfoMember, 0)
+	for rr.ScanNext() {
+		item := &ItemInfoMember{}
+		rr.ReadAllToStruct(item)
+		response = append(response, item)
+	}
+
+	err = rr.Error()
+
+	return
+}
+
+func getItemsForLibrarian(ctx context.Context, bookID string) (response []*ItemInfoLibrarian, err error) {
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+
+	query := `
+		SELECT
+			i.item_id as "ItemID",
+			i.barcode as "Barcode",
+			i.shelf_location as "ShelfLocation",
+			i.item_condition as "Condition",
+			i.item_status as "Status",
+			u.full_name as "Borrower"
+		FROM item i
+		LEFT JOIN loan l on l.item_id = i.item_id and l.returned_at IS NULL
+		LEFT JOIN library_user u on u.user_id = l.borrower_id
+		WHERE i.book_id = $1
+		ORDER BY i.barcode`
+
+	rows, err := dbRunner.Query(ctx, query, bookID)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	rr, err := dbserver.GetRowReader(rows)
+	if err != nil {
+		return
+	}
+
+	response = make([]*ItemInfoLibrarian, 0)
+	for rr.ScanNext() {
+		item := &ItemInfoLibrarian{}
+		rr.ReadAllToStruct(item)
+		response = append(response, item)
+	}
+
+	err = rr.Error()
+
+	return
+}
+
+func countAvailableItems(ctx context.Context, bookID string) (response int64, err error) {
+	query := `SELECT count(*) FROM item WHERE book_id = $1 and item_status = $2`
+	return executeQueryWithInt64Response(ctx, query, bookID, values.BookStatusAvailable)
+}
+
+// lockItemsOfBook locks the items of the book until the end of the
+// transaction and returns how many of them are on loan or reserved.
+func lockItemsOfBook(ctx context.Context, bookID string) (unavailable int64, err error) {
+	query := `
+		SELECT count(*) FILTER (WHERE item_status <> $2)
+		FROM (
+			SELECT item_status
+			FROM item
+			WHERE book_id = $1
+			FOR UPDATE
+		) i`
+
+	return executeQueryWithInt64Response(ctx, query, bookID, values.BookStatusAvailable)
+}
+
+func updateItem(
+	ctx context.Context,
+	itemID,
+	barcode string,
+	shelfLocation util.NullString,
+	condition int) (response time.Time, err error) {
+	query := `
+		UPDATE item
+		SET
+			barcode = $1,
+			shelf_location = $2,
+			item_condition = $3
+		WHERE item_id = $4
+		RETURNING updated_at`
+
+	return executeQueryWithTimeResponse(ctx, query, barcode, shelfLocation, condition, itemID)
+}
+
+func deleteItem(ctx context.Context, itemID string) (response int64, err error) {
+	query := `DELETE FROM item WHERE item_id = $1`
+	return executeQueryWithRowsAffected(ctx, query, itemID)
+}
+
+func changeItemStatus(ctx context.Context, itemID string, status int) (err error) {
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+
+	query := `
+		UPDATE item
+		SET
+			item_status = $1
+		WHERE item_id = $2`
+
+	_, err = dbRunner.Exec(ctx, query, status, itemID)
+
+	return
+}
+
+func queryItem(ctx context.Context, query string, params ...interface{}) (response *ItemEntity, err error) {
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+
+	rows, err := dbRunner.Query(ctx, query, params...)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	rr, err := dbserver.GetRowReader(rows)
+	if err != nil {
+		return
+	}
+
+	if rr.ScanNext() {
+		response = &ItemEntity{}
+		response.ItemID = rr.ReadByIdxString(0)
+		response.BookID = rr.ReadByIdxString(1)
+		response.Barcode = rr.ReadByIdxString(2)
+		response.ShelfLocation = rr.ReadByIdxString(3)
+		response.Condition = rr.ReadByIdxInt64(4)
+		response.Status = rr.ReadByIdxInt64(5)
+		response.CreatedAt = rr.ReadByIdxTime(6)
+		response.UpdatedAt = rr.ReadByIdxTime(7)
+	}
+
+	err = rr.Error()
+
+	return
+}
@@ -0,0 +1,146 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/rjseymour66/library-go/util"
+	"github.com/rjseymour66/library-go/values"
+)
+
+type LedgerEntryEntity struct {
+	EntryID   string
+	UserID    string
+	LoanID    string `json:",omitempty"`
+	EntryType int64
+	Amount    int64
+	Note      string `json:",omitempty"`
+	CreatedBy string `json:",omitempty"`
+	CreatedAt time.Time
+}
+
+var (
+	// AddLedgerEntry records a charge (positive amount) or a
+	// credit (negative amount) on the user's account
+	AddLedgerEntry = addLedgerEntry
+
+	// GetLedgerEntries returns the user's ledger entries, newest
+	// first
+	GetLedgerEntries = getLedgerEntries
+
+	// GetUserBalance returns the sum of the user's ledger entries
+	GetUserBalance = getUserBalance
+
+	// GetLoanFineTotal returns the sum of the fines charged for
+	// the loan
+	GetLoanFineTotal = getLoanFineTotal
+)
+
+func addLedgerEntry(
+	ctx context.Context,
+	userID string,
+	loanID util.NullString,
+	entryType int,
+	amount int64,
+	note util.NullString,
+	createdBy util.NullString) (response *LedgerEntryEntity, err error) {
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+
+	query := `
+		INSERT INTO ledger_entry(
+			user_id, loan_id, entry_type, amount, note, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING entry_id, created_at`
+
+	rows, err := dbRunner.Query(ctx, query, userID, loanID, entryType, amount, note, createdBy)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	rr, err := dbserver.GetRowReader(rows)
+	if err != nil {
+		return
+	}
+
+	if rr.ScanNext() {
+		response = &LedgerEntryEntity{}
+		response.EntryID = rr.ReadByIdxString(0)
+		response.UserID = userID
+		response.LoanID = util.GetNullStringValue(loanID)
+		response.EntryType = int64(entryType)
+		response.Amount = amount
+		response.Note = util.GetNullStringValue(note)
+		response.CreatedBy = util.GetNullStringValue(createdBy)
+		response.CreatedAt = rr.ReadByIdxTime(1)
+	}
+
+	err = rr.Error()
+
+	return
+}
+
+func getLedgerEntries(ctx context.Context, userID string, rowOffset, rowLimit int) (response []*LedgerEntryEntity, err error) {
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+
+	query := `
+		SELECT
+			entry_id,
+			user_id,
+			coalesce(loan_id::text, ''),
+			entry_type,
+			amount,
+			coalesce(note, ''),
+			coalesce(created_by::text, ''),
+			created_at
+		FROM ledger_entry
+		WHERE user_id = $1
+		ORDER BY created_at DESC, entry_id
+		OFFSET $2
+		LIMIT $3`
+
+	rows, err := dbRunner.Query(ctx, query, userID, rowOffset, rowLimit)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	rr, err := dbserver.GetRowReader(rows)
+	if err != nil {
+		return
+	}
+
+	response = make([]*LedgerEntryEntity, 0)
+	for rr.ScanNext() {
+		entry := &LedgerEntryEntity{}
+		entry.EntryID = rr.ReadByIdxString(0)
+		entry.UserID = rr.ReadByIdxString(1)
+		entry.LoanID = rr.ReadByIdxString(2)
+		entry.EntryType = rr.ReadByIdxInt64(3)
+		entry.Amount = rr.ReadByIdxInt64(4)
+		entry.Note = rr.ReadByIdxString(5)
+		entry.CreatedBy = rr.ReadByIdxString(6)
+		entry.CreatedAt = rr.ReadByIdxTime(7)
+		response = append(response, entry)
+	}
+
+	err = rr.Error()
+
+	return
+}
+
+func getUserBalance(ctx context.Context, userID string) (response int64, err error) {
+	query := `SELECT coalesce(sum(amount), 0) FROM ledger_entry WHERE user_id = $1`
+	return executeQueryWithInt64Response(ctx, query, userID)
+}
+
+func getLoanFineTotal(ctx context.Context, loanID string) (response int64, err error) {
+	query := `
+		SELECT coalesce(sum(amount), 0)
+		FROM ledger_entry
+		WHERE loan_id = $1 and entry_type = $2`
+
+	return executeQueryWithInt64Response(ctx, query, loanID, values.LedgerEntryTypeFine)
+}
@@ -0,0 +1,277 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/rjseymour66/library-go/values"
+)
+
+type LoanEntity struct {
+	LoanID       string
+	ItemID       string
+	BorrowerID   string
+	CheckedOutBy string
+	CheckedOutAt time.Time
+	DueAt        time.Time
+	RenewalCount int64
+
+	// EarlierFines is what was charged against the due dates the
+	// loan had before it was last renewed
+	EarlierFines int64 `json:"-"`
+}
+
+var (
+	// CheckoutItem creates an active loan for the item and
+	// returns it
+	CheckoutItem = checkoutItem
+
+	// CheckinItem closes the active loan and returns the time
+	// the item was returned. If the loan is not active, returns
+	// zero time
+	CheckinItem = checkinItem
+
+	// GetActiveLoan returns the active loan for the item. If the
+	// item is not on loan, returns nil
+	GetActiveLoan = getActiveLoan
+
+	// GetLoanForUpdate locks the loan row until the end of the
+	// transaction and returns the loan. If there is none, returns
+	// nil
+	GetLoanForUpdate = getLoanForUpdate
+
+	// RenewLoan moves the due date of the active loan, keeps the
+	// fines charged so far as its earlier fines and returns the new
+	// renewal count. If the loan is not active or has reached
+	// maxRenewals, returns 0
+	RenewLoan = renewLoan
+
+	// GetOverdueLoans locks and returns the active loans that were
+	// due before dueBefore
+	GetOverdueLoans = getOverdueLoans
+
+	// HasActiveLoanForBook returns whether the user has any copy
+	// of the book on loan
+	HasActiveLoanForBook = hasActiveLoanForBook
+
+	// HasLoanHistory returns whether any copy of the book, or
+	// the item if itemID is not empty, has ever been on loan
+	HasLoanHistory = hasLoanHistory
+)
+
+const loanColumns = `
+			loan_id,
+			item_id,
+			borrower_id,
+			checked_out_by,
+			checked_out_at,
+			due_at,
+			renewal_count,
+			earlier_fines`
+
+func checkoutItem(
+	ctx context.Context,
+	itemID,
+	borrowerID,
+	checkedOutBy string,
+	dueAt time.Time) (response *LoanEntity, err error) {
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+
+	query := `
+		INSERT INTO loan(
+			item_id, borrower_id, checked_out_by, due_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING loan_id, checked_out_at`
+
+	rows, err := dbRunner.Query(ctx, query, itemID, borrowerID, checkedOutBy, dueAt)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	rr, err := dbserver.GetRowReader(rows)
+	if err != nil {
+		return
+	}
+
+	if rr.ScanNext() {
+		response = &LoanEntity{}
+		response.LoanID = rr.ReadByIdxString(0)
+		response.ItemID = itemID
+		response.BorrowerID = borrowerID
+		response.CheckedOutBy = checkedOutBy
+		response.CheckedOutAt = rr.ReadByIdxTime(1)
+		response.DueAt = dueAt
+	}
+
+	err = rr.Error()
+
+	return
+}
+
+func checkinItem(ctx context.Context, loanID, returnedBy string) (response time.Time, err error) {
+	query := `
+		UPDATE loan
+		SET
+			returned_at = now(),
+			returned_by = $1
+		WHERE loan_id = $2 and returned_at IS NULL
+		RETURNING returned_at`
+
+	return executeQueryWithTimeResponse(ctx, query, returnedBy, loanID)
+}
+
+func getActiveLoan(ctx context.Context, itemID string) (response *LoanEntity, err error) {
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+
+	query := `
+		SELECT` + loanColumns + `
+		FROM loan
+		WHERE item_id = $1 and returned_at IS NULL`
+
+	rows, err := dbRunner.Query(ctx, query, itemID)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	rr, err := dbserver.GetRowReader(rows)
+	if err != nil {
+		return
+	}
+
+	if rr.ScanNext() {
+		response = readLoan(rr)
+	}
+
+	err = rr.Error()
+
+	return
+}
+
+func getLoanForUpdate(ctx context.Context, loanID string) (response *LoanEntity, err error) {
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+
+	query := `
+		SELECT` + loanColumns + `
+		FROM loan
+		WHERE loan_id = $1
+		FOR UPDATE`
+
+	rows, err := dbRunner.Query(ctx, query, loanID)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	rr, err := dbserver.GetRowReader(rows)
+	if err != nil {
+		return
+	}
+
+	if rr.ScanNext() {
+		response = readLoan(rr)
+	}
+
+	err = rr.Error()
+
+	return
+}
+
+func renewLoan(ctx context.Context, loanID string, dueAt time.Time, maxRenewals int) (response int64, err error) {
+	query := `
+		UPDATE loan
+		SET
+			due_at = $1,
+			renewal_count = renewal_count + 1,
+			earlier_fines = (
+				SELECT coalesce(sum(amount), 0)
+				FROM ledger_entry
+				WHERE loan_id = $2 and entry_type = $4)
+		WHERE
+			loan_id = $2
+			and returned_at IS NULL
+			and renewal_count < $3
+		RETURNING renewal_count`
+
+	return executeQueryWithInt64Response(ctx, query, dueAt, loanID, maxRenewals, values.LedgerEntryTypeFine)
+}
+
+func getOverdueLoans(ctx context.Context, dueBefore time.Time) (response []*LoanEntity, err error) {
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+
+	query := `
+		SELECT` + loanColumns + `
+		FROM loan
+		WHERE returned_at IS NULL and due_at < $1
+		FOR UPDATE`
+
+	rows, err := dbRunner.Query(ctx, query, dueBefore)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	rr, err := dbserver.GetRowReader(rows)
+	if err != nil {
+		return
+	}
+
+	response = make([]*LoanEntity, 0)
+	for rr.ScanNext() {
+		response = append(response, readLoan(rr))
+	}
+
+	err = rr.Error()
+
+	return
+}
+
+// readLoan reads a row selected with loanColumns
+func readLoan(rr dbserver.RowReader) (loan *LoanEntity) {
+	loan = &LoanEntity{}
+	loan.LoanID = rr.ReadByIdxString(0)
+	loan.ItemID = rr.ReadByIdxString(1)
+	loan.BorrowerID = rr.ReadByIdxString(2)
+	loan.CheckedOutBy = rr.ReadByIdxString(3)
+	loan.CheckedOutAt = rr.ReadByIdxTime(4)
+	loan.DueAt = rr.ReadByIdxTime(5)
+	loan.RenewalCount = rr.ReadByIdxInt64(6)
+	loan.EarlierFines = rr.ReadByIdxInt64(7)
+	return
+}
+
+func hasActiveLoanForBook(ctx context.Context, bookID, userID string) (response bool, err error) {
+	query := `
+		SELECT count(*)
+		FROM loan l
+		JOIN item i on i.item_id = l.item_id
+		WHERE
+			i.book_id = $1
+			and l.borrower_id = $2
+			and l.returned_at IS NULL`
+
+	count, err := executeQueryWithInt64Response(ctx, query, bookID, userID)
+	response = count > 0
+
+	return
+}
+
+func hasLoanHistory(ctx context.Context, bookID, itemID string) (response bool, err error) {
+	query := `
+		SELECT count(*)
+		FROM loan l
+		JOIN item i on i.item_id = l.item_id
+		WHERE
+			i.book_id = $1
+			and ($2 = '' or l.item_id::text = $2)`
+
+	count, err := executeQueryWithInt64Response(ctx, query, bookID, itemID)
+	response = count > 0
+
+	return
+}
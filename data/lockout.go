@@ -0,0 +1,127 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/rjseymour66/library-go/values"
+)
+
+var (
+	// GetLoginBlock returns the latest time until which logins are
+	// refused for any of the subjects. If none is blocked, returns
+	// the zero time
+	GetLoginBlock = getLoginBlock
+
+	// ReserveLoginAttempt counts a login attempt for the subject as
+	// a failure and returns its failures. Failures older than
+	// resetAfter are forgotten first. If logins are blocked for the
+	// subject, counts nothing and returns 0
+	ReserveLoginAttempt = reserveLoginAttempt
+
+	// ReleaseLoginAttempt takes back an attempt reserved for the
+	// subject and lifts its block. Returns the rows affected
+	ReleaseLoginAttempt = releaseLoginAttempt
+
+	// BlockLogin refuses logins for the subject until the time
+	BlockLogin = blockLogin
+
+	// ClearLoginFailures forgets the failed logins of the subject.
+	// Returns the rows affected
+	ClearLoginFailures = clearLoginFailures
+
+	// DeleteStaleLoginFailures removes the subjects that are not
+	// blocked and whose last failure is before the time. Returns the
+	// rows affected
+	DeleteStaleLoginFailures = deleteStaleLoginFailures
+)
+
+func getLoginBlock(ctx context.Context, subjects ...string) (response time.Time, err error) {
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+
+	for _, subject := range subjects {
+		query := `
+			SELECT blocked_until
+			FROM login_failure
+			WHERE subject = $1
+				and blocked_until > now()`
+
+		rows, err := dbRunner.Query(ctx, query, subject)
+		if err != nil {
+			return response, err
+		}
+
+		rr, err := dbserver.GetRowReader(rows)
+		if err != nil {
+			rows.Close()
+			return response, err
+		}
+
+		if rr.ScanNext() {
+			blockedUntil := rr.ReadByIdxTime(0)
+			if blockedUntil.After(response) {
+				response = blockedUntil
+			}
+		}
+
+		err = rr.Error()
+		rows.Close()
+		if err != nil {
+			return response, err
+		}
+	}
+
+	return
+}
+
+func reserveLoginAttempt(ctx context.Context, subject string, resetAfter time.Duration) (response int64, err error) {
+	query := `
+		INSERT INTO login_failure AS f (subject)
+		VALUES ($1)
+		ON CONFLICT (subject) DO UPDATE
+		SET
+			failure_count = CASE
+				WHEN f.last_failure_at < now() - make_interval(secs => $2) THEN 1
+				ELSE f.failure_count + 1
+			END,
+			last_failure_at = now()
+		WHERE f.blocked_until <= now()
+		RETURNING failure_count`
+
+	return executeQueryWithInt64Response(ctx, query, subject, resetAfter.Seconds())
+}
+
+func releaseLoginAttempt(ctx context.Context, subject string) (response int64, err error) {
+	query := `
+		UPDATE login_failure
+		SET
+			failure_count = greatest(failure_count - 1, 0),
+			blocked_until = now()
+		WHERE subject = $1`
+
+	return executeQueryWithRowsAffected(ctx, query, subject)
+}
+
+func blockLogin(ctx context.Context, subject string, blockedUntil time.Time) (err error) {
+	query := `
+		UPDATE login_failure
+		SET blocked_until = $2
+		WHERE subject = $1`
+
+	_, err = executeQueryWithRowsAffected(ctx, query, subject, blockedUntil)
+	return
+}
+
+func clearLoginFailures(ctx context.Context, subject string) (response int64, err error) {
+	query := `DELETE FROM login_failure WHERE subject = $1`
+	return executeQueryWithRowsAffected(ctx, query, subject)
+}
+
+func deleteStaleLoginFailures(ctx context.Context, before time.Time) (response int64, err error) {
+	query := `
+		DELETE FROM login_failure
+		WHERE last_failure_at < $1
+			and blocked_until <= now()`
+
+	return executeQueryWithRowsAffected(ctx, query, before)
+}
@@ -0,0 +1,140 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/rjseymour66/library-go/util"
+	"github.com/rjseymour66/library-go/values"
+)
+
+type OIDCLoginEntity struct {
+	CodeVerifier string
+	Nonce        string
+}
+
+var (
+	// CreateOIDCLogin stores a sign-in in progress under the hash of
+	// its state
+	CreateOIDCLogin = createOIDCLogin
+
+	// UseOIDCLogin removes the unexpired sign-in with the state hash
+	// and returns it. If there is none, returns nil
+	UseOIDCLogin = useOIDCLogin
+
+	// DeleteExpiredOIDCLogins removes the sign-ins that were not
+	// finished in time. Returns the rows affected
+	DeleteExpiredOIDCLogins = deleteExpiredOIDCLogins
+
+	// LoginIdentity records a sign-in of the subject of the issuer and
+	// returns its userID. If it is not linked, returns empty string
+	LoginIdentity = loginIdentity
+
+	// CreateIdentity links the subject of the issuer to the user
+	CreateIdentity = createIdentity
+
+	// GetUserIDByEmail returns the userID of the only user of the auth
+	// source with the email. If there is none or more than one,
+	// returns empty string
+	GetUserIDByEmail = getUserIDByEmail
+
+	// CreateExternalUser creates an active user whose password is
+	// checked by the auth source. Returns the userID, or empty string
+	// if the username is taken
+	CreateExternalUser = createExternalUser
+)
+
+func createOIDCLogin(ctx context.Context, stateHash, codeVerifier, nonce string, expiresAt time.Time) (err error) {
+	query := `
+		INSERT INTO oidc_login(state_hash, code_verifier, nonce, expires_at)
+		VALUES ($1, $2, $3, $4)`
+
+	_, err = executeQueryWithRowsAffected(ctx, query, stateHash, codeVerifier, nonce, expiresAt)
+	return
+}
+
+func useOIDCLogin(ctx context.Context, stateHash string) (response *OIDCLoginEntity, err error) {
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+
+	query := `
+		DELETE FROM oidc_login
+		WHERE state_hash = $1
+			and expires_at > now()
+		RETURNING code_verifier, nonce`
+
+	rows, err := dbRunner.Query(ctx, query, stateHash)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	rr, err := dbserver.GetRowReader(rows)
+	if err != nil {
+		return
+	}
+
+	if rr.ScanNext() {
+		response = &OIDCLoginEntity{}
+		response.CodeVerifier = rr.ReadByIdxString(0)
+		response.Nonce = rr.ReadByIdxString(1)
+	}
+
+	err = rr.Error()
+	return
+}
+
+func deleteExpiredOIDCLogins(ctx context.Context) (response int64, err error) {
+	query := `DELETE FROM oidc_login WHERE expires_at <= now()`
+	return executeQueryWithRowsAffected(ctx, query)
+}
+
+func loginIdentity(ctx context.Context, issuer, subject string) (response string, err error) {
+	query := `
+		UPDATE user_identity
+		SET last_login_at = now()
+		WHERE issuer = $1
+			and subject = $2
+		RETURNING user_id`
+
+	return executeQueryWithStringResponse(ctx, query, issuer, subject)
+}
+
+func createIdentity(ctx context.Context, issuer, subject, userID string) (err error) {
+	query := `
+		INSERT INTO user_identity(issuer, subject, user_id)
+		VALUES ($1, $2, $3)`
+
+	_, err = executeQueryWithRowsAffected(ctx, query, issuer, subject, userID)
+	return
+}
+
+func getUserIDByEmail(ctx context.Context, email, authSource string) (response string, err error) {
+	query := `
+		SELECT min(user_id::text)
+		FROM library_user
+		WHERE lower(email) = lower($1)
+			and auth_source = $2
+		HAVING count(*) = 1`
+
+	return executeQueryWithStringResponse(ctx, query, email, authSource)
+}
+
+func createExternalUser(ctx context.Context, username, fullName string, email util.NullString, role int, authSource string) (response string, err error) {
+	// The stored password is random so that it matches nothing
+	query := `
+		INSERT INTO library_user(username, user_password, full_name, email, user_role, user_status, auth_source)
+		VALUES ($1, crypt(encode(gen_random_bytes(32), 'hex'), gen_salt('bf')), $2, $3, $4, $5, $6)
+		ON CONFLICT (username) DO NOTHING
+		RETURNING user_id`
+
+	return executeQueryWithStringResponse(
+		ctx,
+		query,
+		username,
+		fullName,
+		email,
+		role,
+		values.UserStatusActive,
+		authSource)
+}
@@ -0,0 +1,63 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/rjseymour66/library-go/values"
+)
+
+var (
+	// CheckUserPassword returns whether the password is the one of
+	// the user
+	CheckUserPassword = checkUserPassword
+
+	// CreatePasswordReset stores the hash of a reset token for the
+	// user, and discards the unused tokens it had before
+	CreatePasswordReset = createPasswordReset
+
+	// UsePasswordReset marks the unused, unexpired reset token with
+	// the hash as used and returns its userID. If there is none,
+	// returns empty string
+	UsePasswordReset = usePasswordReset
+)
+
+func checkUserPassword(ctx context.Context, userID, password string) (response bool, err error) {
+	query := `
+		SELECT count(*)
+		FROM library_user
+		WHERE
+			user_id = $1
+			and user_password = crypt($2, user_password)
+			and auth_source = $3`
+
+	count, err := executeQueryWithInt64Response(ctx, query, userID, password, values.AuthSourceDatabase)
+	response = count > 0
+
+	return
+}
+
+func createPasswordReset(ctx context.Context, userID, tokenHash string, expiresAt time.Time) (err error) {
+	query := `
+		WITH discarded AS (
+			DELETE FROM password_reset
+			WHERE user_id = $1 and used_at IS NULL
+		)
+		INSERT INTO password_reset(user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)`
+
+	_, err = executeQueryWithRowsAffected(ctx, query, userID, tokenHash, expiresAt)
+	return
+}
+
+func usePasswordReset(ctx context.Context, tokenHash string) (response string, err error) {
+	query := `
+		UPDATE password_reset
+		SET used_at = now()
+		WHERE token_hash = $1
+			and used_at IS NULL
+			and expires_at > now()
+		RETURNING user_id`
+
+	return executeQueryWithStringResponse(ctx, query, tokenHash)
+}
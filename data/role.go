@@ -0,0 +1,283 @@
+package data
+
+import (
+	"context"
+
+	"github.com/rjseymour66/library-go/values"
+)
+
+type RoleEntity struct {
+	Code        int64
+	Name        string
+	Description string
+	BuiltIn     bool
+	Permissions []string
+}
+
+type PermissionEntity struct {
+	Permission  string
+	Description string
+}
+
+type RolePermission struct {
+	RoleCode   int64
+	Permission string
+}
+
+var (
+	// GetRoles returns every role with its permissions
+	GetRoles = getRoles
+
+	// GetRole returns the role with its permissions. If there is
+	// none, returns nil
+	GetRole = getRole
+
+	// GetRoleCodeByName returns the code of the role with the name.
+	// If there is none, returns 0
+	GetRoleCodeByName = getRoleCodeByName
+
+	// GetPermissions returns every permission a role can grant
+	GetPermissions = getPermissions
+
+	// GetRolePermissions returns the permissions of every role
+	GetRolePermissions = getRolePermissions
+
+	// CreateRole creates a role without permissions and returns its
+	// code
+	CreateRole = createRole
+
+	// UpdateRole changes the name and description of the role.
+	// Returns the rows affected
+	UpdateRole = updateRole
+
+	// SetRolePermissions replaces the permissions of the role
+	SetRolePermissions = setRolePermissions
+
+	// DeleteRole deletes the role unless it is built in. Returns the
+	// rows affected
+	DeleteRole = deleteRole
+
+	// CountRoleUsers returns the number of users with the role
+	CountRoleUsers = countRoleUsers
+)
+
+func getRoles(ctx context.Context) (response []*RoleEntity, err error) {
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+
+	query := `
+		SELECT code, role_name, role_description, built_in::int
+		FROM user_role
+		ORDER BY code`
+
+	rows, err := dbRunner.Query(ctx, query)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	rr, err := dbserver.GetRowReader(rows)
+	if err != nil {
+		return
+	}
+
+	response = make([]*RoleEntity, 0)
+	roles := make(map[int64]*RoleEntity)
+	for rr.ScanNext() {
+		role := readRole(rr)
+		roles[role.Code] = role
+		response = append(response, role)
+	}
+
+	err = rr.Error()
+	if err != nil {
+		return
+	}
+
+	permissions, err := getRolePermissions(ctx)
+	if err != nil {
+		return
+	}
+
+	for _, permission := range permissions {
+		if role, ok := roles[permission.RoleCode]; ok {
+			role.Permissions = append(role.Permissions, permission.Permission)
+		}
+	}
+
+	return
+}
+
+func getRole(ctx context.Context, code int) (response *RoleEntity, err error) {
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+
+	query := `
+		SELECT code, role_name, role_description, built_in::int
+		FROM user_role
+		WHERE code = $1`
+
+	rows, err := dbRunner.Query(ctx, query, code)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	rr, err := dbserver.GetRowReader(rows)
+	if err != nil {
+		return
+	}
+
+	if rr.ScanNext() {
+		response = readRole(rr)
+	}
+
+	err = rr.Error()
+	if err != nil || response == nil {
+		return
+	}
+
+	permissions, err := getRolePermissions(ctx)
+	if err != nil {
+		return
+	}
+
+	for _, permission := range permissions {
+		if permission.RoleCode == response.Code {
+			response.Permissions = append(response.Permissions, permission.Permission)
+		}
+	}
+
+	return
+}
+
+func readRole(rr dbserver.RowReader) (role *RoleEntity) {
+	role = &RoleEntity{}
+	role.Code = rr.ReadByIdxInt64(0)
+	role.Name = rr.ReadByIdxString(1)
+	role.Description = rr.ReadByIdxString(2)
+	role.BuiltIn = rr.ReadByIdxInt64(3) == 1
+	role.Permissions = make([]string, 0)
+	return
+}
+
+func getRoleCodeByName(ctx context.Context, name string) (response int64, err error) {
+	query := `SELECT code FROM user_role WHERE lower(role_name) = lower($1)`
+	return executeQueryWithInt64Response(ctx, query, name)
+}
+
+func getPermissions(ctx context.Context) (response []*PermissionEntity, err error) {
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+
+	query := `
+		SELECT
+			permission as "Permission",
+			permission_description as "Description"
+		FROM permission
+		ORDER BY permission`
+
+	rows, err := dbRunner.Query(ctx, query)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	rr, err := dbserver.GetRowReader(rows)
+	if err != nil {
+		return
+	}
+
+	response = make([]*PermissionEntity, 0)
+	for rr.ScanNext() {
+		permission := &PermissionEntity{}
+		rr.ReadAllToStruct(permission)
+		response = append(response, permission)
+	}
+
+	err = rr.Error()
+	return
+}
+
+func getRolePermissions(ctx context.Context) (response []*RolePermission, err error) {
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+
+	query := `
+		SELECT
+			role_code as "RoleCode",
+			permission as "Permission"
+		FROM role_permission
+		ORDER BY role_code, permission`
+
+	rows, err := dbRunner.Query(ctx, query)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	rr, err := dbserver.GetRowReader(rows)
+	if err != nil {
+		return
+	}
+
+	response = make([]*RolePermission, 0)
+	for rr.ScanNext() {
+		permission := &RolePermission{}
+		rr.ReadAllToStruct(permission)
+		response = append(response, permission)
+	}
+
+	err = rr.Error()
+	return
+}
+
+func createRole(ctx context.Context, name, description string) (response int64, err error) {
+	query := `
+		INSERT INTO user_role(role_name, role_description)
+		VALUES ($1, $2)
+		RETURNING code`
+
+	return executeQueryWithInt64Response(ctx, query, name, description)
+}
+
+func updateRole(ctx context.Context, code int, name, description string) (response int64, err error) {
+	query := `
+		UPDATE user_role
+		SET
+			role_name = $1,
+			role_description = $2
+		WHERE code = $3`
+
+	return executeQueryWithRowsAffected(ctx, query, name, description, code)
+}
+
+func setRolePermissions(ctx context.Context, code int, permissions []string) (err error) {
+	query := `DELETE FROM role_permission WHERE role_code = $1`
+
+	_, err = executeQueryWithRowsAffected(ctx, query, code)
+	if err != nil {
+		return
+	}
+
+	query = `INSERT INTO role_permission(role_code, permission) VALUES ($1, $2)`
+
+	for _, permission := range permissions {
+		_, err = executeQueryWithRowsAffected(ctx, query, code, permission)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func deleteRole(ctx context.Context, code int) (response int64, err error) {
+	query := `DELETE FROM user_role WHERE code = $1 and not built_in`
+	return executeQueryWithRowsAffected(ctx, query, code)
+}
+
+func countRoleUsers(ctx context.Context, code int) (response int64, err error) {
+	query := `SELECT count(*) FROM library_user WHERE user_role = $1`
+	return executeQueryWithInt64Response(ctx, query, code)
+}
@@ -0,0 +1,212 @@
+package data
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/rjseymour66/library-go/values"
+)
+
+// Search vector weights of the book columns, as set by the
+// search_vector column in public_schema.sql
+const (
+	SearchWeightTitle       = "A"
+	SearchWeightAuthor      = "B"
+	SearchWeightPublisher   = "C"
+	SearchWeightDescription = "D"
+)
+
+// BookSearch selects the books of a listing
+type BookSearch struct {
+	// Term is matched against the book search vector. Every word
+	// must match, and the last letters of a word may be missing
+	Term string
+
+	// Weights limits the match to the columns with these weights.
+	// Empty matches every column
+	Weights string
+
+	// The facet filters. A zero value does not filter
+	Author     string
+	Publisher  string
+	Status     int
+	BorrowerID string
+
+	// WithItems leaves out the books that have no items (copies)
+	WithItems bool
+
+	// Sort orders the listing. Empty puts the best matches of the
+	// term first, then orders by title
+	Sort []BookSort
+
+	// Cursor continues the listing after the book it was made for,
+	// as returned by MakeBookCursor. Empty starts from the first book
+	Cursor string
+}
+
+// tsQuery returns the tsquery text for the search term, such as
+// "tolkien:*AB & hobbit:*AB". Only letters and digits are kept from
+// the term, so the result is always a valid query. If the term has
+// no words, returns an empty string
+func (search *BookSearch) tsQuery() string {
+	words := strings.FieldsFunc(search.Term, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for i, word := range words {
+		words[i] = strings.ToLower(word) + ":*" + search.Weights
+	}
+
+	return strings.Join(words, " & ")
+}
+
+// Sort keys of book listings
+const (
+	SortKeyTitle     = "title"
+	SortKeyAuthor    = "author"
+	SortKeyPublisher = "publisher"
+	SortKeyCreatedAt = "created_at"
+	SortKeyUpdatedAt = "updated_at"
+	SortKeyStatus    = "status"
+)
+
+// BookSort orders a listing by a sort key
+type BookSort struct {
+	Key        string
+	Descending bool
+}
+
+// bookSortKeys are the only expressions a listing can be sorted by.
+// The status key is the number of available items.
+var bookSortKeys = map[string]sortKey{
+	SortKeyTitle:     {name: SortKeyTitle, expression: "b.book_name", sqlType: "text"},
+	SortKeyAuthor:    {name: SortKeyAuthor, expression: "b.author_name", sqlType: "text"},
+	SortKeyPublisher: {name: SortKeyPublisher, expression: "b.publisher", sqlType: "text"},
+	SortKeyCreatedAt: {name: SortKeyCreatedAt, expression: "b.created_at", sqlType: "timestamp with time zone"},
+	SortKeyUpdatedAt: {name: SortKeyUpdatedAt, expression: "b.updated_at", sqlType: "timestamp with time zone"},
+	SortKeyStatus: {
+		name: SortKeyStatus,
+		expression: `(SELECT count(*) FROM item si
+			WHERE si.book_id = b.book_id AND si.item_status = ` + strconv.Itoa(values.BookStatusAvailable) + `)`,
+		sqlType: "bigint",
+	},
+}
+
+// sortKey is an expression the books of a listing are ordered by. Its
+// SQL type is used to cast the cursor values back.
+type sortKey struct {
+	name       string
+	expression string
+	sqlType    string
+	descending bool
+}
+
+// bookSearchQuery holds the SQL fragments that apply a BookSearch to
+// a query on the book table aliased as b
+type bookSearchQuery struct {
+	condition string
+	order     string
+	cursorKey string
+	args      []interface{}
+}
+
+// makeBookSearchQuery returns the fragments for the search. Their
+// placeholders are numbered from firstArg. An invalid cursor returns
+// ErrInvalidCursor.
+func makeBookSearchQuery(search *BookSearch, firstArg int) (query *bookSearchQuery, err error) {
+	query = &bookSearchQuery{}
+
+	conditions := []string{"TRUE"}
+	keys := make([]sortKey, 0)
+
+	// addArg binds the value and returns its placeholder
+	addArg := func(value interface{}) string {
+		query.args = append(query.args, value)
+		return "$" + strconv.Itoa(firstArg+len(query.args)-1)
+	}
+
+	tsQuery := search.tsQuery()
+	if tsQuery != "" {
+		placeholder := addArg(tsQuery)
+		conditions = append(conditions, "b.search_vector @@ to_tsquery('english', "+placeholder+")")
+		keys = append(keys, sortKey{
+			name:       "rank",
+			expression: "ts_rank(b.search_vector, to_tsquery('english', " + placeholder + "))",
+			sqlType:    "real",
+			descending: true,
+		})
+	}
+
+	if search.Author != "" {
+		conditions = append(conditions, "b.author_name = "+addArg(search.Author))
+	}
+
+	if search.Publisher != "" {
+		conditions = append(conditions, "b.publisher = "+addArg(search.Publisher))
+	}
+
+	if search.Status != values.BookStatusUnkown {
+		conditions = append(conditions, `EXISTS (
+			SELECT 1 FROM item fi
+			WHERE fi.book_id = b.book_id AND fi.item_status = `+addArg(search.Status)+`)`)
+	}
+
+	if search.BorrowerID != "" {
+		conditions = append(conditions, `EXISTS (
+			SELECT 1 FROM item fi
+			JOIN loan fl on fl.item_id = fi.item_id
+			WHERE fi.book_id = b.book_id
+			AND fl.returned_at IS NULL
+			AND fl.borrower_id = `+addArg(search.BorrowerID)+`)`)
+	}
+
+	if search.WithItems {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM item fi WHERE fi.book_id = b.book_id)")
+	}
+
+	// Without a sort, the best matches come first. The book ID is the
+	// last key so that the order is total and cursors work
+	if len(search.Sort) == 0 {
+		keys = append(keys, bookSortKeys[SortKeyTitle])
+	} else {
+		keys = keys[:0]
+		for _, sort := range search.Sort {
+			key, ok := bookSortKeys[sort.Key]
+			if !ok {
+				err = fmt.Errorf("unknown sort key %q", sort.Key)
+				return
+			}
+
+			key.descending = sort.Descending
+			keys = append(keys, key)
+		}
+	}
+	keys = append(keys, sortKey{name: "id", expression: "b.book_id", sqlType: "uuid"})
+
+	if search.Cursor != "" {
+		var condition string
+		condition, err = makeKeysetCondition(search.Cursor, keys, addArg)
+		if err != nil {
+			return
+		}
+		conditions = append(conditions, condition)
+	}
+
+	orders := make([]string, len(keys))
+	cursorValues := make([]string, len(keys))
+	for i, key := range keys {
+		orders[i] = key.expression
+		if key.descending {
+			orders[i] += " DESC"
+		}
+		cursorValues[i] = key.expression + "::text"
+	}
+
+	query.condition = strings.Join(conditions, " AND ")
+	query.order = strings.Join(orders, ", ")
+	query.cursorKey = fmt.Sprintf("json_build_object('Sort', '%v', 'Keys', json_build_array(%v))::text",
+		sortSignature(keys), strings.Join(cursorValues, ", "))
+	return
+}
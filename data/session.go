@@ -0,0 +1,76 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/rjseymour66/library-go/values"
+)
+
+type SessionEntity struct {
+	Token     string
+	ExpiresAt time.Time
+}
+
+var (
+	// CreateSession starts a session for the user and returns its
+	// token. The session expires after idleTimeout unless it is used
+	CreateSession = createSession
+
+	// DeleteSession ends the session of the token. Returns the rows
+	// affected
+	DeleteSession = deleteSession
+
+	// DeleteUserSessions ends every session of the user. Returns the
+	// rows affected
+	DeleteUserSessions = deleteUserSessions
+
+	// DeleteExpiredSessions removes the sessions that expired.
+	// Returns the rows affected
+	DeleteExpiredSessions = deleteExpiredSessions
+)
+
+func createSession(ctx context.Context, userID string, idleTimeout, maxLifetime time.Duration) (response *SessionEntity, err error) {
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+
+	query := `
+		INSERT INTO session(user_id, expires_at)
+		VALUES ($1, now() + least(make_interval(secs => $2), make_interval(secs => $3)))
+		RETURNING token, expires_at`
+
+	rows, err := dbRunner.Query(ctx, query, userID, idleTimeout.Seconds(), maxLifetime.Seconds())
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	rr, err := dbserver.GetRowReader(rows)
+	if err != nil {
+		return
+	}
+
+	if rr.ScanNext() {
+		response = &SessionEntity{}
+		response.Token = rr.ReadByIdxString(0)
+		response.ExpiresAt = rr.ReadByIdxTime(1)
+	}
+
+	err = rr.Error()
+	return
+}
+
+func deleteSession(ctx context.Context, token string) (response int64, err error) {
+	query := `DELETE FROM session WHERE token = $1`
+	return executeQueryWithRowsAffected(ctx, query, token)
+}
+
+func deleteUserSessions(ctx context.Context, userID string) (response int64, err error) {
+	query := `DELETE FROM session WHERE user_id = $1`
+	return executeQueryWithRowsAffected(ctx, query, userID)
+}
+
+func deleteExpiredSessions(ctx context.Context) (response int64, err error) {
+	query := `DELETE FROM session WHERE expires_at <= now()`
+	return executeQueryWithRowsAffected(ctx, query)
+}
@@ -1,45 +1,497 @@
 package data
 
-import "context"
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rjseymour66/library-go/util"
+	"github.com/rjseymour66/library-go/values"
+)
+
+type UserEntity struct {
+	UserID     string
+	Username   string
+	FullName   string
+	Email      string `json:",omitempty"`
+	Phone      string `json:",omitempty"`
+	Role       int64
+	Status     int64
+	AuthSource string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+type UserInfo struct {
+	UserID   string
+	Username string
+	FullName string
+	Email    string `json:",omitempty"`
+	Role     int64
+	Status   int64
+}
 
 var (
 	// Find the user with the provided username and password
-	// and returns user token
+	// and returns its userID
 	LoginUser = loginUser
 
-	// AuthorizeUser returns user's role if the token exists
-	// if token does not exist, returns empty string
+	// AuthorizeUser returns the user and its role if the token
+	// belongs to a live session and the user is active, and slides
+	// the expiry of the session forward. Otherwise, returns nil
 	AuthorizeUser = authorizeUser
 
-	// Returns userID for provided token
+	// Returns userID for the live session of the provided token, or
+	// the user the request was authorized for
 	GetUserID = getUserID
+
+	// UserExists returns whether a user with the userID exists
+	UserExists = userExists
+
+	// LockUser locks the user row until the end of the transaction
+	// and returns whether the user exists
+	LockUser = lockUser
+
+	// RegisterUser creates a pending member and returns its userID
+	RegisterUser = registerUser
+
+	// GetUserIDByUsername returns the userID of the username. If
+	// there is none, returns empty string
+	GetUserIDByUsername = getUserIDByUsername
+
+	// GetUserStatus returns the status of the user
+	GetUserStatus = getUserStatus
+
+	// GetUsersByStatus returns the users with the status, oldest
+	// first. UserStatusUnknown returns every user
+	GetUsersByStatus = getUsersByStatus
+
+	// ChangeUserStatus sets the status of the user if its current
+	// status is one of fromStatuses. Returns the rows affected
+	ChangeUserStatus = changeUserStatus
+
+	// CreateUser creates an active user with the role
+	CreateUser = createUser
+
+	// GetUser returns the user. If there is none, returns nil
+	GetUser = getUser
+
+	// GetAllUsers returns the users whose username, full name or
+	// email contains the search term
+	GetAllUsers = getAllUsers
+
+	// CountUsers returns the number of users GetAllUsers finds for
+	// the search term
+	CountUsers = countUsers
+
+	// UpdateUser changes the name and contact details of the user.
+	// If there is none, returns the zero time
+	UpdateUser = updateUser
+
+	// ChangeUserRole changes the role of the user. If there is
+	// none, returns the zero time
+	ChangeUserRole = changeUserRole
+
+	// ResetUserPassword sets a new password for the user and ends
+	// its sessions. Returns the rows affected
+	ResetUserPassword = resetUserPassword
+
+	// ProvisionUser creates an active user of the auth source on its
+	// first login, or updates its name, email and role on later ones.
+	// Returns the userID, or empty string if the username belongs to
+	// a user of another source
+	ProvisionUser = provisionUser
 )
 
 func loginUser(ctx context.Context, username, password string) (response string, err error) {
 	query := `
-		SELECT token
+		SELECT user_id
 		FROM library_user
 		WHERE
 			username = $1
-			and user_password = crypt($2, user_password)`
+			and user_password = crypt($2, user_password)
+			and auth_source = $3`
 
-	return executeQueryWithStringResponse(ctx, query, username, password)
+	return executeQueryWithStringResponse(ctx, query, username, password, values.AuthSourceDatabase)
 }
 
-func authorizeUser(ctx context.Context, token string) (response int64, err error) {
+func authorizeUser(ctx context.Context, token string, idleTimeout, maxLifetime time.Duration) (response *values.Principal, err error) {
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+
 	query := `
-		SELECT	user_role
-		FROM 	library_user
-		WHERE 	token = $1`
+		UPDATE session s
+		SET
+			last_used_at = now(),
+			expires_at = least(
+				now() + make_interval(secs => $3),
+				s.created_at + make_interval(secs => $4))
+		FROM library_user u
+		WHERE s.token = $1
+			and s.expires_at > now()
+			and u.user_id = s.user_id
+			and u.user_status = $2
+		RETURNING u.user_id, u.user_role`
+
+	rows, err := dbRunner.Query(
+		ctx,
+		query,
+		token,
+		values.UserStatusActive,
+		idleTimeout.Seconds(),
+		maxLifetime.Seconds())
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	rr, err := dbserver.GetRowReader(rows)
+	if err != nil {
+		return
+	}
 
-	return executeQueryWithInt64Response(ctx, query, token)
+	if rr.ScanNext() {
+		response = &values.Principal{}
+		response.UserID = rr.ReadByIdxString(0)
+		response.Role = int(rr.ReadByIdxInt64(1))
+	}
+
+	err = rr.Error()
+	return
 }
 
 func getUserID(ctx context.Context, token string) (response string, err error) {
+	// Authorized requests carry the user
+	if principal, ok := ctx.Value(values.ContextKeyPrincipal).(*values.Principal); ok {
+		return principal.UserID, nil
+	}
+
 	query := `
 		SELECT	user_id
-		FROM	library_user
-		WHERE	token = $1`
+		FROM	session
+		WHERE	token = $1
+			and expires_at > now()`
 
 	return executeQueryWithStringResponse(ctx, query, token)
 }
+
+func userExists(ctx context.Context, userID string) (response bool, err error) {
+	query := `SELECT count(*) FROM library_user WHERE user_id = $1`
+
+	count, err := executeQueryWithInt64Response(ctx, query, userID)
+	response = count > 0
+
+	return
+}
+
+func lockUser(ctx context.Context, userID string) (response bool, err error) {
+	query := `
+		SELECT count(*)
+		FROM (
+			SELECT user_id
+			FROM library_user
+			WHERE user_id = $1
+			FOR UPDATE
+		) u`
+
+	count, err := executeQueryWithInt64Response(ctx, query, userID)
+	response = count > 0
+
+	return
+}
+
+func registerUser(ctx context.Context, username, password, fullName string) (response string, err error) {
+	query := `
+		INSERT INTO library_user(username, user_password, full_name, user_role, user_status)
+		VALUES ($1, crypt($2, gen_salt('bf')), $3, $4, $5)
+		RETURNING user_id`
+
+	return executeQueryWithStringResponse(
+		ctx,
+		query,
+		username,
+		password,
+		fullName,
+		values.UserRoleMember,
+		values.UserStatusPending)
+}
+
+func getUserIDByUsername(ctx context.Context, username string) (response string, err error) {
+	query := `SELECT user_id FROM library_user WHERE username = $1`
+	return executeQueryWithStringResponse(ctx, query, username)
+}
+
+func getUserStatus(ctx context.Context, userID string) (response int64, err error) {
+	query := `SELECT user_status FROM library_user WHERE user_id = $1`
+	return executeQueryWithInt64Response(ctx, query, userID)
+}
+
+func getUsersByStatus(ctx context.Context, status, rowOffset, rowLimit int) (response []*UserInfo, err error) {
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+
+	query := `
+		SELECT
+			user_id as "UserID",
+			username as "Username",
+			full_name as "FullName",
+			email as "Email",
+			user_role as "Role",
+			user_status as "Status"
+		FROM library_user
+		WHERE $1 = 0 OR user_status = $1
+		ORDER BY created_at, user_id
+		OFFSET $2
+		LIMIT $3`
+
+	rows, err := dbRunner.Query(ctx, query, status, rowOffset, rowLimit)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	rr, err := dbserver.GetRowReader(rows)
+	if err != nil {
+		return
+	}
+
+	response = make([]*UserInfo, 0)
+	for rr.ScanNext() {
+		user := &UserInfo{}
+		rr.ReadAllToStruct(user)
+		response = append(response, user)
+	}
+
+	err = rr.Error()
+	return
+}
+
+func changeUserStatus(ctx context.Context, userID string, status int, fromStatuses ...int) (response int64, err error) {
+	params := []interface{}{userID, status}
+	placeholders := make([]string, len(fromStatuses))
+	for i, fromStatus := range fromStatuses {
+		params = append(params, fromStatus)
+		placeholders[i] = "$" + strconv.Itoa(len(params))
+	}
+
+	query := `
+		UPDATE library_user
+		SET user_status = $2
+		WHERE user_id = $1
+			and user_status IN (` + strings.Join(placeholders, ", ") + `)`
+
+	return executeQueryWithRowsAffected(ctx, query, params...)
+}
+
+func createUser(
+	ctx context.Context,
+	username,
+	password,
+	fullName string,
+	email,
+	phone util.NullString,
+	role int) (response *UserEntity, err error) {
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+
+	query := `
+		INSERT INTO library_user(username, user_password, full_name, email, phone, user_role, user_status)
+		VALUES ($1, crypt($2, gen_salt('bf')), $3, $4, $5, $6, $7)
+		RETURNING user_id, created_at`
+
+	rows, err := dbRunner.Query(ctx, query, username, password, fullName, email, phone, role, values.UserStatusActive)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	rr, err := dbserver.GetRowReader(rows)
+	if err != nil {
+		return
+	}
+
+	if rr.ScanNext() {
+		response = &UserEntity{}
+		response.UserID = rr.ReadByIdxString(0)
+		response.Username = username
+		response.FullName = fullName
+		response.Email = util.GetNullStringValue(email)
+		response.Phone = util.GetNullStringValue(phone)
+		response.Role = int64(role)
+		response.Status = values.UserStatusActive
+		response.AuthSource = values.AuthSourceDatabase
+		response.CreatedAt = rr.ReadByIdxTime(1)
+		response.UpdatedAt = rr.ReadByIdxTime(1)
+	}
+
+	err = rr.Error()
+	return
+}
+
+func getUser(ctx context.Context, userID string) (response *UserEntity, err error) {
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+
+	query := `
+		SELECT
+			user_id,
+			username,
+			full_name,
+			coalesce(email, ''),
+			coalesce(phone, ''),
+			user_role,
+			user_status,
+			auth_source,
+			created_at,
+			updated_at
+		FROM library_user
+		WHERE user_id = $1`
+
+	rows, err := dbRunner.Query(ctx, query, userID)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	rr, err := dbserver.GetRowReader(rows)
+	if err != nil {
+		return
+	}
+
+	if rr.ScanNext() {
+		response = &UserEntity{}
+		response.UserID = rr.ReadByIdxString(0)
+		response.Username = rr.ReadByIdxString(1)
+		response.FullName = rr.ReadByIdxString(2)
+		response.Email = rr.ReadByIdxString(3)
+		response.Phone = rr.ReadByIdxString(4)
+		response.Role = rr.ReadByIdxInt64(5)
+		response.Status = rr.ReadByIdxInt64(6)
+		response.AuthSource = rr.ReadByIdxString(7)
+		response.CreatedAt = rr.ReadByIdxTime(8)
+		response.UpdatedAt = rr.ReadByIdxTime(9)
+	}
+
+	err = rr.Error()
+	return
+}
+
+func getAllUsers(ctx context.Context, searchTerm string, rowOffset, rowLimit int) (response []*UserInfo, err error) {
+	dbRunner := ctx.Value(values.ContextKeyDbRunner).(dbserver.Runner)
+
+	query := `
+		SELECT
+			user_id as "UserID",
+			username as "Username",
+			full_name as "FullName",
+			email as "Email",
+			user_role as "Role",
+			user_status as "Status"
+		FROM library_user
+		WHERE
+			username ILIKE '%' || $1 || '%'
+			or full_name ILIKE '%' || $1 || '%'
+			or email ILIKE '%' || $1 || '%'
+		ORDER BY full_name, user_id
+		OFFSET $2
+		LIMIT $3`
+
+	rows, err := dbRunner.Query(ctx, query, searchTerm, rowOffset, rowLimit)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	rr, err := dbserver.GetRowReader(rows)
+	if err != nil {
+		return
+	}
+
+	response = make([]*UserInfo, 0)
+	for rr.ScanNext() {
+		user := &UserInfo{}
+		rr.ReadAllToStruct(user)
+		response = append(response, user)
+	}
+
+	err = rr.Error()
+	return
+}
+
+func countUsers(ctx context.Context, searchTerm string) (response int64, err error) {
+	query := `
+		SELECT count(*)
+		FROM library_user
+		WHERE
+			username ILIKE '%' || $1 || '%'
+			or full_name ILIKE '%' || $1 || '%'
+			or email ILIKE '%' || $1 || '%'`
+
+	return executeQueryWithInt64Response(ctx, query, searchTerm)
+}
+
+func updateUser(ctx context.Context, userID, fullName string, email, phone util.NullString) (response time.Time, err error) {
+	query := `
+		UPDATE library_user
+		SET
+			full_name = $1,
+			email = $2,
+			phone = $3
+		WHERE user_id = $4
+		RETURNING updated_at`
+
+	return executeQueryWithTimeResponse(ctx, query, fullName, email, phone, userID)
+}
+
+func changeUserRole(ctx context.Context, userID string, role int) (response time.Time, err error) {
+	query := `
+		UPDATE library_user
+		SET user_role = $1
+		WHERE user_id = $2
+		RETURNING updated_at`
+
+	return executeQueryWithTimeResponse(ctx, query, role, userID)
+}
+
+func resetUserPassword(ctx context.Context, userID, password string) (response int64, err error) {
+	query := `
+		WITH updated AS (
+			UPDATE library_user
+			SET user_password = crypt($1, gen_salt('bf'))
+			WHERE user_id = $2
+			RETURNING user_id
+		), ended AS (
+			DELETE FROM session
+			WHERE user_id IN (SELECT user_id FROM updated)
+		)
+		SELECT count(*) FROM updated`
+
+	return executeQueryWithInt64Response(ctx, query, password, userID)
+}
+
+func provisionUser(ctx context.Context, username, fullName string, email util.NullString, role int, authSource string) (response string, err error) {
+	// The password of the user is checked by its source; the stored
+	// one is random so that it matches nothing
+	query := `
+		INSERT INTO library_user AS u(username, user_password, full_name, email, user_role, user_status, auth_source)
+		VALUES ($1, crypt(encode(gen_random_bytes(32), 'hex'), gen_salt('bf')), $2, $3, $4, $5, $6)
+		ON CONFLICT (username) DO UPDATE
+		SET
+			full_name = excluded.full_name,
+			email = excluded.email,
+			user_role = excluded.user_role
+		WHERE u.auth_source = excluded.auth_source
+		RETURNING user_id`
+
+	return executeQueryWithStringResponse(
+		ctx,
+		query,
+		username,
+		fullName,
+		email,
+		role,
+		values.UserStatusActive,
+		authSource)
+}
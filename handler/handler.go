@@ -18,6 +18,15 @@ type Request struct {
 	Body          io.Reader
 	URL           *url.URL
 	Method        string
+	ClientIP      string
+
+	// params holds the values of the {name} segments of the route
+	params map[string]string
+}
+
+// param returns the value of the {name} segment of the route
+func (request *Request) param(name string) string {
+	return request.params[name]
 }
 
 var (
@@ -25,145 +34,470 @@ var (
 	Handle = handle
 )
 
+// api is the route table of the API. Every route but the open ones
+// authenticates the request, and most require a permission.
+var api *router
+
+// The routes are set up in init, since the handler of the API
+// document reads them
+func init() {
+	api = newAPIRouter()
+	apiDoc, apiDocErr = newAPIDoc(api)
+}
+
+func newAPIRouter() *router {
+	rt := &router{}
+
+	rt.add(http.MethodGet, "/api/openapi.json", handleOpenAPI)
+
+	open := rt.group("/api/open")
+	open.add(http.MethodPost, "/login", handleLogin)
+	open.add(http.MethodPost, "/register", handleRegister)
+	open.add(http.MethodPost, "/refresh", handleRefreshAccessToken)
+	open.add(http.MethodPost, "/password/forgot", handleRequestPasswordReset)
+	open.add(http.MethodPost, "/password/reset", handleResetPassword)
+	open.add(http.MethodPost, "/oidc/start", handleStartOIDCLogin)
+	open.add(http.MethodPost, "/oidc/callback", handleFinishOIDCLogin)
+
+	user := rt.group("/api", authenticated)
+	user.add(http.MethodDelete, "/session", handleLogout)
+	user.add(http.MethodDelete, "/session/all", handleLogoutEverywhere)
+	user.add(http.MethodPut, "/password", handleChangePassword)
+	user.add(http.MethodGet, "/apikey", handleGetAPIKeys)
+	user.add(http.MethodPost, "/apikey", handleCreateAPIKey)
+	user.add(http.MethodDelete, "/apikey/{id}", handleRevokeAPIKey)
+
+	member := rt.group("/api/member", authenticated)
+	member.add(http.MethodGet, "/book/all", handleMemberGetAllBooks, requirePermission(values.PermissionBookRead))
+	member.add(http.MethodGet, "/book/isbn/{isbn}", handleMemberGetBookByISBN, requirePermission(values.PermissionBookRead))
+	member.add(http.MethodGet, "/book/{id}", handleMemberGetBook, requirePermission(values.PermissionBookRead))
+	member.add(http.MethodPatch, "/book", handleBorrowOrReturnBook, requirePermission(values.PermissionLoanSelf))
+	member.add(http.MethodPost, "/book/renew", handleRenewBook, requirePermission(values.PermissionLoanSelf))
+	member.add(http.MethodPost, "/hold", handlePlaceHold, requirePermission(values.PermissionHoldSelf))
+	member.add(http.MethodGet, "/hold/{id}", handleGetHold, requirePermission(values.PermissionHoldSelf))
+	member.add(http.MethodDelete, "/hold/{id}", handleCancelHold, requirePermission(values.PermissionHoldSelf))
+
+	librarian := rt.group("/api/librarian", authenticated)
+	librarian.add(http.MethodPost, "/book", handleCreateBook, requirePermission(values.PermissionBookCreate))
+	librarian.add(http.MethodPost, "/book/import/marc", handleImportMARC, requirePermission(values.PermissionBookCreate))
+	librarian.add(http.MethodPost, "/book/import/csv", handleImportCSV, requirePermission(values.PermissionBookCreate))
+	librarian.add(http.MethodGet, "/book/export/marc", handleExportMARC, requirePermission(values.PermissionBookExport))
+	librarian.add(http.MethodGet, "/book/export/csv", handleExportCSV, requirePermission(values.PermissionBookExport))
+	librarian.add(http.MethodGet, "/book/all", handleLibrarianGetAllBooks, requirePermission(values.PermissionBookInspect))
+	librarian.add(http.MethodGet, "/book/{id}", handleLibrarianGetBook, requirePermission(values.PermissionBookInspect))
+	librarian.add(http.MethodPut, "/book", handleUpdateBook, requirePermission(values.PermissionBookUpdate))
+	librarian.add(http.MethodDelete, "/book/{id}", handleDeleteBook, requirePermission(values.PermissionBookDelete))
+
+	librarian.add(http.MethodPost, "/item", handleCreateItem, requirePermission(values.PermissionItemManage))
+	librarian.add(http.MethodGet, "/item/{id}", handleGetItem, requirePermission(values.PermissionItemRead))
+	librarian.add(http.MethodPut, "/item", handleUpdateItem, requirePermission(values.PermissionItemManage))
+	librarian.add(http.MethodDelete, "/item/{id}", handleDeleteItem, requirePermission(values.PermissionItemManage))
+
+	librarian.add(http.MethodPost, "/loan", handleCheckoutBook, requirePermission(values.PermissionLoanManage))
+	librarian.add(http.MethodPatch, "/loan", handleCheckinBook, requirePermission(values.PermissionLoanManage))
+	librarian.add(http.MethodGet, "/loan/{id}", handleGetActiveLoan, requirePermission(values.PermissionLoanRead))
+
+	librarian.add(http.MethodGet, "/ledger/{id}", handleGetAccount, requirePermission(values.PermissionLedgerRead))
+	librarian.add(http.MethodPost, "/ledger/payment", handleRecordPayment, requirePermission(values.PermissionLedgerManage))
+	librarian.add(http.MethodPost, "/ledger/waiver", handleWaiveCharge, requirePermission(values.PermissionLedgerManage))
+
+	librarian.add(http.MethodGet, "/account", handleGetUsers, requirePermission(values.PermissionUserRead))
+	librarian.add(http.MethodPost, "/account/approve", handleApproveUser, requirePermission(values.PermissionUserManage))
+	librarian.add(http.MethodPost, "/account/reject", handleRejectUser, requirePermission(values.PermissionUserManage))
+	librarian.add(http.MethodPost, "/account/suspend", handleSuspendUser, requirePermission(values.PermissionUserManage))
+	librarian.add(http.MethodPost, "/account/unlock", handleUnlockLogin, requirePermission(values.PermissionUserManage))
+
+	librarian.add(http.MethodPost, "/user", handleCreateUser, requirePermission(values.PermissionUserManage))
+	librarian.add(http.MethodPost, "/user/password", handleResetUserPassword, requirePermission(values.PermissionUserManage))
+	librarian.add(http.MethodGet, "/user/all", handleGetAllUsers, requirePermission(values.PermissionUserRead))
+	librarian.add(http.MethodGet, "/user/{id}", handleGetUser, requirePermission(values.PermissionUserRead))
+	librarian.add(http.MethodPut, "/user", handleUpdateUser, requirePermission(values.PermissionUserManage))
+	librarian.add(http.MethodPatch, "/user/role", handleChangeUserRole, requirePermission(values.PermissionRoleManage))
+	librarian.add(http.MethodDelete, "/user/{id}", handleDeactivateUser, requirePermission(values.PermissionUserManage))
+
+	librarian.add(http.MethodGet, "/role", handleGetRoles, requirePermission(values.PermissionUserRead))
+	librarian.add(http.MethodGet, "/role/permissions", handleGetPermissions, requirePermission(values.PermissionUserRead))
+	librarian.add(http.MethodPost, "/role", handleCreateRole, requirePermission(values.PermissionRoleManage))
+	librarian.add(http.MethodPut, "/role", handleUpdateRole, requirePermission(values.PermissionRoleManage))
+	librarian.add(http.MethodDelete, "/role/{id}", handleDeleteRole, requirePermission(values.PermissionRoleManage))
+
+	return rt
+}
+
 func handle(ctx context.Context, request *Request) (interface{}, error) {
-	if !strings.HasPrefix(request.URL.Path, "/api") {
+	ctx = dbserver.PrepareDbRunner(ctx)
+
+	return api.dispatch(ctx, request)
+}
+
+// authorize returns a context that carries the user of the request
+// as a *values.Principal. Access tokens are verified locally, session
+// tokens and API keys against the database. Routes then require
+// permissions of the role of the user.
+func authorize(ctx context.Context, request *Request) (context.Context, error) {
+	var principal *values.Principal
+	var err error
+
+	if core.IsAccessToken(request.Authorization) {
+		principal, err = core.AuthorizeAccessToken(ctx, request.Authorization)
+	} else {
+		principal, err = core.AuthorizeUser(ctx, request.Authorization)
+	}
+
+	if err != nil {
+		return ctx, err
+	}
+
+	return context.WithValue(ctx, values.ContextKeyPrincipal, principal), nil
+}
+
+func handleLogin(ctx context.Context, request *Request) (interface{}, error) {
+	return core.Login(ctx, request.ClientIP, request.Body)
+}
+
+func handleRegister(ctx context.Context, request *Request) (interface{}, error) {
+	return core.Register(ctx, request.Body)
+}
+
+func handleRefreshAccessToken(ctx context.Context, request *Request) (interface{}, error) {
+	return core.RefreshAccessToken(ctx, request.Body)
+}
+
+func handleRequestPasswordReset(ctx context.Context, request *Request) (interface{}, error) {
+	return nil, core.RequestPasswordReset(ctx, request.Body)
+}
+
+func handleResetPassword(ctx context.Context, request *Request) (interface{}, error) {
+	return nil, core.ResetPassword(ctx, request.Body)
+}
+
+func handleStartOIDCLogin(ctx context.Context, request *Request) (interface{}, error) {
+	return core.StartOIDCLogin(ctx)
+}
+
+func handleFinishOIDCLogin(ctx context.Context, request *Request) (interface{}, error) {
+	return core.FinishOIDCLogin(ctx, request.Body)
+}
+
+func handleLogout(ctx context.Context, request *Request) (interface{}, error) {
+	return nil, core.Logout(ctx, request.Authorization)
+}
+
+func handleLogoutEverywhere(ctx context.Context, request *Request) (interface{}, error) {
+	return nil, core.LogoutEverywhere(ctx, request.Authorization)
+}
+
+func handleChangePassword(ctx context.Context, request *Request) (interface{}, error) {
+	return core.ChangePassword(ctx, request.Authorization, request.Body)
+}
+
+func handleGetAPIKeys(ctx context.Context, request *Request) (interface{}, error) {
+	return core.GetAPIKeys(ctx, request.Authorization)
+}
+
+func handleCreateAPIKey(ctx context.Context, request *Request) (interface{}, error) {
+	return core.CreateAPIKey(ctx, request.Authorization, request.Body)
+}
+
+func handleRevokeAPIKey(ctx context.Context, request *Request) (interface{}, error) {
+	return nil, core.RevokeAPIKey(ctx, request.Authorization, request.param("id"))
+}
+
+func handleMemberGetAllBooks(ctx context.Context, request *Request) (interface{}, error) {
+	params, err := getParams(request.URL)
+	if err != nil {
 		return nil, util.ErrInvalidAPICall
 	}
-	uri := request.URL.Path[4:]
 
-	ctx = dbserver.PrepareDbRunner(ctx)
+	return core.GetAllBooks(ctx, params, values.UserRoleMember)
+}
 
-	switch {
-	case strings.HasPrefix(uri, "/open"):
-		return handleOpen(ctx, uri[5:], request)
-	case strings.HasPrefix(uri, "/member"):
-		userRole, err := core.AuthorizeUser(ctx, request.Authorization)
+func handleMemberGetBookByISBN(ctx context.Context, request *Request) (interface{}, error) {
+	return core.GetBookByISBN(ctx, request.param("isbn"), values.UserRoleMember)
+}
 
-		if err != nil {
-			return nil, util.ErrNotAuthenticated
-		}
+func handleMemberGetBook(ctx context.Context, request *Request) (interface{}, error) {
+	return core.GetBook(ctx, request.param("id"), values.UserRoleMember)
+}
 
-		if userRole != values.UserRoleMember {
-			return nil, util.ErrNotAuthenticated
-		}
+func handleBorrowOrReturnBook(ctx context.Context, request *Request) (interface{}, error) {
+	return nil, core.BorrowOrReturnBook(ctx, request.Authorization, request.Body)
+}
 
-		return handleMember(ctx, uri[7:], request)
-	case strings.HasPrefix(uri, "/librarian"):
-		userRole, err := core.AuthorizeUser(ctx, request.Authorization)
+func handleRenewBook(ctx context.Context, request *Request) (interface{}, error) {
+	return core.RenewBook(ctx, request.Authorization, request.Body)
+}
 
-		if err != nil {
-			return nil, util.ErrNotAuthenticated
-		}
+func handlePlaceHold(ctx context.Context, request *Request) (interface{}, error) {
+	return core.PlaceHold(ctx, request.Authorization, request.Body)
+}
 
-		if userRole != values.UserRoleLibrarian {
-			return nil, util.ErrNotAuthenticated
-		}
+func handleGetHold(ctx context.Context, request *Request) (interface{}, error) {
+	return core.GetHold(ctx, request.Authorization, request.param("id"))
+}
 
-		return handleLibrarian(ctx, uri[10:], request)
-	default:
+func handleCancelHold(ctx context.Context, request *Request) (interface{}, error) {
+	return nil, core.CancelHold(ctx, request.Authorization, request.param("id"))
+}
+
+func handleCreateBook(ctx context.Context, request *Request) (interface{}, error) {
+	return core.CreateBook(ctx, request.Body)
+}
+
+func handleImportMARC(ctx context.Context, request *Request) (interface{}, error) {
+	return core.ImportMARC(ctx, request.URL.Query().Get("format"), request.Body)
+}
+
+func handleImportCSV(ctx context.Context, request *Request) (interface{}, error) {
+	dryRun, err := getDryRunParam(request.URL)
+	if err != nil {
 		return nil, util.ErrInvalidAPICall
 	}
+
+	return core.ImportCSV(ctx, dryRun, request.Body)
 }
 
-func handleOpen(ctx context.Context, uri string, request *Request) (response interface{}, err error) {
+func handleExportMARC(ctx context.Context, request *Request) (interface{}, error) {
+	params, err := getParams(request.URL)
+	if err != nil {
+		return nil, util.ErrInvalidAPICall
+	}
+
+	return core.ExportMARC(ctx, request.URL.Query().Get("format"), params)
+}
 
-	if uri == "/login" && request.Method == http.MethodPost {
-		return core.Login(ctx, request.Body)
+func handleExportCSV(ctx context.Context, request *Request) (interface{}, error) {
+	params, err := getParams(request.URL)
+	if err != nil {
+		return nil, util.ErrInvalidAPICall
 	}
 
-	return nil, util.ErrInvalidAPICall
+	return core.ExportCSV(ctx, params)
 }
 
-func handleMember(ctx context.Context, uri string, request *Request) (response interface{}, err error) {
-	if !strings.HasPrefix(uri, "/book") {
+func handleLibrarianGetAllBooks(ctx context.Context, request *Request) (interface{}, error) {
+	params, err := getParams(request.URL)
+	if err != nil {
 		return nil, util.ErrInvalidAPICall
 	}
 
-	uri = uri[5:]
+	return core.GetAllBooks(ctx, params, values.UserRoleLibrarian)
+}
 
-	switch request.Method {
-	case http.MethodGet:
-		if uri == "" {
-			return nil, util.ErrInvalidAPICall
-		}
+func handleLibrarianGetBook(ctx context.Context, request *Request) (interface{}, error) {
+	return core.GetBook(ctx, request.param("id"), values.UserRoleLibrarian)
+}
 
-		if strings.HasPrefix(uri, "/all") {
-			searchTerm, rowOffset, rowLimit, err := getParams(request.URL)
+func handleUpdateBook(ctx context.Context, request *Request) (interface{}, error) {
+	return core.UpdateBook(ctx, request.Body)
+}
 
-			if err != nil {
-				return nil, util.ErrInvalidAPICall
-			}
-			return core.GetAllBooks(ctx, searchTerm, rowOffset, values.UserRoleMember)
-		}
-		return cor.GetBook(ctx, uri[1:])
-	case http.MethodPatch:
-		return nil, core.BorrowOrReturnBook(ctx, request.Authorization, request.Body)
-	default:
+func handleDeleteBook(ctx context.Context, request *Request) (interface{}, error) {
+	return nil, core.DeleteBook(ctx, request.param("id"))
+}
+
+func handleCreateItem(ctx context.Context, request *Request) (interface{}, error) {
+	return core.CreateItem(ctx, request.Body)
+}
+
+func handleGetItem(ctx context.Context, request *Request) (interface{}, error) {
+	return core.GetItem(ctx, request.param("id"))
+}
+
+func handleUpdateItem(ctx context.Context, request *Request) (interface{}, error) {
+	return core.UpdateItem(ctx, request.Body)
+}
+
+func handleDeleteItem(ctx context.Context, request *Request) (interface{}, error) {
+	return nil, core.DeleteItem(ctx, request.param("id"))
+}
+
+func handleCheckoutBook(ctx context.Context, request *Request) (interface{}, error) {
+	return core.CheckoutBook(ctx, request.Authorization, request.Body)
+}
+
+func handleCheckinBook(ctx context.Context, request *Request) (interface{}, error) {
+	return core.CheckinBook(ctx, request.Authorization, request.Body)
+}
+
+func handleGetActiveLoan(ctx context.Context, request *Request) (interface{}, error) {
+	return core.GetActiveLoan(ctx, request.param("id"))
+}
+
+func handleGetAccount(ctx context.Context, request *Request) (interface{}, error) {
+	params, err := getParams(request.URL)
+	if err != nil {
+		return nil, util.ErrInvalidAPICall
+	}
+
+	return core.GetAccount(ctx, request.param("id"), params.RowOffset, params.RowLimit)
+}
+
+func handleRecordPayment(ctx context.Context, request *Request) (interface{}, error) {
+	return core.RecordPayment(ctx, request.Authorization, request.Body)
+}
+
+func handleWaiveCharge(ctx context.Context, request *Request) (interface{}, error) {
+	return core.WaiveCharge(ctx, request.Authorization, request.Body)
+}
+
+func handleGetUsers(ctx context.Context, request *Request) (interface{}, error) {
+	params, err := getParams(request.URL)
+	if err != nil {
+		return nil, util.ErrInvalidAPICall
+	}
+
+	return core.GetUsers(ctx, params.Status, params.RowOffset, params.RowLimit)
+}
+
+func handleApproveUser(ctx context.Context, request *Request) (interface{}, error) {
+	return nil, core.ApproveUser(ctx, request.Body)
+}
+
+func handleRejectUser(ctx context.Context, request *Request) (interface{}, error) {
+	return nil, core.RejectUser(ctx, request.Body)
+}
+
+func handleSuspendUser(ctx context.Context, request *Request) (interface{}, error) {
+	return nil, core.SuspendUser(ctx, request.Body)
+}
+
+func handleUnlockLogin(ctx context.Context, request *Request) (interface{}, error) {
+	return nil, core.UnlockLogin(ctx, request.Body)
+}
+
+func handleCreateUser(ctx context.Context, request *Request) (interface{}, error) {
+	return core.CreateUser(ctx, request.Body)
+}
+
+func handleResetUserPassword(ctx context.Context, request *Request) (interface{}, error) {
+	return nil, core.ResetUserPassword(ctx, request.Body)
+}
+
+func handleGetAllUsers(ctx context.Context, request *Request) (interface{}, error) {
+	params, err := getParams(request.URL)
+	if err != nil {
 		return nil, util.ErrInvalidAPICall
 	}
+
+	return core.GetAllUsers(ctx, params)
+}
+
+func handleGetUser(ctx context.Context, request *Request) (interface{}, error) {
+	return core.GetUser(ctx, request.param("id"))
 }
 
-func getParams(uri *url.URL) (searchTerm string, rowOffset, rowLimit int, err error) {
-	params := uri.Query()
+func handleUpdateUser(ctx context.Context, request *Request) (interface{}, error) {
+	return core.UpdateUser(ctx, request.Body)
+}
 
-	param, ok := params["searchTerm"]
+func handleChangeUserRole(ctx context.Context, request *Request) (interface{}, error) {
+	return core.ChangeUserRole(ctx, request.Authorization, request.Body)
+}
+
+func handleDeactivateUser(ctx context.Context, request *Request) (interface{}, error) {
+	return nil, core.DeactivateUser(ctx, request.Authorization, request.param("id"))
+}
+
+func handleGetRoles(ctx context.Context, request *Request) (interface{}, error) {
+	return core.GetRoles(ctx)
+}
+
+func handleGetPermissions(ctx context.Context, request *Request) (interface{}, error) {
+	return core.GetPermissions(ctx)
+}
+
+func handleCreateRole(ctx context.Context, request *Request) (interface{}, error) {
+	return core.CreateRole(ctx, request.Body)
+}
+
+func handleUpdateRole(ctx context.Context, request *Request) (interface{}, error) {
+	return nil, core.UpdateRole(ctx, request.Body)
+}
+
+func handleDeleteRole(ctx context.Context, request *Request) (interface{}, error) {
+	return nil, core.DeleteRole(ctx, request.param("id"))
+}
+
+func getParams(uri *url.URL) (params *core.ListParams, err error) {
+	params = &core.ListParams{}
+	query := uri.Query()
+
+	param, ok := query["searchTerm"]
 
 	if ok {
-		searchTerm = param[0]
+		params.SearchTerm = param[0]
 	}
 
-	param, ok = params["offset"]
+	// fields limits the search to some columns, as in
+	// fields=title,author
+	param, ok = query["fields"]
+	if ok && param[0] != "" {
+		params.Fields = strings.Split(param[0], ",")
+	}
+
+	// Facet filters, and facets=author,status to count the values of
+	// the facets in the response
+	param, ok = query["author"]
 	if ok {
-		rowOffset, err = strconv.Atoi(param[0])
-		if err != nil {
-			return
-		}
+		params.Author = param[0]
 	}
 
-	param, ok = params["limit"]
+	param, ok = query["publisher"]
 	if ok {
-		rowLimit, err = strconv.Atoi(param[0])
+		params.Publisher = param[0]
+	}
+
+	param, ok = query["status"]
+	if ok {
+		params.Status, err = strconv.Atoi(param[0])
 		if err != nil {
 			return
 		}
 	}
-	return
-}
 
-func handleLibrarian(ctx context.Context, uri string, request *Request) (response interface{}, err error) {
-	if !strings.HasPrefix(uri, "/book") {
-		return nil, util.ErrInvalidAPICall
+	param, ok = query["borrower"]
+	if ok {
+		params.BorrowerID = param[0]
 	}
 
-	uri = uri[5:]
+	param, ok = query["facets"]
+	if ok && param[0] != "" {
+		params.Facets = strings.Split(param[0], ",")
+	}
 
-	switch request.Method {
-	case http.MethodPost:
-		return core.CreateBook(ctx, request.Body)
-	case http.MethodGet:
-		if uri == "" {
-			return nil, util.ErrInvalidAPICall
-		}
+	param, ok = query["sort"]
+	if ok && param[0] != "" {
+		params.Sort = strings.Split(param[0], ",")
+	}
 
-		if strings.HasPrefix(uri, "/all") {
-			searchTerm, rowOffset, rowLimit, err := getParams(request.URL)
-			if err != nil {
-				return nil, util.ErrInvalidAPICall
-			}
+	param, ok = query["cursor"]
+	if ok {
+		params.Cursor = param[0]
+	}
 
-			return core.GetAllBooks(ctx, searchTerm, rowOffset, rowLimit, values.UserRoleLibrarian)
+	param, ok = query["offset"]
+	if ok {
+		params.RowOffset, err = strconv.Atoi(param[0])
+		if err != nil {
+			return
 		}
+	}
 
-		return core.GetBook(ctx, uri[1:])
-	case http.MethodPut:
-		return core.UpdateBook(ctx, request.Body)
-	case http.MethodDelete:
-		if uri == "" {
-			return nil, util.ErrInvalidAPICall
+	param, ok = query["limit"]
+	if ok {
+		params.RowLimit, err = strconv.Atoi(param[0])
+		if err != nil {
+			return
 		}
+	}
+	return
+}
 
-		return nil, core.DeleteBook(ctx, uri[1:])
-	default:
-		return nil, util.ErrInvalidAPICall
+func getDryRunParam(uri *url.URL) (dryRun bool, err error) {
+	param, ok := uri.Query()["dryRun"]
+	if ok {
+		dryRun, err = strconv.ParseBool(param[0])
 	}
+	return
 }
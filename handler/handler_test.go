@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rjseymour66/library-go/config"
+	"github.com/rjseymour66/library-go/core"
+	"github.com/rjseymour66/library-go/data"
+	"github.com/rjseymour66/library-go/util"
+	"github.com/rjseymour66/library-go/values"
+)
+
+const (
+	memberID    = "6a1f0c2e-5b7d-4e3a-9c1f-000000000001"
+	librarianID = "6a1f0c2e-5b7d-4e3a-9c1f-000000000002"
+
+	// userManagerRole can manage users but not roles
+	userManagerRole = 3
+)
+
+// stubUserManagement authorizes every request for a user with the role
+// in its Authorization header, and keeps a member and a librarian in
+// place of the database. It returns the users that were written to.
+func stubUserManagement(t *testing.T) *[]string {
+	authorizeUser := core.AuthorizeUser
+	getAuthPermissionCacheTTL := config.GetAuthPermissionCacheTTL
+	getRolePermissions := data.GetRolePermissions
+	getRole := data.GetRole
+	getUser := data.GetUser
+	getUserIDByUsername := data.GetUserIDByUsername
+	createUser := data.CreateUser
+	updateUser := data.UpdateUser
+	resetUserPassword := data.ResetUserPassword
+	t.Cleanup(func() {
+		core.AuthorizeUser = authorizeUser
+		config.GetAuthPermissionCacheTTL = getAuthPermissionCacheTTL
+		data.GetRolePermissions = getRolePermissions
+		data.GetRole = getRole
+		data.GetUser = getUser
+		data.GetUserIDByUsername = getUserIDByUsername
+		data.CreateUser = createUser
+		data.UpdateUser = updateUser
+		data.ResetUserPassword = resetUserPassword
+	})
+
+	core.AuthorizeUser = func(ctx context.Context, token string) (*values.Principal, error) {
+		role, err := strconv.Atoi(token)
+		return &values.Principal{UserID: "caller", Role: role}, err
+	}
+	config.GetAuthPermissionCacheTTL = func() time.Duration { return 0 }
+	data.GetRolePermissions = func(ctx context.Context) ([]*data.RolePermission, error) {
+		return []*data.RolePermission{
+			{RoleCode: values.UserRoleLibrarian, Permission: values.PermissionUserManage},
+			{RoleCode: values.UserRoleLibrarian, Permission: values.PermissionRoleManage},
+			{RoleCode: userManagerRole, Permission: values.PermissionUserManage},
+		}, nil
+	}
+	data.GetRole = func(ctx context.Context, code int) (*data.RoleEntity, error) {
+		return &data.RoleEntity{Code: int64(code)}, nil
+	}
+
+	users := map[string]*data.UserEntity{
+		memberID:    {UserID: memberID, Role: values.UserRoleMember, AuthSource: values.AuthSourceDatabase},
+		librarianID: {UserID: librarianID, Role: values.UserRoleLibrarian, AuthSource: values.AuthSourceDatabase},
+	}
+	data.GetUser = func(ctx context.Context, userID string) (*data.UserEntity, error) {
+		return users[userID], nil
+	}
+	data.GetUserIDByUsername = func(ctx context.Context, username string) (string, error) {
+		return "", nil
+	}
+
+	written := []string{}
+	data.CreateUser = func(ctx context.Context, username, password, fullName string, email, phone util.NullString, role int) (*data.UserEntity, error) {
+		written = append(written, username)
+		return &data.UserEntity{Username: username, Role: int64(role)}, nil
+	}
+	data.UpdateUser = func(ctx context.Context, userID, fullName string, email, phone util.NullString) (time.Time, error) {
+		written = append(written, userID)
+		return time.Now(), nil
+	}
+	data.ResetUserPassword = func(ctx context.Context, userID, password string) (int64, error) {
+		written = append(written, userID)
+		return 1, nil
+	}
+
+	return &written
+}
+
+// TestUserManagementEscalation checks that a role with user:manage but
+// not role:manage cannot create, take over or change an account with
+// a role other than member
+func TestUserManagementEscalation(t *testing.T) {
+	written := stubUserManagement(t)
+
+	manager := strconv.Itoa(userManagerRole)
+	librarian := strconv.Itoa(values.UserRoleLibrarian)
+
+	tests := []struct {
+		name          string
+		authorization string
+		method        string
+		path          string
+		body          string
+		want          error
+	}{
+		{
+			name:          "create member",
+			authorization: manager,
+			method:        http.MethodPost,
+			path:          "/api/librarian/user",
+			body:          `{"Username":"ann","Password":"Correct-Horse-9","FullName":"Ann","Role":1}`,
+		},
+		{
+			name:          "create librarian",
+			authorization: manager,
+			method:        http.MethodPost,
+			path:          "/api/librarian/user",
+			body:          `{"Username":"eve","Password":"Correct-Horse-9","FullName":"Eve","Role":2}`,
+			want:          util.ErrForbidden,
+		},
+		{
+			name:          "create librarian with role:manage",
+			authorization: librarian,
+			method:        http.MethodPost,
+			path:          "/api/librarian/user",
+			body:          `{"Username":"bob","Password":"Correct-Horse-9","FullName":"Bob","Role":2}`,
+		},
+		{
+			name:          "reset password of member",
+			authorization: manager,
+			method:        http.MethodPost,
+			path:          "/api/librarian/user/password",
+			body:          `{"UserID":"` + memberID + `","Password":"Correct-Horse-9"}`,
+		},
+		{
+			name:          "reset password of librarian",
+			authorization: manager,
+			method:        http.MethodPost,
+			path:          "/api/librarian/user/password",
+			body:          `{"UserID":"` + librarianID + `","Password":"Correct-Horse-9"}`,
+			want:          util.ErrForbidden,
+		},
+		{
+			name:          "reset password of librarian with role:manage",
+			authorization: librarian,
+			method:        http.MethodPost,
+			path:          "/api/librarian/user/password",
+			body:          `{"UserID":"` + librarianID + `","Password":"Correct-Horse-9"}`,
+		},
+		{
+			name:          "update member",
+			authorization: manager,
+			method:        http.MethodPut,
+			path:          "/api/librarian/user",
+			body:          `{"UserID":"` + memberID + `","FullName":"Ann","Email":"ann@example.com"}`,
+		},
+		{
+			name:          "update librarian",
+			authorization: manager,
+			method:        http.MethodPut,
+			path:          "/api/librarian/user",
+			body:          `{"UserID":"` + librarianID + `","FullName":"Eve","Email":"eve@example.com"}`,
+			want:          util.ErrForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			*written = (*written)[:0]
+
+			parsed, err := url.Parse(test.path)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+
+			_, err = api.dispatch(context.Background(), &Request{
+				Authorization: test.authorization,
+				Body:          strings.NewReader(test.body),
+				URL:           parsed,
+				Method:        test.method,
+			})
+
+			if _, _, _, errorType := util.IsError(err); errorType != test.want {
+				t.Fatalf("dispatch: got %v, want %v", err, test.want)
+			}
+
+			if test.want == nil && len(*written) != 1 {
+				t.Errorf("dispatch: wrote %v, want one write", *written)
+			}
+			if test.want != nil && len(*written) != 0 {
+				t.Errorf("dispatch: wrote %v, want none", *written)
+			}
+		})
+	}
+}
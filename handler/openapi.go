@@ -0,0 +1,337 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/rjseymour66/library-go/core"
+	"github.com/rjseymour66/library-go/openapi"
+	"github.com/rjseymour66/library-go/util"
+)
+
+// routeDoc documents a route. request and response name the types of
+// the JSON bodies, as core.APIType knows them. Bodies that are not JSON
+// have a media type instead.
+type routeDoc struct {
+	summary           string
+	request           string
+	requestMediaType  string
+	response          string
+	responseMediaType string
+	query             []string
+}
+
+// listQuery are the query parameters of the book listings
+var listQuery = []string{"searchTerm", "fields", "author", "publisher", "status", "borrower", "facets", "sort", "cursor", "offset", "limit"}
+
+// routeDocs holds the documentation of every route by method and
+// pattern. checkAPIDoc fails for routes that are missing from it.
+var routeDocs = map[string]routeDoc{
+	"GET /api/openapi.json": {summary: "Get this OpenAPI document", response: "Document"},
+
+	"POST /api/open/login":           {summary: "Start a session with a username and password", request: "loginRequest", response: "loginResponse"},
+	"POST /api/open/register":        {summary: "Register a member account, which a librarian approves", request: "registerRequest", response: "registerResponse"},
+	"POST /api/open/refresh":         {summary: "Issue an access token for a session", request: "refreshAccessTokenRequest", response: "refreshAccessTokenResponse"},
+	"POST /api/open/password/forgot": {summary: "Send a password reset token", request: "requestPasswordResetRequest"},
+	"POST /api/open/password/reset":  {summary: "Set a password with a reset token", request: "resetPasswordRequest"},
+	"POST /api/open/oidc/start":      {summary: "Start an OpenID Connect sign-in", response: "startOIDCLoginResponse"},
+	"POST /api/open/oidc/callback":   {summary: "Finish an OpenID Connect sign-in and start a session", request: "finishOIDCLoginRequest", response: "loginResponse"},
+
+	"DELETE /api/session":     {summary: "End the session"},
+	"DELETE /api/session/all": {summary: "End every session of the user"},
+	"PUT /api/password":       {summary: "Change the password of the user", request: "changePasswordRequest", response: "changePasswordResponse"},
+	"GET /api/apikey":         {summary: "List the API keys of the user", response: "[]APIKeyEntity"},
+	"POST /api/apikey":        {summary: "Create an API key", request: "createAPIKeyRequest", response: "createAPIKeyResponse"},
+	"DELETE /api/apikey/{id}": {summary: "Revoke an API key"},
+
+	"GET /api/member/book/all":         {summary: "List books", response: "getAllResponse", query: listQuery},
+	"GET /api/member/book/isbn/{isbn}": {summary: "Get a book by ISBN", response: "getBookResponse"},
+	"GET /api/member/book/{id}":        {summary: "Get a book", response: "getBookResponse"},
+	"PATCH /api/member/book":           {summary: "Borrow or return a book", request: "borrowOrReturnRequest"},
+	"POST /api/member/book/renew":      {summary: "Renew a loan", request: "renewRequest", response: "renewResponse"},
+	"POST /api/member/hold":            {summary: "Place a hold on a book", request: "placeHoldRequest", response: "holdResponse"},
+	"GET /api/member/hold/{id}":        {summary: "Get the hold on a book", response: "holdResponse"},
+	"DELETE /api/member/hold/{id}":     {summary: "Cancel the hold on a book"},
+
+	"POST /api/librarian/book":             {summary: "Create a book", request: "createBookRequest", response: "BookEntity"},
+	"POST /api/librarian/book/import/marc": {summary: "Import books from MARC records", requestMediaType: "application/marc", response: "marcImportResponse", query: []string{"format"}},
+	"POST /api/librarian/book/import/csv":  {summary: "Import books from CSV", requestMediaType: "text/csv", response: "csvImportResponse", query: []string{"dryRun"}},
+	"GET /api/librarian/book/export/marc":  {summary: "Export books as MARC records", responseMediaType: "application/marc", query: append([]string{"format"}, listQuery...)},
+	"GET /api/librarian/book/export/csv":   {summary: "Export books as CSV", responseMediaType: "text/csv", query: listQuery},
+	"GET /api/librarian/book/all":          {summary: "List books with their copies", response: "getAllResponse", query: listQuery},
+	"GET /api/librarian/book/{id}":         {summary: "Get a book with its items", response: "getBookResponse"},
+	"PUT /api/librarian/book":              {summary: "Update a book", request: "updateBookRequest", response: "updateBookResponse"},
+	"DELETE /api/librarian/book/{id}":      {summary: "Delete a book"},
+
+	"POST /api/librarian/item":        {summary: "Create an item", request: "createItemRequest", response: "ItemEntity"},
+	"GET /api/librarian/item/{id}":    {summary: "Get an item", response: "ItemEntity"},
+	"PUT /api/librarian/item":         {summary: "Update an item", request: "updateItemRequest", response: "updateItemResponse"},
+	"DELETE /api/librarian/item/{id}": {summary: "Delete an item"},
+
+	"POST /api/librarian/loan":     {summary: "Check out an item", request: "checkoutRequest", response: "LoanEntity"},
+	"PATCH /api/librarian/loan":    {summary: "Check in an item", request: "checkinRequest", response: "checkinResponse"},
+	"GET /api/librarian/loan/{id}": {summary: "Get the active loan of an item", response: "LoanEntity"},
+
+	"GET /api/librarian/ledger/{id}":     {summary: "Get the account of a user", response: "getAccountResponse", query: []string{"offset", "limit"}},
+	"POST /api/librarian/ledger/payment": {summary: "Record a payment", request: "paymentRequest", response: "creditResponse"},
+	"POST /api/librarian/ledger/waiver":  {summary: "Waive a charge", request: "waiverRequest", response: "creditResponse"},
+
+	"GET /api/librarian/account":          {summary: "List users by status", response: "getUsersResponse", query: []string{"status", "offset", "limit"}},
+	"POST /api/librarian/account/approve": {summary: "Approve a pending account", request: "changeUserStatusRequest"},
+	"POST /api/librarian/account/reject":  {summary: "Reject a pending account", request: "changeUserStatusRequest"},
+	"POST /api/librarian/account/suspend": {summary: "Suspend an active account", request: "changeUserStatusRequest"},
+	"POST /api/librarian/account/unlock":  {summary: "Lift a login lockout", request: "unlockLoginRequest"},
+
+	"POST /api/librarian/user":          {summary: "Create a user", request: "createUserRequest", response: "UserEntity"},
+	"POST /api/librarian/user/password": {summary: "Reset the password of a user", request: "resetUserPasswordRequest"},
+	"GET /api/librarian/user/all":       {summary: "List users", response: "getAllResponse", query: []string{"searchTerm", "offset", "limit"}},
+	"GET /api/librarian/user/{id}":      {summary: "Get a user", response: "UserEntity"},
+	"PUT /api/librarian/user":           {summary: "Update a user", request: "updateUserRequest", response: "updateUserResponse"},
+	"PATCH /api/librarian/user/role":    {summary: "Change the role of a user", request: "changeUserRoleRequest", response: "updateUserResponse"},
+	"DELETE /api/librarian/user/{id}":   {summary: "Deactivate a user"},
+
+	"GET /api/librarian/role":             {summary: "List roles", response: "[]RoleEntity"},
+	"GET /api/librarian/role/permissions": {summary: "List permissions", response: "[]PermissionEntity"},
+	"POST /api/librarian/role":            {summary: "Create a role", request: "roleRequest", response: "createRoleResponse"},
+	"PUT /api/librarian/role":             {summary: "Update a role", request: "roleRequest"},
+	"DELETE /api/librarian/role/{id}":     {summary: "Delete a role"},
+}
+
+// queryParams documents the query parameters the routes read
+var queryParams = map[string]*openapi.Parameter{
+	"searchTerm": {Description: "Text to search for", Schema: &openapi.Schema{Type: "string"}},
+	"fields":     {Description: "Comma-separated columns the search is limited to: title, author, publisher, description", Schema: &openapi.Schema{Type: "string"}},
+	"author":     {Description: "Only books by the author", Schema: &openapi.Schema{Type: "string"}},
+	"publisher":  {Description: "Only books of the publisher", Schema: &openapi.Schema{Type: "string"}},
+	"status":     {Description: "Only entries with the status", Schema: &openapi.Schema{Type: "integer"}},
+	"borrower":   {Description: "Only books the user borrowed", Schema: &openapi.Schema{Type: "string"}},
+	"facets":     {Description: "Comma-separated facets to count, such as author,status", Schema: &openapi.Schema{Type: "string"}},
+	"sort":       {Description: "Comma-separated sort keys, each descending if it starts with \"-\"", Schema: &openapi.Schema{Type: "string"}},
+	"cursor":     {Description: "NextCursor of the previous page, instead of offset", Schema: &openapi.Schema{Type: "string"}},
+	"offset":     {Description: "Number of rows to skip", Schema: &openapi.Schema{Type: "integer"}},
+	"limit":      {Description: "Maximum number of rows", Schema: &openapi.Schema{Type: "integer"}},
+	"format":     {Description: "MARC format: marc21 or marcxml", Schema: &openapi.Schema{Type: "string"}},
+	"dryRun":     {Description: "Validate the rows without creating books", Schema: &openapi.Schema{Type: "boolean"}},
+}
+
+var (
+	// CheckAPIDoc returns an error if a route has no documentation, or
+	// its documentation names a body type the core does not have
+	CheckAPIDoc = checkAPIDoc
+)
+
+// apiDoc is the OpenAPI document of the routes, built with them
+var apiDoc *openapi.Document
+
+// apiDocErr is the reason apiDoc could not be built
+var apiDocErr error
+
+func checkAPIDoc() error {
+	return apiDocErr
+}
+
+func handleOpenAPI(ctx context.Context, request *Request) (interface{}, error) {
+	if apiDoc == nil {
+		return nil, util.ErrInternal
+	}
+
+	return apiDoc, nil
+}
+
+// newAPIDoc builds the OpenAPI document of the routes. It fails with
+// every route that is missing from routeDocs, every entry of routeDocs
+// without a route, and every type name that core.APIType does not know.
+func newAPIDoc(rt *router) (doc *openapi.Document, err error) {
+	doc = openapi.New(openapi.Info{
+		Title:   "Library API",
+		Version: "1.0.0",
+	})
+
+	doc.Components.SecuritySchemes["token"] = &openapi.SecurityScheme{
+		Type:        "apiKey",
+		Name:        "Authorization",
+		In:          "header",
+		Description: "A session token, access token or API key",
+	}
+
+	errorResponse := &openapi.Response{
+		Description: "Error",
+		Content:     openapi.JSONContent(doc.SchemaOf(util.ErrorResponse{})),
+	}
+
+	var problems []string
+	documented := make(map[string]bool)
+
+	for _, r := range rt.routes {
+		key := r.method + " " + r.pattern
+		documented[key] = true
+
+		entry, ok := routeDocs[key]
+		if !ok {
+			problems = append(problems, "route "+key+" is not documented")
+			continue
+		}
+
+		operation, typeProblems := newOperation(doc, r, &entry)
+		for _, problem := range typeProblems {
+			problems = append(problems, key+": "+problem)
+		}
+
+		operation.Responses["default"] = errorResponse
+		doc.AddOperation(r.method, r.pattern, operation)
+	}
+
+	for key := range routeDocs {
+		if !documented[key] {
+			problems = append(problems, "documented route "+key+" does not exist")
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("API documentation: %v", strings.Join(problems, "; "))
+	}
+
+	return doc, nil
+}
+
+func newOperation(doc *openapi.Document, r *route, entry *routeDoc) (operation *openapi.Operation, problems []string) {
+	operation = &openapi.Operation{
+		OperationID: operationID(r),
+		Summary:     entry.summary,
+		Tags:        []string{r.segments[1]},
+		Responses:   make(map[string]*openapi.Response),
+	}
+
+	if r.authenticated {
+		operation.Security = []map[string][]string{{"token": {}}}
+	}
+
+	if len(r.permissions) > 0 {
+		operation.Description = "Requires the permissions " + strings.Join(r.permissions, ", ")
+	}
+
+	for _, segment := range r.segments {
+		if name, ok := paramName(segment); ok {
+			operation.Parameters = append(operation.Parameters, &openapi.Parameter{
+				Name:     name,
+				In:       "path",
+				Required: true,
+				Schema:   &openapi.Schema{Type: "string"},
+			})
+		}
+	}
+
+	for _, name := range entry.query {
+		param, ok := queryParams[name]
+		if !ok {
+			problems = append(problems, "query parameter "+name+" is not documented")
+			continue
+		}
+
+		operation.Parameters = append(operation.Parameters, &openapi.Parameter{
+			Name:        name,
+			In:          "query",
+			Description: param.Description,
+			Schema:      param.Schema,
+		})
+	}
+
+	switch {
+	case entry.request != "":
+		schema, ok := typeSchema(doc, entry.request)
+		if !ok {
+			problems = append(problems, "request type "+entry.request+" does not exist")
+		}
+		operation.RequestBody = &openapi.RequestBody{Required: true, Content: openapi.JSONContent(schema)}
+	case entry.requestMediaType != "":
+		operation.RequestBody = &openapi.RequestBody{
+			Required: true,
+			Content:  map[string]*openapi.MediaType{entry.requestMediaType: {}},
+		}
+	}
+
+	success := &openapi.Response{Description: "Success"}
+
+	switch {
+	case entry.response != "":
+		schema, ok := typeSchema(doc, entry.response)
+		if !ok {
+			problems = append(problems, "response type "+entry.response+" does not exist")
+		}
+		success.Content = openapi.JSONContent(schema)
+
+		if isPaged(entry.response) {
+			success.Headers = map[string]*openapi.Header{
+				"Link": {
+					Description: "RFC 8288 links to the first, previous and next pages",
+					Schema:      &openapi.Schema{Type: "string"},
+				},
+			}
+		}
+	case entry.responseMediaType != "":
+		success.Content = map[string]*openapi.MediaType{entry.responseMediaType: {}}
+	}
+
+	operation.Responses["200"] = success
+	return
+}
+
+// typeSchema returns the schema of the type with the name, which is
+// "[]" followed by the name for a list of the type. The document type
+// describes this document.
+func typeSchema(doc *openapi.Document, name string) (schema *openapi.Schema, ok bool) {
+	if strings.HasPrefix(name, "[]") {
+		schema, ok = typeSchema(doc, name[2:])
+		return &openapi.Schema{Type: "array", Items: schema}, ok
+	}
+
+	if name == "Document" {
+		return &openapi.Schema{Type: "object", Description: "An OpenAPI 3.1 document"}, true
+	}
+
+	value := core.APIType(name)
+	if value == nil {
+		return &openapi.Schema{}, false
+	}
+
+	return doc.SchemaOf(value), true
+}
+
+// isPaged returns whether the server sends the Link header with the
+// response type.
+func isPaged(name string) bool {
+	value := core.APIType(name)
+	if value == nil {
+		return false
+	}
+
+	pagedType := reflect.TypeOf((*util.PagedResponse)(nil)).Elem()
+	return reflect.PtrTo(reflect.TypeOf(value)).Implements(pagedType)
+}
+
+// operationID joins the method and the literal segments of the pattern
+// after /api, as in getLibrarianBookAll.
+func operationID(r *route) string {
+	id := strings.ToLower(r.method)
+
+	for _, segment := range r.segments[1:] {
+		name, isParam := paramName(segment)
+		if isParam {
+			segment = "by-" + name
+		}
+
+		for _, word := range strings.FieldsFunc(segment, isSeparator) {
+			id += strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+
+	return id
+}
+
+func isSeparator(r rune) bool {
+	return r == '-' || r == '.' || r == '_'
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestRouteDocsCoverRoutes(t *testing.T) {
+	rt := newAPIRouter()
+
+	routes := make(map[string]bool)
+	for _, r := range rt.routes {
+		key := r.method + " " + r.pattern
+		routes[key] = true
+
+		if _, ok := routeDocs[key]; !ok {
+			t.Errorf("route %v has no entry in routeDocs", key)
+		}
+	}
+
+	var stale []string
+	for key := range routeDocs {
+		if !routes[key] {
+			stale = append(stale, key)
+		}
+	}
+
+	sort.Strings(stale)
+	for _, key := range stale {
+		t.Errorf("routeDocs entry %v has no route", key)
+	}
+}
+
+func TestNewAPIDoc(t *testing.T) {
+	doc, err := newAPIDoc(newAPIRouter())
+	if err != nil {
+		t.Fatalf("newAPIDoc: %v", err)
+	}
+
+	for key := range routeDocs {
+		parts := strings.SplitN(key, " ", 2)
+		if doc.Operation(parts[0], parts[1]) == nil {
+			t.Errorf("document has no operation for %v", key)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/rjseymour66/library-go/core"
+	"github.com/rjseymour66/library-go/util"
+)
+
+// routeHandler handles the requests of a route. The values of the
+// {name} segments of the route pattern are read with request.param.
+type routeHandler func(ctx context.Context, request *Request) (interface{}, error)
+
+// middleware wraps the handler of a route, such as to authenticate the
+// request before the handler runs. The other fields tell what it
+// requires of the request, for the API documentation.
+type middleware struct {
+	wrap          func(next routeHandler) routeHandler
+	authenticates bool
+	permission    string
+}
+
+type route struct {
+	method   string
+	pattern  string
+	segments []string
+	handle   routeHandler
+
+	// authenticated tells whether the route requires credentials, and
+	// permissions lists the permissions it requires
+	authenticated bool
+	permissions   []string
+}
+
+// router dispatches requests to the route whose method is the method
+// of the request and whose pattern matches the path segment by segment.
+// A {name} segment of a pattern matches any one segment of the path.
+type router struct {
+	routes []*route
+}
+
+// routeGroup adds routes under a common prefix that share middleware.
+type routeGroup struct {
+	router      *router
+	prefix      string
+	middlewares []middleware
+}
+
+func (rt *router) group(prefix string, middlewares ...middleware) *routeGroup {
+	return &routeGroup{rt, prefix, middlewares}
+}
+
+// add adds a route. Middlewares run in order, the first one outermost.
+func (rt *router) add(method, pattern string, handle routeHandler, middlewares ...middleware) {
+	r := &route{
+		method:   method,
+		pattern:  pattern,
+		segments: splitPath(pattern),
+	}
+
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handle = middlewares[i].wrap(handle)
+
+		if middlewares[i].authenticates {
+			r.authenticated = true
+		}
+		if middlewares[i].permission != "" {
+			r.permissions = append([]string{middlewares[i].permission}, r.permissions...)
+		}
+	}
+
+	r.handle = handle
+	rt.routes = append(rt.routes, r)
+}
+
+// add adds a route under the prefix of the group. The middlewares of
+// the group run before the ones of the route.
+func (g *routeGroup) add(method, pattern string, handle routeHandler, middlewares ...middleware) {
+	all := make([]middleware, 0, len(g.middlewares)+len(middlewares))
+	all = append(all, g.middlewares...)
+	all = append(all, middlewares...)
+
+	g.router.add(method, g.prefix+pattern, handle, all...)
+}
+
+// dispatch runs the route of the request. When routes match the path
+// but none has the method, OPTIONS requests get the allowed methods
+// and other requests ErrMethodNotAllowed with them. When two patterns
+// match, the one with a literal segment where the other has a {name}
+// segment wins, so that /book/all is not read as the book "all".
+func (rt *router) dispatch(ctx context.Context, request *Request) (interface{}, error) {
+	segments := splitPath(request.URL.Path)
+
+	var allowed []string
+	var matched *route
+	var matchedParams map[string]string
+
+	for _, r := range rt.routes {
+		params, ok := r.match(segments)
+		if !ok {
+			continue
+		}
+
+		if !hasString(allowed, r.method) {
+			allowed = append(allowed, r.method)
+		}
+
+		if r.method == request.Method && (matched == nil || r.moreSpecific(matched)) {
+			matched = r
+			matchedParams = params
+		}
+	}
+
+	if matched != nil {
+		request.params = matchedParams
+		return matched.handle(ctx, request)
+	}
+
+	if len(allowed) == 0 {
+		return nil, util.ErrInvalidAPICall
+	}
+
+	allowed = append(allowed, http.MethodOptions)
+	response := &util.AllowResponse{Methods: allowed}
+
+	if request.Method == http.MethodOptions {
+		return response, nil
+	}
+
+	return response, util.ErrMethodNotAllowed
+}
+
+// match returns the values of the {name} segments if the pattern of
+// the route matches the path segments.
+func (r *route) match(segments []string) (params map[string]string, ok bool) {
+	if len(segments) != len(r.segments) {
+		return nil, false
+	}
+
+	for i, segment := range r.segments {
+		if name, isParam := paramName(segment); isParam {
+			if segments[i] == "" {
+				return nil, false
+			}
+
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[name] = segments[i]
+			continue
+		}
+
+		if segment != segments[i] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+// moreSpecific returns whether the first segment in which the patterns
+// of the routes differ is a literal in r and a {name} in other.
+func (r *route) moreSpecific(other *route) bool {
+	for i, segment := range r.segments {
+		_, isParam := paramName(segment)
+		_, otherIsParam := paramName(other.segments[i])
+
+		if isParam != otherIsParam {
+			return otherIsParam
+		}
+	}
+
+	return false
+}
+
+func paramName(segment string) (string, bool) {
+	if len(segment) > 2 && strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		return segment[1 : len(segment)-1], true
+	}
+	return "", false
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+func hasString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticated runs the handler with the principal of the request in
+// the context, and rejects requests without valid credentials.
+var authenticated = middleware{
+	wrap: func(next routeHandler) routeHandler {
+		return func(ctx context.Context, request *Request) (interface{}, error) {
+			ctx, err := authorize(ctx, request)
+			if err != nil {
+				return nil, util.ErrNotAuthenticated
+			}
+
+			return next(ctx, request)
+		}
+	},
+	authenticates: true,
+}
+
+// requirePermission runs the handler only if the principal has the
+// permission. It goes after authenticated.
+func requirePermission(permission string) middleware {
+	return middleware{
+		wrap: func(next routeHandler) routeHandler {
+			return func(ctx context.Context, request *Request) (interface{}, error) {
+				err := core.RequirePermission(ctx, permission)
+				if err != nil {
+					return nil, err
+				}
+
+				return next(ctx, request)
+			}
+		},
+		permission: permission,
+	}
+}
@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/rjseymour66/library-go/util"
+)
+
+// newTestRouter adds /book/{id} before /book/all, so that the
+// precedence of literal segments does not depend on the order
+func newTestRouter() *router {
+	rt := &router{}
+
+	respond := func(name string) routeHandler {
+		return func(ctx context.Context, request *Request) (interface{}, error) {
+			return name + " " + request.param("id") + request.param("loanID"), nil
+		}
+	}
+
+	rt.add(http.MethodGet, "/book/{id}", respond("get book"))
+	rt.add(http.MethodPut, "/book/{id}", respond("update book"))
+	rt.add(http.MethodDelete, "/book/{id}", respond("delete book"))
+	rt.add(http.MethodGet, "/book/all", respond("all books"))
+	rt.add(http.MethodGet, "/book/{id}/items", respond("items"))
+	rt.add(http.MethodGet, "/loan/{loanID}", respond("loan"))
+	rt.add(http.MethodPost, "/loan/renew", respond("renew"))
+
+	return rt
+}
+
+func dispatch(t *testing.T, rt *router, method, path string) (interface{}, error) {
+	t.Helper()
+
+	parsed, err := url.Parse(path)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	return rt.dispatch(context.Background(), &Request{Method: method, URL: parsed})
+}
+
+func TestDispatch(t *testing.T) {
+	rt := newTestRouter()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   string
+	}{
+		{name: "param", method: http.MethodGet, path: "/book/42", want: "get book 42"},
+		{name: "method of param route", method: http.MethodDelete, path: "/book/42", want: "delete book 42"},
+		{name: "literal wins over param", method: http.MethodGet, path: "/book/all", want: "all books "},
+		{name: "method only on param route", method: http.MethodPut, path: "/book/all", want: "update book all"},
+		{name: "nested param", method: http.MethodGet, path: "/book/42/items", want: "items 42"},
+		{name: "trailing slash", method: http.MethodGet, path: "/book/42/", want: "get book 42"},
+		{name: "other param name", method: http.MethodGet, path: "/loan/7", want: "loan 7"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := dispatch(t, rt, test.method, test.path)
+			if err != nil {
+				t.Fatalf("dispatch: %v", err)
+			}
+			if response != test.want {
+				t.Errorf("dispatch: got %q, want %q", response, test.want)
+			}
+		})
+	}
+}
+
+func TestDispatchMethodNotAllowed(t *testing.T) {
+	rt := newTestRouter()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   error
+		allow  []string
+	}{
+		{
+			name:   "param route",
+			method: http.MethodPost,
+			path:   "/book/42",
+			want:   util.ErrMethodNotAllowed,
+			allow:  []string{http.MethodGet, http.MethodPut, http.MethodDelete, http.MethodOptions},
+		},
+		{
+			name:   "literal and param routes",
+			method: http.MethodDelete,
+			path:   "/loan/renew",
+			want:   util.ErrMethodNotAllowed,
+			allow:  []string{http.MethodGet, http.MethodPost, http.MethodOptions},
+		},
+		{
+			name:   "OPTIONS",
+			method: http.MethodOptions,
+			path:   "/book/42/items",
+			allow:  []string{http.MethodGet, http.MethodOptions},
+		},
+		{
+			name:   "OPTIONS of literal and param routes",
+			method: http.MethodOptions,
+			path:   "/book/all",
+			allow:  []string{http.MethodGet, http.MethodPut, http.MethodDelete, http.MethodOptions},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := dispatch(t, rt, test.method, test.path)
+			if err != test.want {
+				t.Fatalf("dispatch: got %v, want %v", err, test.want)
+			}
+
+			allow, ok := response.(*util.AllowResponse)
+			if !ok {
+				t.Fatalf("dispatch: got response %#v, want *util.AllowResponse", response)
+			}
+			if !reflect.DeepEqual(allow.Methods, test.allow) {
+				t.Errorf("dispatch: got Allow %v, want %v", allow.Methods, test.allow)
+			}
+		})
+	}
+}
+
+func TestDispatchInvalidAPICall(t *testing.T) {
+	rt := newTestRouter()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+	}{
+		{name: "unknown path", method: http.MethodGet, path: "/author/42"},
+		{name: "unknown OPTIONS path", method: http.MethodOptions, path: "/author/42"},
+		{name: "prefix of route", method: http.MethodGet, path: "/book"},
+		{name: "longer than route", method: http.MethodGet, path: "/book/42/items/1"},
+		{name: "empty param segment", method: http.MethodGet, path: "/book//items"},
+		{name: "root", method: http.MethodGet, path: "/"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := dispatch(t, rt, test.method, test.path)
+			if err != util.ErrInvalidAPICall {
+				t.Errorf("dispatch: got %v, %v, want ErrInvalidAPICall", response, err)
+			}
+		})
+	}
+}
+
+func TestRouteMatch(t *testing.T) {
+	r := &route{segments: splitPath("/book/{id}/items/{itemID}")}
+
+	tests := []struct {
+		path   string
+		params map[string]string
+		ok     bool
+	}{
+		{path: "/book/42/items/7", params: map[string]string{"id": "42", "itemID": "7"}, ok: true},
+		{path: "/book/42/items/", ok: false},
+		{path: "/book//items/7", ok: false},
+		{path: "/book/42/loans/7", ok: false},
+		{path: "/book/42/items", ok: false},
+	}
+
+	for _, test := range tests {
+		params, ok := r.match(splitPath(test.path))
+		if ok != test.ok || !reflect.DeepEqual(params, test.params) {
+			t.Errorf("match(%q): got %v, %v, want %v, %v", test.path, params, ok, test.params, test.ok)
+		}
+	}
+}
+
+func TestRouteMoreSpecific(t *testing.T) {
+	tests := []struct {
+		pattern string
+		other   string
+		want    bool
+	}{
+		{pattern: "/book/all", other: "/book/{id}", want: true},
+		{pattern: "/book/{id}", other: "/book/all", want: false},
+		{pattern: "/book/{id}", other: "/book/{bookID}", want: false},
+		{pattern: "/user/{id}/loans", other: "/{kind}/{id}/loans", want: true},
+		{pattern: "/{kind}/all", other: "/user/{id}", want: false},
+	}
+
+	for _, test := range tests {
+		r := &route{segments: splitPath(test.pattern)}
+		other := &route{segments: splitPath(test.other)}
+
+		if got := r.moreSpecific(other); got != test.want {
+			t.Errorf("moreSpecific(%v, %v): got %v, want %v", test.pattern, test.other, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+// minSecretLength is the shortest HS256 secret accepted, the size of
+// the SHA-256 output
+const minSecretLength = 32
+
+// Key is a key that signs or verifies tokens. Keys loaded from an
+// Ed25519 public key can only verify.
+type Key struct {
+	ID        string
+	Algorithm string
+
+	secret     []byte
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+}
+
+// LoadKey reads the key with the kid id from a file. A PEM file holds
+// an Ed25519 key, either a PKCS #8 private key or a PKIX public key.
+// Any other file holds an HS256 secret of at least 32 bytes.
+func LoadKey(id, fileName string) (key *Key, err error) {
+	raw, err := os.ReadFile(fileName)
+	if err != nil {
+		return
+	}
+
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return NewHS256Key(id, bytes.TrimRight(raw, "\r\n"))
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+
+		privateKey, ok := parsed.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("key %q: %w", id, ErrUnsupportedKey)
+		}
+
+		key = &Key{
+			ID:         id,
+			Algorithm:  AlgorithmEdDSA,
+			privateKey: privateKey,
+			publicKey:  privateKey.Public().(ed25519.PublicKey),
+		}
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+
+		publicKey, ok := parsed.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("key %q: %w", id, ErrUnsupportedKey)
+		}
+
+		key = &Key{
+			ID:        id,
+			Algorithm: AlgorithmEdDSA,
+			publicKey: publicKey,
+		}
+	default:
+		return nil, fmt.Errorf("key %q: %w", id, ErrUnsupportedKey)
+	}
+
+	return
+}
+
+// NewHS256Key returns a key that signs and verifies with an HMAC
+// SHA-256 secret
+func NewHS256Key(id string, secret []byte) (key *Key, err error) {
+	if len(secret) < minSecretLength {
+		return nil, fmt.Errorf("key %q: %w", id, ErrShortSecret)
+	}
+
+	key = &Key{
+		ID:        id,
+		Algorithm: AlgorithmHS256,
+		secret:    secret,
+	}
+	return
+}
+
+// CanSign returns whether the key can sign tokens
+func (key *Key) CanSign() bool {
+	return key.secret != nil || key.privateKey != nil
+}
@@ -0,0 +1,150 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeKeyFile(t *testing.T, name string, raw []byte) string {
+	t.Helper()
+
+	fileName := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(fileName, raw, 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return fileName
+}
+
+func encodePEM(t *testing.T, blockType string, der []byte, err error) []byte {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+}
+
+func TestNewHS256Key(t *testing.T) {
+	tests := []struct {
+		name   string
+		length int
+		want   error
+	}{
+		{name: "minimum length", length: minSecretLength},
+		{name: "longer", length: 64},
+		{name: "one byte short", length: minSecretLength - 1, want: ErrShortSecret},
+		{name: "empty", length: 0, want: ErrShortSecret},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, err := NewHS256Key("hs", bytes.Repeat([]byte("s"), test.length))
+			if !errors.Is(err, test.want) {
+				t.Fatalf("NewHS256Key: got %v, want %v", err, test.want)
+			}
+			if err == nil && (key.Algorithm != AlgorithmHS256 || !key.CanSign()) {
+				t.Errorf("NewHS256Key: got %+v", key)
+			}
+		})
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	privatePEM := encodePEM(t, "PRIVATE KEY", privateDER, err)
+	publicDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	publicPEM := encodePEM(t, "PUBLIC KEY", publicDER, err)
+	ecDER, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	ecPEM := encodePEM(t, "PRIVATE KEY", ecDER, err)
+
+	tests := []struct {
+		name          string
+		raw           []byte
+		wantAlgorithm string
+		wantCanSign   bool
+		want          error
+	}{
+		{name: "Ed25519 private key", raw: privatePEM, wantAlgorithm: AlgorithmEdDSA, wantCanSign: true},
+		{name: "Ed25519 public key", raw: publicPEM, wantAlgorithm: AlgorithmEdDSA},
+		{name: "HS256 secret", raw: bytes.Repeat([]byte("s"), minSecretLength), wantAlgorithm: AlgorithmHS256, wantCanSign: true},
+		{name: "HS256 secret with newline", raw: append(bytes.Repeat([]byte("s"), minSecretLength), "\r\n"...), wantAlgorithm: AlgorithmHS256, wantCanSign: true},
+		{name: "short secret with newline", raw: append(bytes.Repeat([]byte("s"), minSecretLength-1), '\n'), want: ErrShortSecret},
+		{name: "ECDSA private key", raw: ecPEM, want: ErrUnsupportedKey},
+		{name: "other PEM block", raw: encodePEM(t, "CERTIFICATE", []byte{1, 2, 3}, nil), want: ErrUnsupportedKey},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, err := LoadKey("key-1", writeKeyFile(t, "key-1", test.raw))
+			if !errors.Is(err, test.want) {
+				t.Fatalf("LoadKey: got %v, want %v", err, test.want)
+			}
+			if err != nil {
+				return
+			}
+
+			if key.ID != "key-1" || key.Algorithm != test.wantAlgorithm || key.CanSign() != test.wantCanSign {
+				t.Errorf("LoadKey: got %v %v, can sign %v", key.ID, key.Algorithm, key.CanSign())
+			}
+		})
+	}
+}
+
+func TestLoadKeyPublicKeyVerifies(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	publicDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	key, err := LoadKey("ed", writeKeyFile(t, "ed.pem", encodePEM(t, "PUBLIC KEY", publicDER, err)))
+	if err != nil {
+		t.Fatalf("LoadKey: %v", err)
+	}
+
+	signer := newKeySet(t, "ed", &Key{ID: "ed", Algorithm: AlgorithmEdDSA, privateKey: privateKey, publicKey: publicKey})
+	token := signClaims(t, signer, newClaims())
+
+	if _, err := newKeySet(t, "hs", newHS256Key(t, "hs"), key).Verify(token, testNow); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+}
+
+func TestNewKeySet(t *testing.T) {
+	publicOnly := newEdDSAKey(t, "public")
+	publicOnly.privateKey = nil
+
+	if _, err := NewKeySet("missing", newHS256Key(t, "hs")); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("NewKeySet with unknown signing key: got %v, want ErrUnknownKey", err)
+	}
+
+	if _, err := NewKeySet("public", publicOnly); !errors.Is(err, ErrCannotSign) {
+		t.Errorf("NewKeySet with public signing key: got %v, want ErrCannotSign", err)
+	}
+}
+
+func TestLoadKeyMissingFile(t *testing.T) {
+	_, err := LoadKey("missing", filepath.Join(t.TempDir(), "missing"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("LoadKey: got %v, want os.ErrNotExist", err)
+	}
+}
@@ -0,0 +1,188 @@
+// Package jwt signs and verifies compact JSON Web Tokens (RFC 7519)
+// with HS256 or EdDSA (Ed25519). Every token names its key in the kid
+// header, so a key set can hold retired keys until their tokens
+// expire.
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Signing algorithms
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// Errors
+var (
+	ErrInvalidToken   = errors.New("Invalid token")
+	ErrExpiredToken   = errors.New("Token has expired")
+	ErrUnknownKey     = errors.New("Token is signed with an unknown key")
+	ErrUnsupportedKey = errors.New("Key is not an Ed25519 key")
+	ErrShortSecret    = errors.New("HS256 secret is shorter than 32 bytes")
+	ErrCannotSign     = errors.New("Signing key cannot sign")
+)
+
+// Claims are the registered claims of a token, plus the role of the
+// user
+type Claims struct {
+	Subject   string `json:"sub"`
+	Role      int    `json:"role"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+// KeySet holds the keys tokens are verified with, and the key new
+// tokens are signed with
+type KeySet struct {
+	keys       map[string]*Key
+	signingKey *Key
+}
+
+// NewKeySet returns a key set that signs with the key with the kid
+// signingKeyID and verifies with any of the keys
+func NewKeySet(signingKeyID string, keys ...*Key) (keySet *KeySet, err error) {
+	keySet = &KeySet{keys: make(map[string]*Key, len(keys))}
+	for _, key := range keys {
+		keySet.keys[key.ID] = key
+	}
+
+	signingKey, ok := keySet.keys[signingKeyID]
+	if !ok {
+		return nil, fmt.Errorf("key %q: %w", signingKeyID, ErrUnknownKey)
+	}
+
+	if !signingKey.CanSign() {
+		return nil, fmt.Errorf("key %q: %w", signingKeyID, ErrCannotSign)
+	}
+
+	keySet.signingKey = signingKey
+	return
+}
+
+// IsToken returns whether s has the form of a compact JWT, three
+// base64url segments separated by dots
+func IsToken(s string) bool {
+	return strings.Count(s, ".") == 2
+}
+
+// Sign returns a token with the claims signed with the signing key
+func (keySet *KeySet) Sign(claims *Claims) (token string, err error) {
+	key := keySet.signingKey
+
+	rawHeader, err := json.Marshal(&header{Algorithm: key.Algorithm, Type: "JWT", KeyID: key.ID})
+	if err != nil {
+		return
+	}
+
+	rawClaims, err := json.Marshal(claims)
+	if err != nil {
+		return
+	}
+
+	signingInput := encodeSegment(rawHeader) + "." + encodeSegment(rawClaims)
+	signature := sign(key, []byte(signingInput))
+
+	token = signingInput + "." + encodeSegment(signature)
+	return
+}
+
+// Verify checks the signature and expiry of the token and returns
+// its claims. The key is picked by the kid header, and the alg header
+// must match its algorithm.
+func (keySet *KeySet) Verify(token string, now time.Time) (claims *Claims, err error) {
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	rawHeader, err := decodeSegment(segments[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	tokenHeader := &header{}
+	err = json.Unmarshal(rawHeader, tokenHeader)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	key, ok := keySet.keys[tokenHeader.KeyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	// Never let the token choose the algorithm
+	if tokenHeader.Algorithm != key.Algorithm {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := decodeSegment(segments[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if !verify(key, []byte(segments[0]+"."+segments[1]), signature) {
+		return nil, ErrInvalidToken
+	}
+
+	rawClaims, err := decodeSegment(segments[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	claims = &Claims{}
+	err = json.Unmarshal(rawClaims, claims)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, ErrExpiredToken
+	}
+
+	return
+}
+
+func sign(key *Key, signingInput []byte) []byte {
+	if key.Algorithm == AlgorithmEdDSA {
+		return ed25519.Sign(key.privateKey, signingInput)
+	}
+
+	mac := hmac.New(sha256.New, key.secret)
+	mac.Write(signingInput)
+	return mac.Sum(nil)
+}
+
+func verify(key *Key, signingInput, signature []byte) bool {
+	if key.Algorithm == AlgorithmEdDSA {
+		return ed25519.Verify(key.publicKey, signingInput, signature)
+	}
+
+	mac := hmac.New(sha256.New, key.secret)
+	mac.Write(signingInput)
+	return hmac.Equal(signature, mac.Sum(nil))
+}
+
+func encodeSegment(raw []byte) string {
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeSegment(segment string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(segment)
+}
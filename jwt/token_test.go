@@ -0,0 +1,295 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNow = time.Unix(1700000000, 0)
+
+func newEdDSAKey(t *testing.T, id string) *Key {
+	t.Helper()
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	return &Key{ID: id, Algorithm: AlgorithmEdDSA, privateKey: privateKey, publicKey: publicKey}
+}
+
+func newHS256Key(t *testing.T, id string) *Key {
+	t.Helper()
+
+	secret := make([]byte, minSecretLength)
+	if _, err := rand.Read(secret); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	key, err := NewHS256Key(id, secret)
+	if err != nil {
+		t.Fatalf("NewHS256Key: %v", err)
+	}
+	return key
+}
+
+func newKeySet(t *testing.T, signingKeyID string, keys ...*Key) *KeySet {
+	t.Helper()
+
+	keySet, err := NewKeySet(signingKeyID, keys...)
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+	return keySet
+}
+
+func newClaims() *Claims {
+	return &Claims{
+		Subject:   "user-1",
+		Role:      2,
+		IssuedAt:  testNow.Unix(),
+		ExpiresAt: testNow.Add(15 * time.Minute).Unix(),
+	}
+}
+
+func signClaims(t *testing.T, keySet *KeySet, claims *Claims) string {
+	t.Helper()
+
+	token, err := keySet.Sign(claims)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	return token
+}
+
+func TestSignAndVerify(t *testing.T) {
+	tests := []struct {
+		name string
+		key  func(t *testing.T, id string) *Key
+	}{
+		{name: AlgorithmHS256, key: newHS256Key},
+		{name: AlgorithmEdDSA, key: newEdDSAKey},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keySet := newKeySet(t, "current", test.key(t, "current"))
+			token := signClaims(t, keySet, newClaims())
+
+			claims, err := keySet.Verify(token, testNow)
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if *claims != *newClaims() {
+				t.Errorf("Verify: got %+v, want %+v", claims, newClaims())
+			}
+		})
+	}
+}
+
+func TestVerifyRetiredKey(t *testing.T) {
+	retired := newEdDSAKey(t, "retired")
+	current := newEdDSAKey(t, "current")
+
+	token := signClaims(t, newKeySet(t, "retired", retired), newClaims())
+
+	_, err := newKeySet(t, "current", current, retired).Verify(token, testNow)
+	if err != nil {
+		t.Errorf("Verify with retired key: %v", err)
+	}
+
+	_, err = newKeySet(t, "current", current).Verify(token, testNow)
+	if !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Verify without retired key: got %v, want ErrUnknownKey", err)
+	}
+}
+
+// TestVerifyAlgorithmConfusion signs an HS256 token with the public
+// key of an EdDSA kid as the HMAC secret
+func TestVerifyAlgorithmConfusion(t *testing.T) {
+	key := newEdDSAKey(t, "ed")
+	keySet := newKeySet(t, "ed", key)
+
+	token := forgeToken(t, `{"alg":"HS256","typ":"JWT","kid":"ed"}`, newClaims(), func(signingInput []byte) []byte {
+		mac := hmac.New(sha256.New, key.publicKey)
+		mac.Write(signingInput)
+		return mac.Sum(nil)
+	})
+
+	_, err := keySet.Verify(token, testNow)
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify: got %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestVerifyNoneAlgorithm(t *testing.T) {
+	keySet := newKeySet(t, "hs", newHS256Key(t, "hs"))
+
+	token := forgeToken(t, `{"alg":"none","typ":"JWT","kid":"hs"}`, newClaims(), func(signingInput []byte) []byte {
+		return nil
+	})
+
+	_, err := keySet.Verify(token, testNow)
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify: got %v, want ErrInvalidToken", err)
+	}
+}
+
+// forgeToken builds a token with any header, signed by signFn
+func forgeToken(t *testing.T, rawHeader string, claims *Claims, signFn func(signingInput []byte) []byte) string {
+	t.Helper()
+
+	rawClaims, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	signingInput := encodeSegment([]byte(rawHeader)) + "." + encodeSegment(rawClaims)
+	return signingInput + "." + encodeSegment(signFn([]byte(signingInput)))
+}
+
+func TestVerifyUnknownKey(t *testing.T) {
+	keySet := newKeySet(t, "hs", newHS256Key(t, "hs"))
+
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{name: "other kid", header: `{"alg":"HS256","typ":"JWT","kid":"other"}`},
+		{name: "no kid", header: `{"alg":"HS256","typ":"JWT"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token := forgeToken(t, test.header, newClaims(), func(signingInput []byte) []byte {
+				return sign(keySet.signingKey, signingInput)
+			})
+
+			_, err := keySet.Verify(token, testNow)
+			if !errors.Is(err, ErrUnknownKey) {
+				t.Errorf("Verify: got %v, want ErrUnknownKey", err)
+			}
+		})
+	}
+}
+
+func TestVerifyExpiry(t *testing.T) {
+	keySet := newKeySet(t, "hs", newHS256Key(t, "hs"))
+	claims := newClaims()
+	token := signClaims(t, keySet, claims)
+	expiresAt := time.Unix(claims.ExpiresAt, 0)
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want error
+	}{
+		{name: "before expiry", now: expiresAt.Add(-time.Second)},
+		{name: "at expiry", now: expiresAt, want: ErrExpiredToken},
+		{name: "after expiry", now: expiresAt.Add(time.Hour), want: ErrExpiredToken},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := keySet.Verify(token, test.now)
+			if !errors.Is(err, test.want) {
+				t.Errorf("Verify: got %v, want %v", err, test.want)
+			}
+		})
+	}
+
+	noExpiry := signClaims(t, keySet, &Claims{Subject: "user-1"})
+	if _, err := keySet.Verify(noExpiry, testNow); !errors.Is(err, ErrExpiredToken) {
+		t.Errorf("Verify without exp: got %v, want ErrExpiredToken", err)
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	tests := []struct {
+		name string
+		key  func(t *testing.T, id string) *Key
+	}{
+		{name: AlgorithmHS256, key: newHS256Key},
+		{name: AlgorithmEdDSA, key: newEdDSAKey},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keySet := newKeySet(t, "current", test.key(t, "current"))
+			segments := strings.Split(signClaims(t, keySet, newClaims()), ".")
+
+			// A higher role in the payload
+			tampered := newClaims()
+			tampered.Role = 3
+			rawClaims, err := json.Marshal(tampered)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+
+			token := segments[0] + "." + encodeSegment(rawClaims) + "." + segments[2]
+			_, err = keySet.Verify(token, testNow)
+			if !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Verify: got %v, want ErrInvalidToken", err)
+			}
+
+			// The same kid with another key
+			other := newKeySet(t, "current", test.key(t, "current"))
+			_, err = other.Verify(signClaims(t, keySet, newClaims()), testNow)
+			if !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Verify with other key: got %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	keySet := newKeySet(t, "hs", newHS256Key(t, "hs"))
+	segments := strings.Split(signClaims(t, keySet, newClaims()), ".")
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "empty", token: ""},
+		{name: "two segments", token: segments[0] + "." + segments[1]},
+		{name: "four segments", token: strings.Join(append(segments, segments[2]), ".")},
+		{name: "header not base64url", token: "!." + segments[1] + "." + segments[2]},
+		{name: "header not JSON", token: encodeSegment([]byte("hs")) + "." + segments[1] + "." + segments[2]},
+		{name: "signature not base64url", token: segments[0] + "." + segments[1] + ".!"},
+		{name: "padded signature", token: segments[0] + "." + segments[1] + "." + segments[2] + "="},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := keySet.Verify(test.token, testNow)
+			if !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Verify: got %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestIsToken(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{s: "a.b.c", want: true},
+		{s: "3f2a1c9e8b7d6a5f", want: false},
+		{s: "a.b", want: false},
+		{s: "a.b.c.d", want: false},
+	}
+
+	for _, test := range tests {
+		if got := IsToken(test.s); got != test.want {
+			t.Errorf("IsToken(%q): got %v, want %v", test.s, got, test.want)
+		}
+	}
+}
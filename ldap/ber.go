@@ -0,0 +1,221 @@
+package ldap
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// BER classes and the constructed bit of the identifier octet
+const (
+	classUniversal   = 0x00
+	classApplication = 0x40
+	classContext     = 0x80
+	constructed      = 0x20
+)
+
+// Universal tags
+const (
+	tagBoolean     = 0x01
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagNull        = 0x05
+	tagEnumerated  = 0x0a
+	tagSequence    = 0x10
+	tagSet         = 0x11
+)
+
+// maxElementLength bounds the length of an element read from the
+// server, so that a broken server cannot make us allocate without end
+const maxElementLength = 16 << 20
+
+var errMalformed = errors.New("Malformed BER element")
+
+// element is a decoded BER element. Constructed elements hold their
+// children, primitive ones their value
+type element struct {
+	identifier byte
+	value      []byte
+	children   []*element
+}
+
+func (e *element) isConstructed() bool {
+	return e.identifier&constructed != 0
+}
+
+// child returns the i-th child, or an empty element if there is none,
+// so that optional fields can be read without checks
+func (e *element) child(i int) *element {
+	if i < len(e.children) {
+		return e.children[i]
+	}
+	return &element{}
+}
+
+func (e *element) string() string {
+	return string(e.value)
+}
+
+func (e *element) int() (n int64) {
+	if len(e.value) > 0 && e.value[0]&0x80 != 0 {
+		n = -1
+	}
+	for _, b := range e.value {
+		n = n<<8 | int64(b)
+	}
+	return
+}
+
+// encodeElement encodes an element with the identifier and content
+func encodeElement(identifier byte, content []byte) []byte {
+	encoded := []byte{identifier}
+	encoded = append(encoded, encodeLength(len(content))...)
+	return append(encoded, content...)
+}
+
+func encodeLength(length int) []byte {
+	if length < 0x80 {
+		return []byte{byte(length)}
+	}
+
+	var octets []byte
+	for ; length > 0; length >>= 8 {
+		octets = append([]byte{byte(length)}, octets...)
+	}
+	return append([]byte{0x80 | byte(len(octets))}, octets...)
+}
+
+func encodeConstructed(identifier byte, children ...[]byte) []byte {
+	var content []byte
+	for _, child := range children {
+		content = append(content, child...)
+	}
+	return encodeElement(identifier|constructed, content)
+}
+
+func encodeSequence(children ...[]byte) []byte {
+	return encodeConstructed(classUniversal|tagSequence, children...)
+}
+
+func encodeOctetString(value string) []byte {
+	return encodeElement(classUniversal|tagOctetString, []byte(value))
+}
+
+func encodeBoolean(value bool) []byte {
+	if value {
+		return encodeElement(classUniversal|tagBoolean, []byte{0xff})
+	}
+	return encodeElement(classUniversal|tagBoolean, []byte{0x00})
+}
+
+func encodeInteger(tag byte, n int64) []byte {
+	var content []byte
+	for {
+		content = append([]byte{byte(n)}, content...)
+		n >>= 8
+		// Stop once the remaining bits are only the sign extension
+		if (n == 0 && content[0]&0x80 == 0) || (n == -1 && content[0]&0x80 != 0) {
+			break
+		}
+	}
+	return encodeElement(classUniversal|tag, content)
+}
+
+// readElement reads one element, and the children of constructed
+// elements
+func readElement(reader *bufio.Reader) (e *element, err error) {
+	identifier, err := reader.ReadByte()
+	if err != nil {
+		return
+	}
+
+	// High tag numbers are not used by LDAP
+	if identifier&0x1f == 0x1f {
+		return nil, errMalformed
+	}
+
+	length, err := readLength(reader)
+	if err != nil {
+		return
+	}
+
+	value := make([]byte, length)
+	_, err = io.ReadFull(reader, value)
+	if err != nil {
+		return
+	}
+
+	return parseElement(identifier, value)
+}
+
+func readLength(reader *bufio.Reader) (length int, err error) {
+	first, err := reader.ReadByte()
+	if err != nil {
+		return
+	}
+
+	if first&0x80 == 0 {
+		return int(first), nil
+	}
+
+	count := int(first & 0x7f)
+	if count == 0 || count > 4 {
+		return 0, errMalformed
+	}
+
+	for i := 0; i < count; i++ {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		length = length<<8 | int(b)
+	}
+
+	if length > maxElementLength {
+		return 0, errMalformed
+	}
+
+	return
+}
+
+func parseElement(identifier byte, value []byte) (e *element, err error) {
+	e = &element{identifier: identifier, value: value}
+	if !e.isConstructed() {
+		return
+	}
+
+	for len(value) > 0 {
+		if len(value) < 2 || value[0]&0x1f == 0x1f {
+			return nil, errMalformed
+		}
+
+		childIdentifier := value[0]
+		length, header := int(value[1]), 2
+		if value[1]&0x80 != 0 {
+			count := int(value[1] & 0x7f)
+			if count == 0 || count > 4 || len(value) < 2+count {
+				return nil, errMalformed
+			}
+
+			length = 0
+			for _, b := range value[2 : 2+count] {
+				length = length<<8 | int(b)
+			}
+			header += count
+		}
+
+		if length < 0 || len(value) < header+length {
+			return nil, errMalformed
+		}
+
+		child, err := parseElement(childIdentifier, value[header:header+length])
+		if err != nil {
+			return nil, err
+		}
+
+		e.children = append(e.children, child)
+		value = value[header+length:]
+	}
+
+	return
+}
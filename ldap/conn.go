@@ -0,0 +1,369 @@
+// Package ldap is a minimal LDAPv3 client (RFC 4511) for
+// authenticating users against a directory: simple binds and searches
+// with equality filters. A Conn runs over any net.Conn, so it can also
+// talk to an in-process directory stand-in.
+package ldap
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Protocol operations
+const (
+	opBindRequest      = classApplication | constructed | 0
+	opBindResponse     = classApplication | constructed | 1
+	opUnbindRequest    = classApplication | 2
+	opSearchRequest    = classApplication | constructed | 3
+	opSearchEntry      = classApplication | constructed | 4
+	opSearchDone       = classApplication | constructed | 5
+	opSearchReference  = classApplication | constructed | 19
+	opExtendedResponse = classApplication | constructed | 24
+)
+
+// Result codes
+const (
+	ResultSuccess            = 0
+	ResultNoSuchObject       = 32
+	ResultInvalidCredentials = 49
+)
+
+// Search scopes
+const (
+	ScopeBaseObject   = 0
+	ScopeSingleLevel  = 1
+	ScopeWholeSubtree = 2
+)
+
+// Errors
+var (
+	ErrUnsupportedURL   = errors.New("LDAP URL must be ldap:// or ldaps://")
+	ErrEmptyPassword    = errors.New("Password is empty")
+	ErrUnexpectedAnswer = errors.New("Unexpected answer from LDAP server")
+)
+
+// Error is a result other than success returned by the server
+type Error struct {
+	ResultCode int64
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("LDAP result code %v", e.ResultCode)
+	}
+	return fmt.Sprintf("LDAP result code %v: %v", e.ResultCode, e.Message)
+}
+
+// IsInvalidCredentials returns whether a bind failed because of the
+// name or password
+func IsInvalidCredentials(err error) bool {
+	var ldapErr *Error
+	return errors.As(err, &ldapErr) && ldapErr.ResultCode == ResultInvalidCredentials
+}
+
+// Conn is a connection to an LDAP server. Requests are sent one at a
+// time.
+type Conn struct {
+	mutex     sync.Mutex
+	conn      net.Conn
+	reader    *bufio.Reader
+	messageID int64
+	timeout   time.Duration
+}
+
+// Dial connects to the server of an ldap:// or ldaps:// URL. tlsConfig
+// is used for ldaps:// and may be nil.
+func Dial(ctx context.Context, rawURL string, tlsConfig *tls.Config, timeout time.Duration) (conn *Conn, err error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+
+	var netConn net.Conn
+	switch parsed.Scheme {
+	case "ldap":
+		netConn, err = dialer.DialContext(ctx, "tcp", hostPort(parsed, "389"))
+	case "ldaps":
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig = tlsConfig.Clone()
+			tlsConfig.ServerName = parsed.Hostname()
+		}
+
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: tlsConfig}
+		netConn, err = tlsDialer.DialContext(ctx, "tcp", hostPort(parsed, "636"))
+	default:
+		err = ErrUnsupportedURL
+	}
+	if err != nil {
+		return
+	}
+
+	return NewConn(netConn, timeout), nil
+}
+
+func hostPort(parsed *url.URL, defaultPort string) string {
+	if parsed.Port() != "" {
+		return parsed.Host
+	}
+	return net.JoinHostPort(parsed.Hostname(), defaultPort)
+}
+
+// NewConn returns an LDAP connection over an established connection.
+// Every request must be answered within the timeout, if it is not
+// zero.
+func NewConn(netConn net.Conn, timeout time.Duration) *Conn {
+	return &Conn{
+		conn:    netConn,
+		reader:  bufio.NewReader(netConn),
+		timeout: timeout,
+	}
+}
+
+// Close unbinds and closes the connection
+func (c *Conn) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.messageID++
+	_, _ = c.conn.Write(encodeMessage(c.messageID, encodeElement(opUnbindRequest, nil)))
+	return c.conn.Close()
+}
+
+// Bind authenticates the connection with a simple bind. An empty
+// password would be an unauthenticated bind, which servers accept
+// for any name, so it is refused.
+func (c *Conn) Bind(dn, password string) (err error) {
+	if password == "" {
+		return ErrEmptyPassword
+	}
+
+	request := encodeConstructed(opBindRequest,
+		encodeInteger(tagInteger, 3),
+		encodeOctetString(dn),
+		encodeElement(classContext|0, []byte(password)))
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	messageID, err := c.send(request)
+	if err != nil {
+		return
+	}
+
+	op, err := c.receive(messageID)
+	if err != nil {
+		return
+	}
+
+	if op.identifier != opBindResponse {
+		return ErrUnexpectedAnswer
+	}
+
+	return resultError(op)
+}
+
+// Filter is a search filter
+type Filter interface {
+	encode() []byte
+}
+
+type equalityFilter struct {
+	attribute string
+	value     string
+}
+
+func (f *equalityFilter) encode() []byte {
+	return encodeConstructed(classContext|3,
+		encodeOctetString(f.attribute),
+		encodeOctetString(f.value))
+}
+
+type andFilter struct {
+	filters []Filter
+}
+
+func (f *andFilter) encode() []byte {
+	children := make([][]byte, len(f.filters))
+	for i, filter := range f.filters {
+		children[i] = filter.encode()
+	}
+	return encodeConstructed(classContext|0, children...)
+}
+
+// Equal matches entries with the attribute value. The value is sent
+// as is, so it needs no escaping.
+func Equal(attribute, value string) Filter {
+	return &equalityFilter{attribute: attribute, value: value}
+}
+
+// And matches entries that match every filter
+func And(filters ...Filter) Filter {
+	return &andFilter{filters: filters}
+}
+
+// SearchRequest selects entries below BaseDN
+type SearchRequest struct {
+	BaseDN     string
+	Scope      int
+	Filter     Filter
+	Attributes []string
+	SizeLimit  int
+}
+
+// Entry is an entry found by a search
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// Values returns the values of the attribute. Attribute names are not
+// case sensitive.
+func (e *Entry) Values(attribute string) []string {
+	for name, values := range e.Attributes {
+		if strings.EqualFold(name, attribute) {
+			return values
+		}
+	}
+	return nil
+}
+
+// Value returns the first value of the attribute, or empty string
+func (e *Entry) Value(attribute string) string {
+	values := e.Values(attribute)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// Search returns the entries that match the request
+func (c *Conn) Search(request *SearchRequest) (entries []*Entry, err error) {
+	attributes := make([][]byte, len(request.Attributes))
+	for i, attribute := range request.Attributes {
+		attributes[i] = encodeOctetString(attribute)
+	}
+
+	timeLimit := int64(c.timeout / time.Second)
+
+	encoded := encodeConstructed(opSearchRequest,
+		encodeOctetString(request.BaseDN),
+		encodeInteger(tagEnumerated, int64(request.Scope)),
+		encodeInteger(tagEnumerated, 0),
+		encodeInteger(tagInteger, int64(request.SizeLimit)),
+		encodeInteger(tagInteger, timeLimit),
+		encodeBoolean(false),
+		request.Filter.encode(),
+		encodeSequence(attributes...))
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	messageID, err := c.send(encoded)
+	if err != nil {
+		return
+	}
+
+	for {
+		op, err := c.receive(messageID)
+		if err != nil {
+			return nil, err
+		}
+
+		switch op.identifier {
+		case opSearchEntry:
+			entries = append(entries, readEntry(op))
+		case opSearchReference:
+			// Referrals to other servers are not followed
+		case opSearchDone:
+			return entries, resultError(op)
+		default:
+			return nil, ErrUnexpectedAnswer
+		}
+	}
+}
+
+func readEntry(op *element) *Entry {
+	entry := &Entry{
+		DN:         op.child(0).string(),
+		Attributes: make(map[string][]string),
+	}
+
+	for _, attribute := range op.child(1).children {
+		name := attribute.child(0).string()
+		for _, value := range attribute.child(1).children {
+			entry.Attributes[name] = append(entry.Attributes[name], value.string())
+		}
+	}
+
+	return entry
+}
+
+// resultError returns the error of an LDAPResult, or nil on success
+func resultError(op *element) error {
+	code := op.child(0).int()
+	if code == ResultSuccess {
+		return nil
+	}
+	return &Error{ResultCode: code, Message: op.child(2).string()}
+}
+
+func encodeMessage(messageID int64, op []byte) []byte {
+	return encodeSequence(encodeInteger(tagInteger, messageID), op)
+}
+
+// send writes a request and returns its message ID
+func (c *Conn) send(op []byte) (messageID int64, err error) {
+	c.messageID++
+	messageID = c.messageID
+
+	if c.timeout > 0 {
+		err = c.conn.SetDeadline(time.Now().Add(c.timeout))
+		if err != nil {
+			return
+		}
+	}
+
+	_, err = c.conn.Write(encodeMessage(messageID, op))
+	return
+}
+
+// receive reads the next answer to the request with the message ID
+// and returns its protocol operation. Unsolicited notifications, such
+// as a notice of disconnection, end the connection.
+func (c *Conn) receive(messageID int64) (op *element, err error) {
+	message, err := readElement(c.reader)
+	if err != nil {
+		return
+	}
+
+	if message.identifier != classUniversal|constructed|tagSequence || len(message.children) < 2 {
+		return nil, errMalformed
+	}
+
+	op = message.child(1)
+	if message.child(0).int() != messageID {
+		// Notices of disconnection carry the reason in their result
+		if op.identifier == opExtendedResponse {
+			if err = resultError(op); err != nil {
+				return nil, err
+			}
+		}
+		return nil, ErrUnexpectedAnswer
+	}
+
+	return
+}
@@ -0,0 +1,131 @@
+package ldap_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rjseymour66/library-go/ldap"
+	"github.com/rjseymour66/library-go/ldap/ldaptest"
+)
+
+func newTestServer(t *testing.T) *ldaptest.Server {
+	t.Helper()
+
+	server, err := ldaptest.NewServer(
+		&ldaptest.Entry{
+			DN:       "uid=ada,ou=people,dc=example,dc=org",
+			Password: "secret",
+			Attributes: map[string][]string{
+				"objectClass": {"person"},
+				"uid":         {"ada"},
+				"cn":          {"Ada Lovelace"},
+				"memberOf":    {"cn=librarians,ou=groups,dc=example,dc=org"},
+			},
+		},
+		&ldaptest.Entry{
+			DN:       "uid=bob,ou=people,dc=example,dc=org",
+			Password: "hunter2",
+			Attributes: map[string][]string{
+				"objectClass": {"person"},
+				"uid":         {"bob"},
+			},
+		})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+
+	t.Cleanup(server.Close)
+	return server
+}
+
+func dial(t *testing.T, server *ldaptest.Server) *ldap.Conn {
+	t.Helper()
+
+	conn, err := ldap.Dial(context.Background(), server.URL, nil, 5*time.Second)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestBind(t *testing.T) {
+	server := newTestServer(t)
+
+	tests := []struct {
+		name        string
+		dn          string
+		password    string
+		wantErr     error
+		invalidCred bool
+	}{
+		{name: "success", dn: "uid=ada,ou=people,dc=example,dc=org", password: "secret"},
+		{name: "wrong password", dn: "uid=ada,ou=people,dc=example,dc=org", password: "wrong", invalidCred: true},
+		{name: "unknown name", dn: "uid=eve,ou=people,dc=example,dc=org", password: "secret", invalidCred: true},
+		// The stand-in, like real servers, would accept this as an
+		// unauthenticated bind
+		{name: "empty password", dn: "uid=ada,ou=people,dc=example,dc=org", password: "", wantErr: ldap.ErrEmptyPassword},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := dial(t, server).Bind(test.dn, test.password)
+
+			switch {
+			case test.wantErr != nil:
+				if !errors.Is(err, test.wantErr) {
+					t.Errorf("Bind: got %v, want %v", err, test.wantErr)
+				}
+			case test.invalidCred:
+				if !ldap.IsInvalidCredentials(err) {
+					t.Errorf("Bind: got %v, want invalid credentials", err)
+				}
+			case err != nil:
+				t.Errorf("Bind: %v", err)
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	server := newTestServer(t)
+	conn := dial(t, server)
+
+	entries, err := conn.Search(&ldap.SearchRequest{
+		BaseDN:     "dc=example,dc=org",
+		Scope:      ldap.ScopeWholeSubtree,
+		Filter:     ldap.And(ldap.Equal("objectClass", "person"), ldap.Equal("uid", "ADA")),
+		Attributes: []string{"uid", "cn", "memberOf"},
+		SizeLimit:  2,
+	})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+
+	if len(entries) != 1 {
+		t.Fatalf("Search: got %v entries, want 1", len(entries))
+	}
+
+	entry := entries[0]
+	if entry.DN != "uid=ada,ou=people,dc=example,dc=org" {
+		t.Errorf("DN: got %q", entry.DN)
+	}
+	if got := entry.Value("CN"); got != "Ada Lovelace" {
+		t.Errorf("cn: got %q", got)
+	}
+	if got := entry.Values("memberof"); len(got) != 1 || got[0] != "cn=librarians,ou=groups,dc=example,dc=org" {
+		t.Errorf("memberOf: got %q", got)
+	}
+
+	entries, err = conn.Search(&ldap.SearchRequest{
+		BaseDN: "dc=example,dc=org",
+		Scope:  ldap.ScopeWholeSubtree,
+		Filter: ldap.Equal("uid", "eve"),
+	})
+	if err != nil || len(entries) != 0 {
+		t.Errorf("Search for unknown uid: got %v entries, %v", len(entries), err)
+	}
+}
@@ -0,0 +1,337 @@
+// Package ldaptest runs an in-process LDAP directory for tests. It
+// answers simple binds and searches with equality filters over a fixed
+// set of entries, which is all the ldap package sends.
+package ldaptest
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/rjseymour66/library-go/ldap"
+)
+
+// Entry is an entry of the directory. A bind with its DN succeeds
+// with Password.
+type Entry struct {
+	DN         string
+	Password   string
+	Attributes map[string][]string
+}
+
+// Server is a directory listening on a loopback address
+type Server struct {
+	// URL is the ldap:// URL of the server
+	URL string
+
+	listener net.Listener
+	entries  []*Entry
+	wg       sync.WaitGroup
+}
+
+// NewServer starts a directory with the entries. Like real servers, it
+// accepts a bind with an empty password as an unauthenticated bind.
+func NewServer(entries ...*Entry) (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		URL:      "ldap://" + listener.Addr().String(),
+		listener: listener,
+		entries:  entries,
+	}
+
+	s.wg.Add(1)
+	go s.accept()
+
+	return s, nil
+}
+
+// Close stops the server and waits for its connections to end
+func (s *Server) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.serve(conn)
+		}()
+	}
+}
+
+// Protocol operations
+const (
+	opBindRequest    = 0x60
+	opBindResponse   = 0x61
+	opUnbindRequest  = 0x42
+	opSearchRequest  = 0x63
+	opSearchEntry    = 0x64
+	opSearchDone     = 0x65
+	filterAnd        = 0xa0
+	filterEquality   = 0xa3
+	tagInteger       = 0x02
+	tagOctetString   = 0x04
+	tagEnumerated    = 0x0a
+	tagSequence      = 0x30
+	tagSet           = 0x31
+	constructedFlag  = 0x20
+	resultNotAllowed = 53
+)
+
+func (s *Server) serve(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+
+	for {
+		message, err := readElement(reader)
+		if err != nil || len(message.children) < 2 {
+			return
+		}
+
+		messageID := message.children[0].value
+		op := message.children[1]
+
+		var answers [][]byte
+		switch op.identifier {
+		case opBindRequest:
+			answers = append(answers, result(opBindResponse, s.bind(op)))
+		case opSearchRequest:
+			entries, code := s.search(op)
+			answers = append(answers, entries...)
+			answers = append(answers, result(opSearchDone, code))
+		case opUnbindRequest:
+			return
+		default:
+			return
+		}
+
+		for _, answer := range answers {
+			_, err = conn.Write(encode(tagSequence, append(encode(tagInteger, messageID), answer...)))
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) bind(op *element) int {
+	if len(op.children) < 3 {
+		return resultNotAllowed
+	}
+
+	dn := string(op.children[1].value)
+	password := string(op.children[2].value)
+	if password == "" {
+		return ldap.ResultSuccess
+	}
+
+	for _, entry := range s.entries {
+		if strings.EqualFold(entry.DN, dn) && entry.Password == password {
+			return ldap.ResultSuccess
+		}
+	}
+
+	return ldap.ResultInvalidCredentials
+}
+
+func (s *Server) search(op *element) (answers [][]byte, code int) {
+	if len(op.children) < 8 {
+		return nil, resultNotAllowed
+	}
+
+	baseDN := strings.ToLower(string(op.children[0].value))
+	filter := op.children[6]
+
+	var requested []string
+	for _, attribute := range op.children[7].children {
+		requested = append(requested, string(attribute.value))
+	}
+
+	for _, entry := range s.entries {
+		if !strings.HasSuffix(strings.ToLower(entry.DN), baseDN) || !matches(entry, filter) {
+			continue
+		}
+
+		var attributes []byte
+		for name, values := range entry.Attributes {
+			if len(requested) > 0 && !hasFold(requested, name) {
+				continue
+			}
+
+			var encodedValues []byte
+			for _, value := range values {
+				encodedValues = append(encodedValues, encode(tagOctetString, []byte(value))...)
+			}
+
+			attributes = append(attributes, encode(tagSequence,
+				append(encode(tagOctetString, []byte(name)), encode(tagSet, encodedValues)...))...)
+		}
+
+		answers = append(answers, encode(opSearchEntry,
+			append(encode(tagOctetString, []byte(entry.DN)), encode(tagSequence, attributes)...)))
+	}
+
+	return answers, ldap.ResultSuccess
+}
+
+func matches(entry *Entry, filter *element) bool {
+	switch filter.identifier {
+	case filterAnd:
+		for _, child := range filter.children {
+			if !matches(entry, child) {
+				return false
+			}
+		}
+		return true
+	case filterEquality:
+		if len(filter.children) < 2 {
+			return false
+		}
+
+		want := string(filter.children[1].value)
+		for name, values := range entry.Attributes {
+			if strings.EqualFold(name, string(filter.children[0].value)) && hasFold(values, want) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+func hasFold(values []string, value string) bool {
+	for _, item := range values {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func result(identifier byte, code int) []byte {
+	content := encode(tagEnumerated, []byte{byte(code)})
+	content = append(content, encode(tagOctetString, nil)...)
+	content = append(content, encode(tagOctetString, nil)...)
+	return encode(identifier, content)
+}
+
+func encode(identifier byte, content []byte) []byte {
+	encoded := []byte{identifier}
+
+	length := len(content)
+	if length < 0x80 {
+		encoded = append(encoded, byte(length))
+	} else {
+		var octets []byte
+		for ; length > 0; length >>= 8 {
+			octets = append([]byte{byte(length)}, octets...)
+		}
+		encoded = append(encoded, 0x80|byte(len(octets)))
+		encoded = append(encoded, octets...)
+	}
+
+	return append(encoded, content...)
+}
+
+type element struct {
+	identifier byte
+	value      []byte
+	children   []*element
+}
+
+var errMalformed = errors.New("Malformed BER element")
+
+func readElement(reader io.ByteReader) (e *element, err error) {
+	identifier, err := reader.ReadByte()
+	if err != nil {
+		return
+	}
+
+	length, err := readLength(reader)
+	if err != nil {
+		return
+	}
+
+	value := make([]byte, length)
+	for i := range value {
+		value[i], err = reader.ReadByte()
+		if err != nil {
+			return
+		}
+	}
+
+	return parseElement(identifier, value)
+}
+
+func readLength(reader io.ByteReader) (length int, err error) {
+	first, err := reader.ReadByte()
+	if err != nil || first&0x80 == 0 {
+		return int(first), err
+	}
+
+	count := int(first & 0x7f)
+	if count == 0 || count > 3 {
+		return 0, errMalformed
+	}
+
+	for i := 0; i < count; i++ {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		length = length<<8 | int(b)
+	}
+
+	return
+}
+
+func parseElement(identifier byte, value []byte) (e *element, err error) {
+	e = &element{identifier: identifier, value: value}
+	if identifier&constructedFlag == 0 {
+		return
+	}
+
+	reader := &sliceReader{data: value}
+	for reader.offset < len(value) {
+		child, err := readElement(reader)
+		if err != nil {
+			return nil, errMalformed
+		}
+		e.children = append(e.children, child)
+	}
+
+	return
+}
+
+// sliceReader reads the children of a constructed element
+type sliceReader struct {
+	data   []byte
+	offset int
+}
+
+func (r *sliceReader) ReadByte() (byte, error) {
+	if r.offset >= len(r.data) {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	b := r.data[r.offset]
+	r.offset++
+	return b, nil
+}
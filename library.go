@@ -1,10 +1,15 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
 	"sync"
+	"time"
 
 	"github.com/rjseymour66/library-go/config"
+	"github.com/rjseymour66/library-go/core"
+	"github.com/rjseymour66/library-go/handler"
 	"github.com/rjseymour66/library-go/server"
 	_ "github.com/lib/pq"
 )
@@ -20,6 +25,15 @@ func main() {
 	}
 
 	log.Println("Library Server Stopped.")
+
+	// Run a command such as a CSV import instead of the server
+	if len(os.Args) > 1 {
+		err = runCommand(os.Args[1], os.Args[2:])
+		if err != nil {
+			log.Fatalf("Failed to run %v: %v\n", os.Args[1], err)
+		}
+		return
+	}
 	
 	// db init
 	log.Println("Initializing database")
@@ -28,6 +42,46 @@ func main() {
 		log.Fatalf("Could not access database: %v\n", err)
 	}
 
+	// Load the keys that sign access tokens
+	err = core.InitAccessTokens()
+	if err != nil {
+		log.Fatalf("Could not load access token keys: %v\n", err)
+	}
+
+	// Set up the authenticators that check logins
+	err = core.InitAuthenticators()
+	if err != nil {
+		log.Fatalf("Could not create authenticators: %v\n", err)
+	}
+
+	// Every route must be in the OpenAPI document. The handler tests
+	// catch missing entries; this only guards builds that skipped them
+	err = handler.CheckAPIDoc()
+	if err != nil {
+		log.Fatalf("Incomplete API documentation: %v\n", err)
+	}
+
+	// Set up delivery of password reset tokens
+	err = core.InitNotifier()
+	if err != nil {
+		log.Fatalf("Could not create notifier: %v\n", err)
+	}
+
+	// Expire holds that were not picked up in time
+	go runPeriodically("hold expiry", config.GetHoldExpiryCheckInterval(), core.ExpireHolds)
+
+	// Charge fines for overdue loans
+	go runPeriodically("fine accrual", config.GetFineAccrualInterval(), core.AccrueFines)
+
+	// Remove sessions that expired
+	go runPeriodically("session cleanup", config.GetAuthSessionCleanupInterval(), core.DeleteExpiredSessions)
+
+	// Forget failed logins that no longer count towards a lockout
+	go runPeriodically("login failure cleanup", config.GetLockoutCleanupInterval(), core.DeleteStaleLoginFailures)
+
+	// Remove OpenID Connect sign-ins that were never finished
+	go runPeriodically("sign-in cleanup", config.GetOIDCCleanupInterval(), core.DeleteExpiredOIDCLogins)
+
 	// Start the HTTP server
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -46,3 +100,23 @@ func main() {
 
 	wg.Wait()
 }
+
+// runPeriodically calls task every interval with a context that
+// carries a db runner. A task without a positive interval is not run.
+func runPeriodically(name string, interval time.Duration, task func(ctx context.Context) error) {
+	if interval <= 0 {
+		log.Printf("Not running %v: interval is %v\n", name, interval)
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx := dbserver.PrepareDbRunner(context.Background())
+		err := task(ctx)
+		if err != nil {
+			log.Printf("Failed to run %v: %v\n", name, err)
+		}
+	}
+}
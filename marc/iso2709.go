@@ -0,0 +1,210 @@
+package marc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// ISO 2709 delimiters
+const (
+	subfieldDelimiter = 0x1F
+	fieldTerminator   = 0x1E
+	recordTerminator  = 0x1D
+)
+
+const (
+	leaderLength         = 24
+	directoryEntryLength = 12
+	maxRecordLength      = 99999
+)
+
+// Reader reads records in the binary MARC21 (ISO 2709) format
+type Reader struct {
+	reader *bufio.Reader
+}
+
+// NewReader returns a Reader that reads records from r
+func NewReader(r io.Reader) *Reader {
+	return &Reader{reader: bufio.NewReader(r)}
+}
+
+// Read returns the next record. It returns io.EOF when there are no
+// more records. A malformed record returns an error wrapping
+// ErrMalformedRecord, and the next call continues with the record
+// after it.
+func (rd *Reader) Read() (record *Record, err error) {
+	raw, err := rd.reader.ReadBytes(recordTerminator)
+	if err == io.EOF {
+		// Ignore trailing whitespace after the last record
+		if len(bytes.TrimSpace(raw)) == 0 {
+			return nil, io.EOF
+		}
+		err = nil
+	}
+
+	if err != nil {
+		return
+	}
+
+	// Records are sometimes separated by line breaks
+	raw = bytes.TrimLeft(raw, "\r\n")
+
+	return parseRecord(raw)
+}
+
+func parseRecord(raw []byte) (record *Record, err error) {
+	if len(raw) < leaderLength+1 {
+		return nil, fmt.Errorf("%w: record is shorter than its leader", ErrMalformedRecord)
+	}
+
+	leader := string(raw[:leaderLength])
+
+	baseAddress, ok := parseNumber(raw[12:17])
+	if !ok || baseAddress <= leaderLength || baseAddress > len(raw) {
+		return nil, fmt.Errorf("%w: invalid base address of data %q", ErrMalformedRecord, leader[12:17])
+	}
+
+	directory := raw[leaderLength : baseAddress-1]
+	if len(directory)%directoryEntryLength != 0 {
+		return nil, fmt.Errorf("%w: invalid directory length %d", ErrMalformedRecord, len(directory))
+	}
+
+	fields := raw[baseAddress:]
+
+	record = &Record{Leader: leader}
+
+	for i := 0; i < len(directory); i += directoryEntryLength {
+		entry := directory[i : i+directoryEntryLength]
+		tag := string(entry[:3])
+
+		length, okLength := parseNumber(entry[3:7])
+		start, okStart := parseNumber(entry[7:12])
+		if !okLength || !okStart || length < 1 || start+length > len(fields) {
+			return nil, fmt.Errorf("%w: invalid directory entry for tag %v", ErrMalformedRecord, tag)
+		}
+
+		// Drop the field terminator
+		value := fields[start : start+length-1]
+
+		if isControlTag(tag) {
+			record.AddControlField(tag, string(value))
+			continue
+		}
+
+		field, errField := parseDataField(tag, value)
+		if errField != nil {
+			return nil, errField
+		}
+		record.DataFields = append(record.DataFields, field)
+	}
+
+	return
+}
+
+// parseNumber reads the unsigned decimal numbers of the leader and
+// directory. Unlike strconv.Atoi it refuses signs, which would let a
+// field start before the data.
+func parseNumber(digits []byte) (n int, ok bool) {
+	for _, digit := range digits {
+		if digit < '0' || digit > '9' {
+			return 0, false
+		}
+		n = n*10 + int(digit-'0')
+	}
+	return n, len(digits) > 0
+}
+
+func parseDataField(tag string, value []byte) (field DataField, err error) {
+	if len(value) < 2 {
+		err = fmt.Errorf("%w: field %v has no indicators", ErrMalformedRecord, tag)
+		return
+	}
+
+	field.Tag = tag
+	field.Ind1 = string(value[0])
+	field.Ind2 = string(value[1])
+
+	for _, subfield := range bytes.Split(value[2:], []byte{subfieldDelimiter}) {
+		if len(subfield) == 0 {
+			continue
+		}
+
+		field.Subfields = append(field.Subfields, Subfield{
+			Code:  string(subfield[0]),
+			Value: string(subfield[1:]),
+		})
+	}
+
+	return
+}
+
+// Writer writes records in the binary MARC21 (ISO 2709) format
+type Writer struct {
+	writer io.Writer
+}
+
+// NewWriter returns a Writer that writes records to w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{writer: w}
+}
+
+// Write encodes the record and writes it. The record length and the
+// base address of data in the leader are computed from the fields.
+func (wr *Writer) Write(record *Record) (err error) {
+	var directory, fields bytes.Buffer
+
+	addField := func(tag string, value []byte) {
+		fmt.Fprintf(&directory, "%3s%04d%05d", tag, len(value)+1, fields.Len())
+		fields.Write(value)
+		fields.WriteByte(fieldTerminator)
+	}
+
+	for _, field := range record.ControlFields {
+		addField(field.Tag, []byte(field.Value))
+	}
+
+	for _, field := range record.DataFields {
+		var value bytes.Buffer
+		value.WriteString(indicator(field.Ind1))
+		value.WriteString(indicator(field.Ind2))
+		for _, subfield := range field.Subfields {
+			value.WriteByte(subfieldDelimiter)
+			value.WriteString(subfield.Code)
+			value.WriteString(subfield.Value)
+		}
+		addField(field.Tag, value.Bytes())
+	}
+
+	directory.WriteByte(fieldTerminator)
+
+	baseAddress := leaderLength + directory.Len()
+	recordLength := baseAddress + fields.Len() + 1
+	if recordLength > maxRecordLength {
+		return ErrRecordTooLong
+	}
+
+	leader := []byte(record.Leader)
+	if len(leader) != leaderLength {
+		leader = []byte(DefaultLeader)
+	}
+	copy(leader[0:5], fmt.Sprintf("%05d", recordLength))
+	copy(leader[12:17], fmt.Sprintf("%05d", baseAddress))
+
+	var buffer bytes.Buffer
+	buffer.Write(leader)
+	buffer.Write(directory.Bytes())
+	buffer.Write(fields.Bytes())
+	buffer.WriteByte(recordTerminator)
+
+	_, err = wr.writer.Write(buffer.Bytes())
+	return
+}
+
+func indicator(value string) string {
+	if len(value) != 1 {
+		return " "
+	}
+	return value
+}
@@ -0,0 +1,166 @@
+package marc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func newTestRecord() *Record {
+	record := NewRecord()
+	record.AddControlField("001", "12345")
+	record.AddDataField("020", " ", " ", "a", "9780306406157")
+	record.AddDataField("245", "1", "0", "a", "The Art of Computer Programming", "c", "Donald Knuth")
+	return record
+}
+
+func encode(t *testing.T, record *Record) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	if err := NewWriter(&buffer).Write(record); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	record, err := NewReader(bytes.NewReader(encode(t, newTestRecord()))).Read()
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	if got := record.ControlFieldValue("001"); got != "12345" {
+		t.Errorf("001: got %q", got)
+	}
+
+	if len(record.DataFields) != 2 {
+		t.Fatalf("got %v data fields, want 2", len(record.DataFields))
+	}
+
+	title := record.DataFields[1]
+	if title.Tag != "245" || title.Ind1 != "1" || title.Ind2 != "0" || len(title.Subfields) != 2 ||
+		title.Subfields[0].Value != "The Art of Computer Programming" {
+		t.Errorf("245: got %+v", title)
+	}
+}
+
+func TestParseMalformedRecord(t *testing.T) {
+	valid := encode(t, newTestRecord())
+
+	// The directory starts after the leader, and its first entry is
+	// the 001 control field
+	entry := leaderLength
+
+	tests := []struct {
+		name   string
+		change func(raw []byte) []byte
+	}{
+		{name: "shorter than leader", change: func(raw []byte) []byte { return raw[:20] }},
+		{name: "signed base address", change: func(raw []byte) []byte { return set(raw, 12, "-0050") }},
+		{name: "base address with space", change: func(raw []byte) []byte { return set(raw, 12, " 0050") }},
+		{name: "base address inside leader", change: func(raw []byte) []byte { return set(raw, 12, "00010") }},
+		{name: "base address past record", change: func(raw []byte) []byte { return set(raw, 12, "99999") }},
+		{name: "negative start", change: func(raw []byte) []byte { return set(raw, entry+7, "-0005") }},
+		{name: "signed length", change: func(raw []byte) []byte { return set(raw, entry+3, "+006") }},
+		{name: "zero length", change: func(raw []byte) []byte { return set(raw, entry+3, "0000") }},
+		{name: "field past data", change: func(raw []byte) []byte { return set(raw, entry+7, "09999") }},
+		{name: "letters in start", change: func(raw []byte) []byte { return set(raw, entry+7, "0000x") }},
+		{name: "truncated directory", change: func(raw []byte) []byte {
+			return append(append([]byte{}, raw[:entry+5]...), raw[entry+directoryEntryLength:]...)
+		}},
+		{name: "data field without indicators", change: func(raw []byte) []byte {
+			var buffer bytes.Buffer
+			record := NewRecord()
+			record.DataFields = []DataField{{Tag: "245"}}
+			if err := NewWriter(&buffer).Write(record); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			// The writer pads missing indicators, so the directory
+			// entry is shortened to leave only the field terminator
+			return set(buffer.Bytes(), leaderLength+3, "0001")
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			raw := test.change(append([]byte{}, valid...))
+
+			_, err := parseRecord(raw)
+			if !errors.Is(err, ErrMalformedRecord) {
+				t.Errorf("parseRecord: got %v, want ErrMalformedRecord", err)
+			}
+		})
+	}
+}
+
+// set overwrites the bytes of raw at offset
+func set(raw []byte, offset int, value string) []byte {
+	copy(raw[offset:], value)
+	return raw
+}
+
+func TestReadContinuesAfterMalformedRecord(t *testing.T) {
+	malformed := encode(t, newTestRecord())
+	set(malformed, leaderLength+7, "-0005")
+
+	input := append(malformed, '\n')
+	input = append(input, encode(t, newTestRecord())...)
+	input = append(input, "\r\n"...)
+
+	reader := NewReader(bytes.NewReader(input))
+
+	if _, err := reader.Read(); !errors.Is(err, ErrMalformedRecord) {
+		t.Fatalf("first Read: got %v, want ErrMalformedRecord", err)
+	}
+
+	record, err := reader.Read()
+	if err != nil {
+		t.Fatalf("second Read: %v", err)
+	}
+	if got := record.ControlFieldValue("001"); got != "12345" {
+		t.Errorf("001: got %q", got)
+	}
+
+	if _, err := reader.Read(); err != io.EOF {
+		t.Errorf("third Read: got %v, want io.EOF", err)
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		digits string
+		want   int
+		ok     bool
+	}{
+		{"00024", 24, true},
+		{"99999", 99999, true},
+		{"-0005", 0, false},
+		{"+0005", 0, false},
+		{" 0005", 0, false},
+		{"0x1f", 0, false},
+		{"", 0, false},
+	}
+
+	for _, test := range tests {
+		got, ok := parseNumber([]byte(test.digits))
+		if got != test.want || ok != test.ok {
+			t.Errorf("parseNumber(%q): got %v, %v, want %v, %v", test.digits, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestMalformedRecordDoesNotPanic(t *testing.T) {
+	valid := encode(t, newTestRecord())
+
+	// Every single-byte change to the record must give an
+	// error or a record, never a panic
+	for i := 0; i < len(valid); i++ {
+		for _, b := range []byte("-+ 09\x1e") {
+			raw := append([]byte{}, valid...)
+			raw[i] = b
+			_, _ = parseRecord(raw)
+		}
+	}
+}
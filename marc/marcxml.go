@@ -0,0 +1,155 @@
+package marc
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// Namespace is the MARCXML schema namespace
+const Namespace = "http://www.loc.gov/MARC21/slim"
+
+type xmlRecord struct {
+	XMLName       xml.Name          `xml:"record"`
+	Leader        string            `xml:"leader"`
+	ControlFields []xmlControlField `xml:"controlfield"`
+	DataFields    []xmlDataField    `xml:"datafield"`
+}
+
+type xmlControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlDataField struct {
+	Tag       string        `xml:"tag,attr"`
+	Ind1      string        `xml:"ind1,attr"`
+	Ind2      string        `xml:"ind2,attr"`
+	Subfields []xmlSubfield `xml:"subfield"`
+}
+
+type xmlSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+// XMLReader reads records from a MARCXML document. The records may be
+// wrapped in a collection element or be a single record element.
+type XMLReader struct {
+	decoder *xml.Decoder
+}
+
+// NewXMLReader returns an XMLReader that reads records from r
+func NewXMLReader(r io.Reader) *XMLReader {
+	return &XMLReader{decoder: xml.NewDecoder(r)}
+}
+
+// Read returns the next record. It returns io.EOF when there are no
+// more records. Unlike Reader, an error leaves the document unusable.
+func (rd *XMLReader) Read() (record *Record, err error) {
+	for {
+		token, errToken := rd.decoder.Token()
+		if errToken != nil {
+			return nil, errToken
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+
+		element := &xmlRecord{}
+		err = rd.decoder.DecodeElement(element, &start)
+		if err != nil {
+			return nil, err
+		}
+
+		return fromXMLRecord(element), nil
+	}
+}
+
+// XMLWriter writes records as a MARCXML collection. Close must be
+// called to end the document.
+type XMLWriter struct {
+	writer  io.Writer
+	encoder *xml.Encoder
+	started bool
+}
+
+// NewXMLWriter returns an XMLWriter that writes records to w
+func NewXMLWriter(w io.Writer) *XMLWriter {
+	return &XMLWriter{writer: w, encoder: xml.NewEncoder(w)}
+}
+
+// Write encodes the record as a record element of the collection
+func (wr *XMLWriter) Write(record *Record) (err error) {
+	err = wr.start()
+	if err != nil {
+		return
+	}
+
+	return wr.encoder.Encode(toXMLRecord(record))
+}
+
+// Close ends the collection. A writer with no records still writes an
+// empty collection.
+func (wr *XMLWriter) Close() (err error) {
+	err = wr.start()
+	if err != nil {
+		return
+	}
+
+	err = wr.encoder.Flush()
+	if err != nil {
+		return
+	}
+
+	_, err = io.WriteString(wr.writer, "</collection>\n")
+	return
+}
+
+func (wr *XMLWriter) start() (err error) {
+	if wr.started {
+		return
+	}
+	wr.started = true
+
+	_, err = fmt.Fprintf(wr.writer, "%v<collection xmlns=%q>", xml.Header, Namespace)
+	return
+}
+
+func fromXMLRecord(element *xmlRecord) (record *Record) {
+	record = &Record{Leader: element.Leader}
+
+	for _, field := range element.ControlFields {
+		record.AddControlField(field.Tag, field.Value)
+	}
+
+	for _, field := range element.DataFields {
+		dataField := DataField{Tag: field.Tag, Ind1: field.Ind1, Ind2: field.Ind2}
+		for _, subfield := range field.Subfields {
+			dataField.Subfields = append(dataField.Subfields, Subfield(subfield))
+		}
+		record.DataFields = append(record.DataFields, dataField)
+	}
+
+	return
+}
+
+func toXMLRecord(record *Record) (element *xmlRecord) {
+	element = &xmlRecord{Leader: record.Leader}
+
+	for _, field := range record.ControlFields {
+		element.ControlFields = append(element.ControlFields, xmlControlField(field))
+	}
+
+	for _, field := range record.DataFields {
+		dataField := xmlDataField{Tag: field.Tag, Ind1: indicator(field.Ind1), Ind2: indicator(field.Ind2)}
+		for _, subfield := range field.Subfields {
+			dataField.Subfields = append(dataField.Subfields, xmlSubfield(subfield))
+		}
+		element.DataFields = append(element.DataFields, dataField)
+	}
+
+	return
+}
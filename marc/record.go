@@ -0,0 +1,124 @@
+// Package marc reads and writes MARC21 bibliographic records in the
+// binary ISO 2709 transmission format and in MARCXML.
+package marc
+
+import (
+	"errors"
+	"strings"
+)
+
+// Errors
+var (
+	ErrMalformedRecord = errors.New("Malformed MARC record")
+	ErrRecordTooLong   = errors.New("MARC record is longer than 99999 bytes")
+)
+
+// DefaultLeader is used for new records. The writer fills in the
+// record length and base address of data.
+const DefaultLeader = "00000nam a2200000 i 4500"
+
+// Record is a MARC21 record
+type Record struct {
+	Leader        string
+	ControlFields []ControlField
+	DataFields    []DataField
+}
+
+// ControlField is a field with tag 001-009 that holds a single value
+type ControlField struct {
+	Tag   string
+	Value string
+}
+
+// DataField is a field with tag 010-999 that holds indicators and
+// subfields
+type DataField struct {
+	Tag       string
+	Ind1      string
+	Ind2      string
+	Subfields []Subfield
+}
+
+// Subfield is a single coded value inside a DataField
+type Subfield struct {
+	Code  string
+	Value string
+}
+
+// NewRecord returns an empty record with DefaultLeader
+func NewRecord() *Record {
+	return &Record{Leader: DefaultLeader}
+}
+
+// AddControlField appends a control field to the record
+func (r *Record) AddControlField(tag, value string) {
+	r.ControlFields = append(r.ControlFields, ControlField{Tag: tag, Value: value})
+}
+
+// AddDataField appends a data field to the record. Subfields are
+// given as alternating codes and values.
+func (r *Record) AddDataField(tag, ind1, ind2 string, codesAndValues ...string) {
+	field := DataField{Tag: tag, Ind1: ind1, Ind2: ind2}
+	for i := 0; i+1 < len(codesAndValues); i += 2 {
+		field.Subfields = append(field.Subfields, Subfield{
+			Code:  codesAndValues[i],
+			Value: codesAndValues[i+1],
+		})
+	}
+	r.DataFields = append(r.DataFields, field)
+}
+
+// ControlFieldValue returns the value of the first control field
+// with the tag. If there is none, returns an empty string
+func (r *Record) ControlFieldValue(tag string) string {
+	for _, field := range r.ControlFields {
+		if field.Tag == tag {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+// Fields returns every data field with the tag
+func (r *Record) Fields(tag string) (fields []DataField) {
+	for _, field := range r.DataFields {
+		if field.Tag == tag {
+			fields = append(fields, field)
+		}
+	}
+	return
+}
+
+// SubfieldValue returns the value of the first subfield with the
+// code in the first data field with the tag. If there is none,
+// returns an empty string
+func (r *Record) SubfieldValue(tag, code string) string {
+	for _, field := range r.DataFields {
+		if field.Tag == tag {
+			return field.SubfieldValue(code)
+		}
+	}
+	return ""
+}
+
+// SubfieldValue returns the value of the first subfield with the
+// code. If there is none, returns an empty string
+func (f DataField) SubfieldValue(code string) string {
+	for _, subfield := range f.Subfields {
+		if subfield.Code == code {
+			return subfield.Value
+		}
+	}
+	return ""
+}
+
+// TrimPunctuation removes the ISBD punctuation cataloguers leave at
+// the end of subfields, such as the " /" after a title or the ","
+// after a publisher
+func TrimPunctuation(value string) string {
+	return strings.TrimSpace(strings.TrimRight(strings.TrimSpace(value), " /:;,="))
+}
+
+func isControlTag(tag string) bool {
+	return len(tag) == 3 && strings.HasPrefix(tag, "00")
+}
@@ -0,0 +1,67 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// logNotifier writes messages to the server log
+type logNotifier struct{}
+
+func newLogNotifier(target string) (Notifier, error) {
+	return &logNotifier{}, nil
+}
+
+func (n *logNotifier) Notify(ctx context.Context, message *Message) error {
+	log.Printf("notification to %v: %v\n%v\n", message.To.Username, message.Subject, message.Body)
+	return nil
+}
+
+// fileNotifier appends messages to a file, in the way a mail spool
+// would hold them
+type fileNotifier struct {
+	mutex    sync.Mutex
+	fileName string
+}
+
+func newFileNotifier(target string) (Notifier, error) {
+	if target == "" {
+		return nil, fmt.Errorf("file notifier needs a file name")
+	}
+
+	return &fileNotifier{fileName: target}, nil
+}
+
+func (n *fileNotifier) Notify(ctx context.Context, message *Message) (err error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	file, err := os.OpenFile(n.fileName, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		closeErr := file.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	return writeMessage(file, message, time.Now())
+}
+
+func writeMessage(writer io.Writer, message *Message, sentAt time.Time) (err error) {
+	_, err = fmt.Fprintf(writer, "Date: %v\nTo: %v <%v>\nSubject: %v\n\n%v\n\n",
+		sentAt.Format(time.RFC1123Z),
+		message.To.FullName,
+		message.To.Email,
+		message.Subject,
+		message.Body)
+	return
+}
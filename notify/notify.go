@@ -0,0 +1,72 @@
+// Package notify delivers messages to library users. The server picks
+// a Notifier by name from the config; the log and file notifiers are
+// meant for local use, and other channels such as email register
+// themselves with Register.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Errors
+var (
+	ErrUnknownNotifier = errors.New("Unknown notifier")
+)
+
+// Recipient is the user a message is for
+type Recipient struct {
+	UserID   string
+	Username string
+	FullName string
+	Email    string
+}
+
+// Message is a notification to a user
+type Message struct {
+	To      Recipient
+	Subject string
+	Body    string
+}
+
+// Notifier delivers messages
+type Notifier interface {
+	Notify(ctx context.Context, message *Message) error
+}
+
+// Factory returns a notifier. Target is the notifier-specific
+// destination from the config, such as a file name.
+type Factory func(target string) (Notifier, error)
+
+var factories = struct {
+	sync.RWMutex
+	byName map[string]Factory
+}{
+	byName: map[string]Factory{
+		"log":  newLogNotifier,
+		"file": newFileNotifier,
+	},
+}
+
+// Register makes a notifier available under the name
+func Register(name string, factory Factory) {
+	factories.Lock()
+	defer factories.Unlock()
+
+	factories.byName[name] = factory
+}
+
+// New returns the notifier registered under the name
+func New(name, target string) (Notifier, error) {
+	factories.RLock()
+	factory, ok := factories.byName[name]
+	factories.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownNotifier, name)
+	}
+
+	return factory(target)
+}
@@ -0,0 +1,369 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// clockSkew is how far the clocks of the provider and the server may
+// be apart
+const clockSkew = time.Minute
+
+// keysRefetchInterval is how long an unknown kid waits before the keys
+// are fetched again, so that forged tokens cannot flood the provider
+const keysRefetchInterval = time.Minute
+
+// minRSAKeyBits is the smallest RSA key accepted
+const minRSAKeyBits = 2048
+
+// Errors
+var (
+	ErrInvalidIDToken    = errors.New("Invalid ID token")
+	ErrUnsupportedAlg    = errors.New("ID token is signed with an unsupported algorithm")
+	ErrUnknownSigningKey = errors.New("ID token is signed with an unknown key")
+	ErrBadSignature      = errors.New("ID token signature does not match")
+	ErrExpiredIDToken    = errors.New("ID token has expired")
+	ErrClaimMismatch     = errors.New("ID token claim does not match")
+)
+
+// IDToken holds the verified claims of an ID token
+type IDToken struct {
+	Issuer  string
+	Subject string
+	Nonce   string
+	Expiry  time.Time
+
+	// Claims are all the claims of the token, such as email or groups
+	Claims map[string]interface{}
+}
+
+// StringClaim returns a claim that is a string, or empty string
+func (t *IDToken) StringClaim(name string) string {
+	value, _ := t.Claims[name].(string)
+	return value
+}
+
+// StringsClaim returns a claim that is a string or a list of strings
+func (t *IDToken) StringsClaim(name string) (values []string) {
+	switch value := t.Claims[name].(type) {
+	case string:
+		values = []string{value}
+	case []interface{}:
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	return
+}
+
+// BoolClaim returns a claim that is a boolean, or false
+func (t *IDToken) BoolClaim(name string) bool {
+	value, _ := t.Claims[name].(bool)
+	return value
+}
+
+type idTokenHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+type idTokenClaims struct {
+	Issuer          string          `json:"iss"`
+	Subject         string          `json:"sub"`
+	Audience        json.RawMessage `json:"aud"`
+	AuthorizedParty string          `json:"azp"`
+	Nonce           string          `json:"nonce"`
+	ExpiresAt       int64           `json:"exp"`
+	IssuedAt        int64           `json:"iat"`
+}
+
+// VerifyIDToken checks the signature of an ID token with the keys of
+// the provider, and that it was issued by the provider for the client
+// and the nonce, and has not expired at now
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken, clientID, nonce string, now time.Time) (token *IDToken, err error) {
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidIDToken
+	}
+
+	header := &idTokenHeader{}
+	err = decodeSegment(parts[0], header)
+	if err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	key, err := p.signingKey(ctx, header.KeyID)
+	if err != nil {
+		return
+	}
+
+	err = verifySignature(header.Algorithm, key, []byte(parts[0]+"."+parts[1]), signature)
+	if err != nil {
+		return
+	}
+
+	claims := &idTokenClaims{}
+	err = decodeSegment(parts[1], claims)
+	if err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	allClaims := make(map[string]interface{})
+	err = decodeSegment(parts[1], &allClaims)
+	if err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	err = checkClaims(claims, p.Issuer, clientID, nonce, now)
+	if err != nil {
+		return
+	}
+
+	token = &IDToken{
+		Issuer:  claims.Issuer,
+		Subject: claims.Subject,
+		Nonce:   claims.Nonce,
+		Expiry:  time.Unix(claims.ExpiresAt, 0),
+		Claims:  allClaims,
+	}
+	return
+}
+
+func checkClaims(claims *idTokenClaims, issuer, clientID, nonce string, now time.Time) error {
+	if claims.Issuer != issuer {
+		return fmt.Errorf("%w: iss", ErrClaimMismatch)
+	}
+
+	if claims.Subject == "" {
+		return fmt.Errorf("%w: sub", ErrClaimMismatch)
+	}
+
+	// aud is a string or a list of strings
+	var audience []string
+	var single string
+	if json.Unmarshal(claims.Audience, &single) == nil {
+		audience = []string{single}
+	} else if json.Unmarshal(claims.Audience, &audience) != nil {
+		return fmt.Errorf("%w: aud", ErrClaimMismatch)
+	}
+
+	found := false
+	for _, aud := range audience {
+		if aud == clientID {
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("%w: aud", ErrClaimMismatch)
+	}
+
+	if (len(audience) > 1 || claims.AuthorizedParty != "") && claims.AuthorizedParty != clientID {
+		return fmt.Errorf("%w: azp", ErrClaimMismatch)
+	}
+
+	if claims.Nonce != nonce {
+		return fmt.Errorf("%w: nonce", ErrClaimMismatch)
+	}
+
+	if claims.ExpiresAt == 0 || !now.Before(time.Unix(claims.ExpiresAt, 0).Add(clockSkew)) {
+		return ErrExpiredIDToken
+	}
+
+	if claims.IssuedAt == 0 || now.Add(clockSkew).Before(time.Unix(claims.IssuedAt, 0)) {
+		return fmt.Errorf("%w: iat", ErrClaimMismatch)
+	}
+
+	return nil
+}
+
+func decodeSegment(segment string, value interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, value)
+}
+
+func verifySignature(algorithm string, key *jsonWebKey, signed, signature []byte) error {
+	if key.Algorithm != "" && key.Algorithm != algorithm {
+		return ErrUnsupportedAlg
+	}
+
+	digest := sha256.Sum256(signed)
+
+	switch algorithm {
+	case "RS256":
+		publicKey, ok := key.publicKey.(*rsa.PublicKey)
+		if !ok {
+			return ErrUnsupportedAlg
+		}
+		if rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature) != nil {
+			return ErrBadSignature
+		}
+	case "ES256":
+		publicKey, ok := key.publicKey.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return ErrUnsupportedAlg
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(publicKey, digest[:], r, s) {
+			return ErrBadSignature
+		}
+	case "EdDSA":
+		publicKey, ok := key.publicKey.(ed25519.PublicKey)
+		if !ok {
+			return ErrUnsupportedAlg
+		}
+		if !ed25519.Verify(publicKey, signed, signature) {
+			return ErrBadSignature
+		}
+	default:
+		return fmt.Errorf("%w: %q", ErrUnsupportedAlg, algorithm)
+	}
+
+	return nil
+}
+
+// jsonWebKey is a public key from the JWKS of the provider
+type jsonWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+	X         string `json:"x"`
+	Y         string `json:"y"`
+
+	publicKey crypto.PublicKey
+}
+
+// signingKey returns the key with the kid. The keys are fetched again
+// when the kid is unknown, since providers rotate their keys.
+func (p *Provider) signingKey(ctx context.Context, keyID string) (key *jsonWebKey, err error) {
+	p.keysMutex.RLock()
+	key, ok := p.keys[keyID]
+	recentlyFetched := time.Since(p.keysFetchedAt) < keysRefetchInterval
+	p.keysMutex.RUnlock()
+
+	if ok {
+		return key, nil
+	}
+
+	if recentlyFetched {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownSigningKey, keyID)
+	}
+
+	keySet := &struct {
+		Keys []*jsonWebKey `json:"keys"`
+	}{}
+
+	err = getJSON(ctx, p.client, p.JWKSURI, keySet)
+	if err != nil {
+		return
+	}
+
+	keys := make(map[string]*jsonWebKey, len(keySet.Keys))
+	for _, jwk := range keySet.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		jwk.publicKey, err = parsePublicKey(jwk)
+		if err != nil {
+			// Keys of unsupported types are skipped
+			continue
+		}
+
+		keys[jwk.KeyID] = jwk
+	}
+
+	p.keysMutex.Lock()
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+	p.keysMutex.Unlock()
+
+	key, ok = keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownSigningKey, keyID)
+	}
+
+	return key, nil
+}
+
+func parsePublicKey(jwk *jsonWebKey) (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(jwk.E)
+		if err != nil || len(e) > 4 {
+			return nil, ErrUnsupportedAlg
+		}
+		publicKey := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+		if publicKey.N.BitLen() < minRSAKeyBits || publicKey.E < 3 {
+			return nil, ErrUnsupportedAlg
+		}
+		return publicKey, nil
+	case "EC":
+		if jwk.Curve != "P-256" {
+			return nil, ErrUnsupportedAlg
+		}
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		publicKey := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !publicKey.Curve.IsOnCurve(publicKey.X, publicKey.Y) {
+			return nil, ErrUnsupportedAlg
+		}
+		return publicKey, nil
+	case "OKP":
+		if jwk.Curve != "Ed25519" {
+			return nil, ErrUnsupportedAlg
+		}
+		x, err := decode(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, ErrUnsupportedAlg
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, ErrUnsupportedAlg
+	}
+}
@@ -0,0 +1,234 @@
+// Package oidctest runs a mock OpenID Connect provider for tests. It
+// serves discovery, a JWKS and a token endpoint that checks the PKCE
+// code verifier, and signs ID tokens with an Ed25519 key.
+package oidctest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// KeyID is the kid of the signing key
+const KeyID = "test-key"
+
+// Provider is a mock provider. Its issuer is the URL of the server.
+type Provider struct {
+	Server   *httptest.Server
+	Issuer   string
+	ClientID string
+
+	key   ed25519.PrivateKey
+	mutex sync.Mutex
+	codes map[string]*grant
+}
+
+// grant is an authorization code waiting to be redeemed
+type grant struct {
+	codeChallenge string
+	redirectURI   string
+	claims        map[string]interface{}
+}
+
+// NewProvider starts a provider that issues ID tokens for the client
+func NewProvider(clientID string) (*Provider, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Provider{
+		ClientID: clientID,
+		key:      key,
+		codes:    make(map[string]*grant),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.serveDiscovery)
+	mux.HandleFunc("/jwks", p.serveJWKS)
+	mux.HandleFunc("/token", p.serveToken)
+
+	p.Server = httptest.NewServer(mux)
+	p.Issuer = p.Server.URL
+	return p, nil
+}
+
+// Close stops the server
+func (p *Provider) Close() {
+	p.Server.Close()
+}
+
+// Claims returns the claims of an ID token the provider issues for the
+// subject now: iss, sub, aud, iat and exp.
+func (p *Provider) Claims(subject string) map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"iss": p.Issuer,
+		"sub": subject,
+		"aud": p.ClientID,
+		"iat": now.Unix(),
+		"exp": now.Add(5 * time.Minute).Unix(),
+	}
+}
+
+// Authorize stands in for the user signing in at the authorization
+// URL the client built. It returns the code and state the provider
+// would send to the redirect URI. The ID token of the code has the
+// claims and the nonce of the request.
+func (p *Provider) Authorize(authorizationURL string, claims map[string]interface{}) (code, state string, err error) {
+	parsed, err := url.Parse(authorizationURL)
+	if err != nil {
+		return
+	}
+
+	query := parsed.Query()
+	switch {
+	case query.Get("response_type") != "code":
+		return "", "", errors.New("response_type is not code")
+	case query.Get("client_id") != p.ClientID:
+		return "", "", errors.New("unknown client_id")
+	case query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "":
+		return "", "", errors.New("missing S256 code challenge")
+	}
+
+	tokenClaims := make(map[string]interface{}, len(claims)+1)
+	for name, value := range claims {
+		tokenClaims[name] = value
+	}
+	if nonce := query.Get("nonce"); nonce != "" {
+		tokenClaims["nonce"] = nonce
+	}
+
+	code, err = randomString()
+	if err != nil {
+		return
+	}
+
+	p.mutex.Lock()
+	p.codes[code] = &grant{
+		codeChallenge: query.Get("code_challenge"),
+		redirectURI:   query.Get("redirect_uri"),
+		claims:        tokenClaims,
+	}
+	p.mutex.Unlock()
+
+	return code, query.Get("state"), nil
+}
+
+// SignIDToken returns an ID token with the claims. The header names
+// the algorithm, but the signature is always made with the Ed25519
+// key, so that tokens with other algorithms must be rejected.
+func (p *Provider) SignIDToken(algorithm string, claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": algorithm, "kid": KeyID, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature := ed25519.Sign(p.key, []byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func (p *Provider) serveDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 p.Issuer,
+		"authorization_endpoint": p.Issuer + "/authorize",
+		"token_endpoint":         p.Issuer + "/token",
+		"jwks_uri":               p.Issuer + "/jwks",
+	})
+}
+
+func (p *Provider) serveJWKS(w http.ResponseWriter, r *http.Request) {
+	publicKey := p.key.Public().(ed25519.PublicKey)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"kid": KeyID,
+			"use": "sig",
+			"alg": "EdDSA",
+			"x":   base64.RawURLEncoding.EncodeToString(publicKey),
+		}},
+	})
+}
+
+// serveToken redeems a code once. A wrong code verifier also uses up
+// the code, as it would with a real provider.
+func (p *Provider) serveToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	clientID := r.PostForm.Get("client_id")
+	if username, _, ok := r.BasicAuth(); ok {
+		clientID, _ = url.QueryUnescape(username)
+	}
+
+	p.mutex.Lock()
+	codeGrant, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mutex.Unlock()
+
+	switch {
+	case r.PostForm.Get("grant_type") != "authorization_code":
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	case clientID != p.ClientID:
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	case !ok || codeGrant.redirectURI != r.PostForm.Get("redirect_uri"):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != codeGrant.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error":             "invalid_grant",
+			"error_description": "code verifier does not match",
+		})
+		return
+	}
+
+	idToken, err := p.SignIDToken("EdDSA", codeGrant.claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": "access-" + r.PostForm.Get("code"),
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func randomString() (string, error) {
+	raw := make([]byte, 16)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
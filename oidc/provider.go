@@ -0,0 +1,220 @@
+// Package oidc signs users in with an OpenID Connect provider through
+// the authorization code flow with PKCE (RFC 7636). It discovers the
+// provider from its issuer URL and verifies ID tokens with the keys
+// the provider publishes.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxResponseLength bounds the documents read from the provider
+const maxResponseLength = 1 << 20
+
+// Errors
+var (
+	ErrIssuerMismatch = errors.New("Provider issuer does not match the configured issuer")
+	ErrNoIDToken      = errors.New("Token response has no ID token")
+)
+
+// Provider is a discovered OpenID Connect provider
+type Provider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+
+	client *http.Client
+
+	keysMutex     sync.RWMutex
+	keys          map[string]*jsonWebKey
+	keysFetchedAt time.Time
+}
+
+// Discover reads the configuration of the provider with the issuer
+// from its well-known discovery document
+func Discover(ctx context.Context, client *http.Client, issuer string) (provider *Provider, err error) {
+	discoveryURL := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+
+	provider = &Provider{client: client}
+	err = getJSON(ctx, client, discoveryURL, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	if provider.Issuer != issuer {
+		return nil, fmt.Errorf("%w: %q", ErrIssuerMismatch, provider.Issuer)
+	}
+
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.JWKSURI == "" {
+		return nil, errors.New("Discovery document misses an endpoint")
+	}
+
+	return
+}
+
+// AuthRequest holds the parameters of an authorization request
+type AuthRequest struct {
+	ClientID      string
+	RedirectURI   string
+	Scopes        []string
+	State         string
+	Nonce         string
+	CodeChallenge string
+}
+
+// AuthorizationURL returns the URL the user is sent to to sign in
+func (p *Provider) AuthorizationURL(request *AuthRequest) string {
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", request.ClientID)
+	query.Set("redirect_uri", request.RedirectURI)
+	query.Set("scope", strings.Join(request.Scopes, " "))
+	query.Set("state", request.State)
+	query.Set("nonce", request.Nonce)
+	query.Set("code_challenge", request.CodeChallenge)
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return p.AuthorizationEndpoint + separator + query.Encode()
+}
+
+// Token is the response of the token endpoint
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+}
+
+// tokenError is the error response of the token endpoint
+type tokenError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *tokenError) Error() string {
+	if e.Description == "" {
+		return "Token endpoint error: " + e.Code
+	}
+	return fmt.Sprintf("Token endpoint error: %v: %v", e.Code, e.Description)
+}
+
+// Exchange redeems an authorization code and the PKCE code verifier it
+// was requested with. A client without a secret is a public client.
+func (p *Provider) Exchange(ctx context.Context, clientID, clientSecret, redirectURI, code, codeVerifier string) (token *Token, err error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	form.Set("code_verifier", codeVerifier)
+	if clientSecret == "" {
+		form.Set("client_id", clientID)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return
+	}
+
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if clientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+	}
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return
+	}
+
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxResponseLength))
+	if err != nil {
+		return
+	}
+
+	if response.StatusCode != http.StatusOK {
+		tokenErr := &tokenError{}
+		if json.Unmarshal(body, tokenErr) == nil && tokenErr.Code != "" {
+			return nil, tokenErr
+		}
+		return nil, fmt.Errorf("Token endpoint returned %v", response.Status)
+	}
+
+	token = &Token{}
+	err = json.Unmarshal(body, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.IDToken == "" {
+		return nil, ErrNoIDToken
+	}
+
+	return
+}
+
+// NewCodeVerifier returns a random PKCE code verifier
+func NewCodeVerifier() (string, error) {
+	return randomString(32)
+}
+
+// CodeChallenge returns the S256 code challenge of a code verifier
+func CodeChallenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// NewState returns a random value for the state or nonce of an
+// authorization request
+func NewState() (string, error) {
+	return randomString(24)
+}
+
+func randomString(length int) (string, error) {
+	raw := make([]byte, length)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, document interface{}) (err error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return
+	}
+
+	request.Header.Set("Accept", "application/json")
+
+	response, err := client.Do(request)
+	if err != nil {
+		return
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %v returned %v", url, response.Status)
+	}
+
+	return json.NewDecoder(io.LimitReader(response.Body, maxResponseLength)).Decode(document)
+}
@@ -0,0 +1,260 @@
+package oidc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rjseymour66/library-go/oidc/oidctest"
+)
+
+const (
+	testClientID    = "library"
+	testRedirectURI = "https://library.example.org/oidc/callback"
+)
+
+func newTestProvider(t *testing.T) (*oidctest.Provider, *Provider) {
+	t.Helper()
+
+	mock, err := oidctest.NewProvider(testClientID)
+	if err != nil {
+		t.Fatalf("NewProvider: %v", err)
+	}
+	t.Cleanup(mock.Close)
+
+	provider, err := Discover(context.Background(), http.DefaultClient, mock.Issuer)
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+
+	return mock, provider
+}
+
+// authorize starts a sign-in and returns the code of the provider and
+// the code verifier and nonce of the request
+func authorize(t *testing.T, mock *oidctest.Provider, provider *Provider, subject string) (code, codeVerifier, nonce string) {
+	t.Helper()
+
+	codeVerifier, err := NewCodeVerifier()
+	if err != nil {
+		t.Fatalf("NewCodeVerifier: %v", err)
+	}
+
+	nonce, err = NewState()
+	if err != nil {
+		t.Fatalf("NewState: %v", err)
+	}
+
+	authorizationURL := provider.AuthorizationURL(&AuthRequest{
+		ClientID:      testClientID,
+		RedirectURI:   testRedirectURI,
+		Scopes:        []string{"openid", "email"},
+		State:         "state",
+		Nonce:         nonce,
+		CodeChallenge: CodeChallenge(codeVerifier),
+	})
+
+	code, state, err := mock.Authorize(authorizationURL, mock.Claims(subject))
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	if state != "state" {
+		t.Fatalf("Authorize: got state %q", state)
+	}
+
+	return
+}
+
+func TestExchange(t *testing.T) {
+	mock, provider := newTestProvider(t)
+	ctx := context.Background()
+
+	code, codeVerifier, nonce := authorize(t, mock, provider, "subject-1")
+
+	token, err := provider.Exchange(ctx, testClientID, "", testRedirectURI, code, codeVerifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	idToken, err := provider.VerifyIDToken(ctx, token.IDToken, testClientID, nonce, time.Now())
+	if err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	if idToken.Subject != "subject-1" || idToken.Issuer != mock.Issuer {
+		t.Errorf("VerifyIDToken: got subject %q of %q", idToken.Subject, idToken.Issuer)
+	}
+
+	// Codes can only be redeemed once
+	_, err = provider.Exchange(ctx, testClientID, "", testRedirectURI, code, codeVerifier)
+	if !isTokenError(err, "invalid_grant") {
+		t.Errorf("Exchange of used code: got %v, want invalid_grant", err)
+	}
+}
+
+func TestExchangeWrongCodeVerifier(t *testing.T) {
+	mock, provider := newTestProvider(t)
+
+	code, _, _ := authorize(t, mock, provider, "subject-1")
+	otherVerifier, err := NewCodeVerifier()
+	if err != nil {
+		t.Fatalf("NewCodeVerifier: %v", err)
+	}
+
+	_, err = provider.Exchange(context.Background(), testClientID, "", testRedirectURI, code, otherVerifier)
+	if !isTokenError(err, "invalid_grant") {
+		t.Errorf("Exchange: got %v, want invalid_grant", err)
+	}
+}
+
+func isTokenError(err error, code string) bool {
+	var tokenErr *tokenError
+	return errors.As(err, &tokenErr) && tokenErr.Code == code
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	mock, provider := newTestProvider(t)
+	ctx := context.Background()
+
+	claims := mock.Claims("subject-1")
+	claims["nonce"] = "nonce"
+
+	valid, err := mock.SignIDToken("EdDSA", claims)
+	if err != nil {
+		t.Fatalf("SignIDToken: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		idToken func() string
+		want    error
+	}{
+		{name: "valid", idToken: func() string { return valid }},
+		{name: "HS256", idToken: func() string { return sign(t, mock, "HS256", claims) }, want: ErrUnsupportedAlg},
+		{name: "none", idToken: func() string { return sign(t, mock, "none", claims) }, want: ErrUnsupportedAlg},
+		{name: "tampered payload", idToken: func() string { return tamper(t, valid) }, want: ErrBadSignature},
+		{name: "not a JWT", idToken: func() string { return "abc.def" }, want: ErrInvalidIDToken},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := provider.VerifyIDToken(ctx, test.idToken(), testClientID, "nonce", time.Now())
+			if !errors.Is(err, test.want) {
+				t.Errorf("VerifyIDToken: got %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func sign(t *testing.T, mock *oidctest.Provider, algorithm string, claims map[string]interface{}) string {
+	t.Helper()
+
+	idToken, err := mock.SignIDToken(algorithm, claims)
+	if err != nil {
+		t.Fatalf("SignIDToken: %v", err)
+	}
+	return idToken
+}
+
+// tamper changes the subject of a signed token
+func tamper(t *testing.T, idToken string) string {
+	t.Helper()
+
+	parts := splitToken(t, idToken)
+	claims := make(map[string]interface{})
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		t.Fatalf("decodeSegment: %v", err)
+	}
+
+	claims["sub"] = "subject-2"
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	return parts[0] + "." + encodeSegment(payload) + "." + parts[2]
+}
+
+func TestCheckClaims(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	issuer := "https://id.example.org"
+
+	valid := func() *idTokenClaims {
+		return &idTokenClaims{
+			Issuer:    issuer,
+			Subject:   "subject-1",
+			Audience:  json.RawMessage(`"library"`),
+			Nonce:     "nonce",
+			ExpiresAt: now.Add(time.Minute).Unix(),
+			IssuedAt:  now.Unix(),
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(claims *idTokenClaims)
+		want   error
+	}{
+		{name: "valid", change: func(claims *idTokenClaims) {}},
+		{name: "audience list with azp", change: func(claims *idTokenClaims) {
+			claims.Audience = json.RawMessage(`["library","api"]`)
+			claims.AuthorizedParty = "library"
+		}},
+		{name: "other issuer", change: func(claims *idTokenClaims) { claims.Issuer = "https://evil.example.org" }, want: ErrClaimMismatch},
+		{name: "no subject", change: func(claims *idTokenClaims) { claims.Subject = "" }, want: ErrClaimMismatch},
+		{name: "other audience", change: func(claims *idTokenClaims) { claims.Audience = json.RawMessage(`"other"`) }, want: ErrClaimMismatch},
+		{name: "malformed audience", change: func(claims *idTokenClaims) { claims.Audience = json.RawMessage(`42`) }, want: ErrClaimMismatch},
+		{name: "audience list without azp", change: func(claims *idTokenClaims) {
+			claims.Audience = json.RawMessage(`["library","api"]`)
+		}, want: ErrClaimMismatch},
+		{name: "other azp", change: func(claims *idTokenClaims) { claims.AuthorizedParty = "other" }, want: ErrClaimMismatch},
+		{name: "other nonce", change: func(claims *idTokenClaims) { claims.Nonce = "replayed" }, want: ErrClaimMismatch},
+		{name: "expired", change: func(claims *idTokenClaims) { claims.ExpiresAt = now.Add(-2 * time.Minute).Unix() }, want: ErrExpiredIDToken},
+		{name: "expired within clock skew", change: func(claims *idTokenClaims) { claims.ExpiresAt = now.Add(-30 * time.Second).Unix() }},
+		{name: "no expiry", change: func(claims *idTokenClaims) { claims.ExpiresAt = 0 }, want: ErrExpiredIDToken},
+		{name: "issued in the future", change: func(claims *idTokenClaims) { claims.IssuedAt = now.Add(time.Hour).Unix() }, want: ErrClaimMismatch},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := valid()
+			test.change(claims)
+
+			err := checkClaims(claims, issuer, "library", "nonce", now)
+			if !errors.Is(err, test.want) {
+				t.Errorf("checkClaims: got %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenUnknownKey(t *testing.T) {
+	mock, provider := newTestProvider(t)
+
+	claims := mock.Claims("subject-1")
+	parts := splitToken(t, sign(t, mock, "EdDSA", claims))
+	header := encodeSegment([]byte(`{"alg":"EdDSA","kid":"rotated-away"}`))
+
+	_, err := provider.VerifyIDToken(context.Background(), header+"."+parts[1]+"."+parts[2], testClientID, "", time.Now())
+	if !errors.Is(err, ErrUnknownSigningKey) {
+		t.Errorf("VerifyIDToken: got %v, want ErrUnknownSigningKey", err)
+	}
+}
+
+func splitToken(t *testing.T, idToken string) []string {
+	t.Helper()
+
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		t.Fatalf("token has %v parts", len(parts))
+	}
+	return parts
+}
+
+func encodeSegment(raw []byte) string {
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
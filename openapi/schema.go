@@ -0,0 +1,279 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema is a JSON Schema. The zero value matches any value.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 interface{}        `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	Minimum              *int               `json:"minimum,omitempty"`
+	Maximum              *int               `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// SchemaOf returns the schema of the JSON encoding of the value. Named
+// struct types are added to the components of the document, and the
+// schema refers to them. A nil value has no schema.
+func (d *Document) SchemaOf(value interface{}) *Schema {
+	if value == nil {
+		return nil
+	}
+
+	return d.schema(reflect.TypeOf(value))
+}
+
+func (d *Document) schema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType):
+		return &Schema{}
+	case t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType):
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		zero := 0
+		return &Schema{Type: "integer", Minimum: &zero}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: d.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + d.schemaName(t)}
+	default:
+		// Interfaces hold any value
+		return &Schema{}
+	}
+}
+
+// schemaName adds the schema of the named struct type to the
+// components, under its type name or, if another type has that name,
+// prefixed with its package name.
+func (d *Document) schemaName(t reflect.Type) string {
+	if name, ok := d.schemaNames[t]; ok {
+		return name
+	}
+
+	name := t.Name()
+	if _, taken := d.Components.Schemas[name]; taken {
+		pkg := t.PkgPath()
+		name = pkg[strings.LastIndex(pkg, "/")+1:] + "." + name
+	}
+
+	// The name is taken before the fields are read, so that a type
+	// that refers to itself does not recurse forever
+	d.schemaNames[t] = name
+	d.Components.Schemas[name] = &Schema{}
+	d.Components.Schemas[name] = d.structSchema(t)
+	return name
+}
+
+// structSchema returns the schema of the fields that encoding/json
+// encodes. Fields without omitempty are required, and the fields of
+// embedded structs are promoted unless an outer field has their name.
+// The request bodies that have validate tags only require the fields
+// with the required rule, and their rules limit the field schemas.
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	d.addFields(schema, t, hasValidateTags(t))
+	return schema
+}
+
+func (d *Document) addFields(schema *Schema, t reflect.Type, validated bool) {
+	var embedded []reflect.Type
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, options := tag, ""
+		if comma := strings.Index(tag, ","); comma >= 0 {
+			name, options = tag[:comma], tag[comma:]
+		}
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			embedded = append(embedded, fieldType)
+			continue
+		}
+
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		if _, ok := schema.Properties[name]; ok {
+			continue
+		}
+
+		fieldSchema := d.schema(field.Type)
+		if hasOption(options, "string") && isScalar(fieldType.Kind()) {
+			fieldSchema = &Schema{Type: "string"}
+		}
+
+		if field.Type.Kind() == reflect.Ptr {
+			fieldSchema = nullable(fieldSchema)
+		}
+
+		rules, hasRules := field.Tag.Lookup("validate")
+		if hasRules {
+			fieldSchema = constrain(fieldSchema, fieldType.Kind(), strings.Split(rules, ","))
+		}
+
+		schema.Properties[name] = fieldSchema
+
+		required := !hasOption(options, "omitempty")
+		if validated {
+			required = hasRules && hasOption(","+rules, "required")
+		}
+
+		if required {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	for _, embeddedType := range embedded {
+		d.addFields(schema, embeddedType, validated)
+	}
+}
+
+func hasValidateTags(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if _, ok := t.Field(i).Tag.Lookup("validate"); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// constrain adds the limits and formats of the validate rules of a
+// field to its schema. Rules that JSON Schema cannot express are left
+// out.
+func constrain(schema *Schema, kind reflect.Kind, rules []string) *Schema {
+	// A reference cannot have siblings that limit it
+	if schema.Ref != "" {
+		return schema
+	}
+
+	for _, item := range rules {
+		rule, arg := item, ""
+		if equals := strings.Index(item, "="); equals >= 0 {
+			rule, arg = item[:equals], item[equals+1:]
+		}
+
+		switch rule {
+		case "min", "max":
+			limit, err := strconv.Atoi(arg)
+			if err != nil {
+				continue
+			}
+
+			switch {
+			case kind == reflect.String && rule == "min":
+				schema.MinLength = &limit
+			case kind == reflect.String:
+				schema.MaxLength = &limit
+			case (kind == reflect.Slice || kind == reflect.Map) && rule == "min":
+				schema.MinItems = &limit
+			case kind == reflect.Slice || kind == reflect.Map:
+				schema.MaxItems = &limit
+			case rule == "min":
+				schema.Minimum = &limit
+			default:
+				schema.Maximum = &limit
+			}
+		case "uuid", "email":
+			schema.Format = rule
+		case "isbn":
+			schema.Description = "An ISBN-10 or ISBN-13"
+		}
+	}
+
+	return schema
+}
+
+// nullable returns a schema that also matches null
+func nullable(schema *Schema) *Schema {
+	if typeName, ok := schema.Type.(string); ok && schema.Ref == "" {
+		schema.Type = []string{typeName, "null"}
+		return schema
+	}
+
+	return &Schema{AnyOf: []*Schema{schema, {Type: "null"}}}
+}
+
+// isScalar returns whether the ",string" option applies to the kind
+func isScalar(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+func hasOption(options, option string) bool {
+	for _, item := range strings.Split(options, ",") {
+		if item == option {
+			return true
+		}
+	}
+	return false
+}
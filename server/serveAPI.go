@@ -5,14 +5,18 @@ import (
 	"compress/gzip"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/rjseymour66/library-go/config"
 	"github.com/rjseymour66/library-go/handler"
 	"github.com/rjseymour66/library-go/util"
 )
@@ -56,6 +60,7 @@ func (handlerAPI *handlerAPI) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	request.Body = requestBody
 	request.URL = r.URL
 	request.Method = r.Method
+	request.ClientIP = clientIP(r)
 
 	// response for req is generated by a core layer function
 	var response interface{}
@@ -83,6 +88,34 @@ func (handlerAPI *handlerAPI) ServeHTTP(w http.ResponseWriter, r *http.Request)
 			}
 		}()
 
+		// Streamed responses are written as they are generated
+		if stream, ok := response.(*util.StreamResponse); ok && err == nil {
+			httpResponseStatus = http.StatusOK
+			logResponseBody = stream.ContentType
+
+			writer.Header().Set("Content-Type", stream.ContentType)
+			if stream.FileName != "" {
+				writer.Header().Set("Content-Disposition", "attachment; filename=\""+stream.FileName+"\"")
+			}
+			writer.WriteHeader(httpResponseStatus)
+
+			err = stream.WriteBody(writer)
+			if err != nil {
+				log.Printf("Failed to stream response: %v\n", err)
+			}
+			return
+		}
+
+		if allow, ok := response.(*util.AllowResponse); ok {
+			writer.Header().Set("Allow", strings.Join(allow.Methods, ", "))
+
+			if err == nil {
+				httpResponseStatus = http.StatusNoContent
+				writer.WriteHeader(httpResponseStatus)
+				return
+			}
+		}
+
 		if err == nil {
 			httpResponseStatus = http.StatusOK
 		} else {
@@ -91,6 +124,8 @@ func (handlerAPI *handlerAPI) ServeHTTP(w http.ResponseWriter, r *http.Request)
 				response = util.ErrorResponse{
 					ErrorCode: errorCode,
 					Cause:     cause,
+					Reference: util.GetErrorReference(err),
+					Fields:    util.GetErrorFields(err),
 				}
 
 				httpResponseStatus = util.MapErrorTypeToHTTPStatus(errorType)
@@ -100,6 +135,10 @@ func (handlerAPI *handlerAPI) ServeHTTP(w http.ResponseWriter, r *http.Request)
 			}
 		}
 
+		if paged, ok := response.(util.PagedResponse); ok && err == nil {
+			setLinkHeader(writer.Header(), r.URL, paged.PageLinks())
+		}
+
 		responseBuffer := handlerAPI.bufferPool.Get().(*bytes.Buffer)
 		responseBuffer.Reset()
 
@@ -156,6 +195,49 @@ func (handlerAPI *handlerAPI) makeResponseBody(shouldGZip bool,
 	return rawBody
 }
 
+// setLinkHeader adds a Link header with the page links of a listing.
+// The links are the request URI with the query parameters of the page.
+func setLinkHeader(header http.Header, requestURL *url.URL, links []util.PageLink) {
+	values := make([]string, 0, len(links))
+
+	for _, link := range links {
+		query := requestURL.Query()
+		for key, value := range link.Params {
+			if value == "" {
+				query.Del(key)
+			} else {
+				query.Set(key, value)
+			}
+		}
+
+		target := url.URL{Path: requestURL.Path, RawQuery: query.Encode()}
+		values = append(values, fmt.Sprintf("<%v>; rel=\"%v\"", target.String(), link.Rel))
+	}
+
+	if len(values) > 0 {
+		header.Set("Link", strings.Join(values, ", "))
+	}
+}
+
+// clientIP returns the IP address of the client. Behind a trusted
+// reverse proxy, it is the last address the proxy appended to
+// X-Forwarded-For, since the client can forge the ones before it.
+func clientIP(r *http.Request) string {
+	if config.GetHTTPTrustForwardedFor() {
+		forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+		last := strings.TrimSpace(forwarded[len(forwarded)-1])
+		if last != "" {
+			return last
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 func trimEOL(json string) string {
 	n := len(json)
 	if n > 0 && json[n-1] == '\n' {
@@ -10,25 +10,61 @@ import (
 // HTTP error status code (ex: 401).
 var (
 	ErrBadRequest       = errors.New("Bad Request.")
+	ErrConflict         = errors.New("Conflict.")
+	ErrForbidden        = errors.New("Forbidden.")
 	ErrInternal         = errors.New("Internal error.")
 	ErrInvalidAPICall   = errors.New("Invalid API call.")
+	ErrMethodNotAllowed = errors.New("Method not allowed.")
 	ErrNotAuthenticated = errors.New("Not authenticated.")
 	ErrResourceNotFound = errors.New("Resource not found.")
+	ErrTooManyRequests  = errors.New("Too many requests.")
 )
 
 // ErrorResponse is sent to clients when an error is returned.
+// Reference identifies the record the error is about, such as the
+// existing book when creating a duplicate. Fields lists every invalid
+// field of a request body that failed validation.
 type ErrorResponse struct {
 	ErrorCode int
 	Cause     string
+	Reference string       `json:",omitempty"`
+	Fields    []FieldError `json:",omitempty"`
 }
 
+// FieldError tells why a field of a request body is invalid. Field is
+// the name of the field in the JSON body.
+type FieldError struct {
+	Field   string
+	Code    string
+	Message string
+}
+
+// Field error codes
+const (
+	FieldCodeRequired      = "required"
+	FieldCodeTooShort      = "too_short"
+	FieldCodeTooLong       = "too_long"
+	FieldCodeInvalidFormat = "invalid_format"
+	FieldCodeInvalidType   = "invalid_type"
+	FieldCodeUnknownField  = "unknown_field"
+)
+
 // Error codes
 const (
 	ErrorCodeInternal           = 0
 	ErrorCodeInvalidJSONBody    = 30
+	ErrorCodeInvalidMARCRecord  = 31
+	ErrorCodeInvalidCSV         = 32
 	ErrorCodeInvalidCredentials = 201
+	ErrorCodeLoginLocked        = 202
+	ErrorCodeAccountNotActive   = 203
+	ErrorCodePermissionDenied   = 204
 	ErrorCodeEntityNotFound     = 404
+	ErrorCodeDuplicateISBN      = 409
+	ErrorCodeDuplicateUsername  = 410
+	ErrorCodeDuplicateRoleName  = 411
 	ErrorCodeValidation         = 500
+	ErrorCodeOutstandingFines   = 501
 )
 
 // serverError represents the error that is used in the server
@@ -36,6 +72,8 @@ type serverError struct {
 	code      int
 	cause     string
 	errorType error
+	reference string
+	fields    []FieldError
 }
 
 // serverError implements the Error() interface, which has only one method named Error() that returns a string
@@ -53,6 +91,22 @@ var (
 
 	// NewError creates a new Error object
 	NewError = newError
+
+	// NewErrorWithReference creates a new Error object that points
+	// to the record the error is about
+	NewErrorWithReference = newErrorWithReference
+
+	// GetErrorReference returns the reference of a serverError. If
+	// err is not a serverError, returns an empty string
+	GetErrorReference = getErrorReference
+
+	// NewValidationError creates a new Error object for a request
+	// body with invalid fields
+	NewValidationError = newValidationError
+
+	// GetErrorFields returns the invalid fields of a serverError. If
+	// err is not a serverError, returns nil
+	GetErrorFields = getErrorFields
 )
 
 // mapErrorTypeToHTTPStatus maps an error to its corresponding
@@ -61,12 +115,20 @@ func mapErrorTypeToHTTPStatus(err error) int {
 	switch err {
 	case ErrBadRequest:
 		return http.StatusBadRequest
+	case ErrConflict:
+		return http.StatusConflict
 	case ErrInternal:
 		return http.StatusInternalServerError
 	case ErrInvalidAPICall, ErrResourceNotFound:
 		return http.StatusNotFound
+	case ErrMethodNotAllowed:
+		return http.StatusMethodNotAllowed
 	case ErrNotAuthenticated:
 		return http.StatusUnauthorized
+	case ErrForbidden:
+		return http.StatusForbidden
+	case ErrTooManyRequests:
+		return http.StatusTooManyRequests
 	default:
 		return http.StatusInternalServerError
 	}
@@ -91,5 +153,41 @@ func newError(cause string, code int, errorType, err error) error {
 		log.Printf("error: %v:", cause)
 	}
 
-	return serverError{code, cause, errorType}
+	return serverError{code, cause, errorType, "", nil}
+}
+
+// newErrorWithReference returns a serverError that carries the ID of
+// the record the error is about.
+func newErrorWithReference(cause string, code int, reference string, errorType, err error) error {
+	if err != nil {
+		log.Printf("error: %v (%v): %v", cause, reference, err)
+	} else {
+		log.Printf("error: %v (%v):", cause, reference)
+	}
+
+	return serverError{code, cause, errorType, reference, nil}
+}
+
+// newValidationError returns a serverError with ErrorCodeValidation
+// that lists the invalid fields.
+func newValidationError(cause string, fields []FieldError) error {
+	log.Printf("error: %v: %v", cause, fields)
+
+	return serverError{ErrorCodeValidation, cause, ErrBadRequest, "", fields}
+}
+
+func getErrorReference(err error) string {
+	serverErr, isError := err.(serverError)
+	if !isError {
+		return ""
+	}
+	return serverErr.reference
+}
+
+func getErrorFields(err error) []FieldError {
+	serverErr, isError := err.(serverError)
+	if !isError {
+		return nil
+	}
+	return serverErr.fields
 }
@@ -0,0 +1,93 @@
+package util
+
+import "strings"
+
+var (
+	// NormalizeISBN validates an ISBN-10 or ISBN-13 and returns it
+	// as an ISBN-13 without separators. If the ISBN is invalid,
+	// returns false
+	NormalizeISBN = normalizeISBN
+
+	// ISBN13To10 returns the ISBN-10 form of a normalized ISBN-13.
+	// ISBN-13s outside the 978 prefix have no ISBN-10 form and
+	// return an empty string
+	ISBN13To10 = isbn13To10
+)
+
+func normalizeISBN(isbn string) (string, bool) {
+	isbn = strings.ToUpper(isbn)
+	isbn = strings.NewReplacer("-", "", " ", "").Replace(isbn)
+
+	switch len(isbn) {
+	case 10:
+		if !isValidISBN10(isbn) {
+			return "", false
+		}
+		isbn13 := "978" + isbn[:9]
+		return isbn13 + string(isbn13CheckDigit(isbn13)), true
+	case 13:
+		if !isDigits(isbn) || isbn13CheckDigit(isbn[:12]) != isbn[12] {
+			return "", false
+		}
+		return isbn, true
+	default:
+		return "", false
+	}
+}
+
+func isbn13To10(isbn13 string) string {
+	if len(isbn13) != 13 || !strings.HasPrefix(isbn13, "978") {
+		return ""
+	}
+
+	isbn10 := isbn13[3:12]
+	return isbn10 + string(isbn10CheckDigit(isbn10))
+}
+
+func isValidISBN10(isbn string) bool {
+	if !isDigits(isbn[:9]) {
+		return false
+	}
+	return isbn10CheckDigit(isbn[:9]) == isbn[9]
+}
+
+// isbn10CheckDigit returns the check digit for the first 9 digits
+// of an ISBN-10. The digits are weighted 10 down to 2 and the check
+// digit makes the sum divisible by 11, with X standing for 10.
+func isbn10CheckDigit(digits string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += (10 - i) * int(digits[i]-'0')
+	}
+
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 'X'
+	}
+	return byte('0' + check)
+}
+
+// isbn13CheckDigit returns the check digit for the first 12 digits
+// of an ISBN-13. The digits are weighted alternately 1 and 3 and the
+// check digit makes the sum divisible by 10.
+func isbn13CheckDigit(digits string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += weight * int(digits[i]-'0')
+	}
+
+	return byte('0' + (10-sum%10)%10)
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
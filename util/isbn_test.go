@@ -0,0 +1,56 @@
+package util
+
+import "testing"
+
+func TestNormalizeISBN(t *testing.T) {
+	tests := []struct {
+		name string
+		isbn string
+		want string
+		ok   bool
+	}{
+		{name: "ISBN-13", isbn: "9780306406157", want: "9780306406157", ok: true},
+		{name: "hyphenated ISBN-13", isbn: "978-0-306-40615-7", want: "9780306406157", ok: true},
+		{name: "ISBN-13 with spaces", isbn: "978 0 306 40615 7", want: "9780306406157", ok: true},
+		{name: "ISBN-10", isbn: "0306406152", want: "9780306406157", ok: true},
+		{name: "hyphenated ISBN-10", isbn: "0-306-40615-2", want: "9780306406157", ok: true},
+		{name: "ISBN-10 with X", isbn: "080442957X", want: "9780804429573", ok: true},
+		{name: "ISBN-10 with lowercase x", isbn: "0-8044-2957-x", want: "9780804429573", ok: true},
+		{name: "ISBN-13 checksum", isbn: "9780306406158"},
+		{name: "ISBN-10 checksum", isbn: "0306406153"},
+		{name: "ISBN-10 with X for a digit", isbn: "030640615X"},
+		{name: "X outside check digit", isbn: "X306406152"},
+		{name: "ISBN-13 with X", isbn: "978030640615X"},
+		{name: "letters", isbn: "978O306406157"},
+		{name: "too short", isbn: "978030640615"},
+		{name: "too long", isbn: "97803064061570"},
+		{name: "empty", isbn: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := NormalizeISBN(test.isbn)
+			if got != test.want || ok != test.ok {
+				t.Errorf("NormalizeISBN(%q): got %q, %v, want %q, %v", test.isbn, got, ok, test.want, test.ok)
+			}
+		})
+	}
+}
+
+func TestISBN13To10(t *testing.T) {
+	tests := []struct {
+		isbn13 string
+		want   string
+	}{
+		{isbn13: "9780306406157", want: "0306406152"},
+		{isbn13: "9780804429573", want: "080442957X"},
+		{isbn13: "9791032300824", want: ""},
+		{isbn13: "978030640615", want: ""},
+	}
+
+	for _, test := range tests {
+		if got := ISBN13To10(test.isbn13); got != test.want {
+			t.Errorf("ISBN13To10(%q): got %q, want %q", test.isbn13, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package util
+
+import "io"
+
+// StreamResponse is returned by core functions whose response is not
+// JSON, such as file exports. The server sets the headers and calls
+// WriteBody with the HTTP response writer instead of encoding the
+// response.
+type StreamResponse struct {
+	ContentType string
+	FileName    string
+	WriteBody   func(writer io.Writer) error
+}
+
+// PageLink points to another page of a listing. Params replace the
+// query parameters of the request, and an empty value removes one.
+type PageLink struct {
+	Rel    string
+	Params map[string]string
+}
+
+// PagedResponse is implemented by the responses of listings. The
+// server sends their page links in an RFC 8288 Link header.
+type PagedResponse interface {
+	PageLinks() []PageLink
+}
+
+// AllowResponse lists the methods a resource allows. The server sends
+// them in an Allow header, with 204 No Content when it answers an
+// OPTIONS request, or with the error of a method the resource does
+// not allow.
+type AllowResponse struct {
+	Methods []string
+}
@@ -0,0 +1,393 @@
+// Package validate decodes JSON request bodies and checks their fields
+// against the rules in the validate tags of the request struct, as in
+//
+//	BookName string `validate:"trim,required,max=255"`
+//
+// The rules, which run in order until one fails, are:
+//
+//	trim      removes leading and trailing white space
+//	required  the value is not empty or zero
+//	min=N     strings have at least N characters, numbers are at
+//	          least N and lists have at least N items
+//	max=N     the same, at most N
+//	isbn      an ISBN-10 or ISBN-13
+//	uuid      a UUID
+//	email     an email address
+//
+// Format rules accept empty values, so that optional fields only need
+// to be valid when they are set.
+//
+// The tags of a struct are parsed the first time it is validated. A
+// tag with an unknown rule, or a rule that does not apply to the type
+// of its field, makes Decode and Struct fail with ErrInvalidTag; run
+// CheckTags on every request struct in a test to catch them early.
+package validate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/rjseymour66/library-go/util"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+var (
+	// ErrInvalidTag is returned for a struct with a validate tag
+	// that cannot be checked. Tags are written by developers, so it
+	// is a bug rather than a bad request
+	ErrInvalidTag = errors.New("Invalid validate tag")
+
+	// ErrNotObject is returned by Decode for a body that is not a
+	// JSON object, such as null
+	ErrNotObject = errors.New("Request body is not a JSON object")
+)
+
+// rule is a parsed rule of a validate tag. limit is the argument of
+// min and max.
+type rule struct {
+	name  string
+	limit int64
+}
+
+// fieldRules are the rules of a field of a struct
+type fieldRules struct {
+	index int
+	name  string
+	rules []rule
+}
+
+// structRules caches the parsed rules of each struct type
+var structRules sync.Map
+
+// Decode decodes a JSON object into the struct that request points to
+// and validates it. Members of the object that the struct has no field
+// for are invalid, and so are values of the wrong type. fields lists
+// every invalid field, and err is only set when the body is not a JSON
+// object.
+func Decode(body io.Reader, request interface{}) (fields []util.FieldError, err error) {
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		return
+	}
+
+	v := reflect.ValueOf(request).Elem()
+	t := v.Type()
+
+	allRules, err := rulesOf(t)
+	if err != nil {
+		return
+	}
+
+	var object map[string]json.RawMessage
+	err = json.Unmarshal(raw, &object)
+	if err != nil {
+		return
+	}
+
+	// null decodes into a nil map without an error
+	if object == nil {
+		return nil, ErrNotObject
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	decoded := make(map[int]bool)
+	invalid := make(map[string]bool)
+
+	for _, name := range names {
+		// encoding/json prefers an exact match of the field name
+		index := fieldIndex(t, name, false)
+		if index < 0 {
+			index = fieldIndex(t, name, true)
+		}
+
+		if index < 0 || decoded[index] {
+			fields = append(fields, util.FieldError{
+				Field:   name,
+				Code:    util.FieldCodeUnknownField,
+				Message: name + " is not a field of the request",
+			})
+			continue
+		}
+		decoded[index] = true
+
+		decoder := json.NewDecoder(bytes.NewReader(object[name]))
+		errField := decoder.Decode(v.Field(index).Addr().Interface())
+		if errField != nil {
+			jsonName := fieldName(t.Field(index))
+			invalid[jsonName] = true
+			fields = append(fields, util.FieldError{
+				Field:   jsonName,
+				Code:    util.FieldCodeInvalidType,
+				Message: jsonName + " has a value of the wrong type",
+			})
+		}
+	}
+
+	// A field of the wrong type would also break its rules
+	for _, field := range checkStruct(v, allRules) {
+		if !invalid[field.Field] {
+			fields = append(fields, field)
+		}
+	}
+
+	return
+}
+
+// Struct checks the fields of the struct that value points to against
+// their rules, and returns every field that breaks one.
+func Struct(value interface{}) (fields []util.FieldError, err error) {
+	v := reflect.ValueOf(value).Elem()
+
+	allRules, err := rulesOf(v.Type())
+	if err != nil {
+		return
+	}
+
+	return checkStruct(v, allRules), nil
+}
+
+// CheckTags parses the validate tags of the struct that value points
+// to, and returns an error wrapping ErrInvalidTag for the first one
+// with an unknown rule or a rule that does not apply to its field.
+func CheckTags(value interface{}) error {
+	t := reflect.TypeOf(value)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct {
+		return fmt.Errorf("%w: %v is not a struct", ErrInvalidTag, t)
+	}
+
+	_, err := rulesOf(t)
+	return err
+}
+
+func checkStruct(v reflect.Value, allRules []fieldRules) (fields []util.FieldError) {
+	for _, field := range allRules {
+		fieldErr := checkField(v.Field(field.index), field.name, field.rules)
+		if fieldErr != nil {
+			fields = append(fields, *fieldErr)
+		}
+	}
+
+	return
+}
+
+// rulesOf returns the parsed rules of the fields of the struct type
+func rulesOf(t reflect.Type) ([]fieldRules, error) {
+	if cached, ok := structRules.Load(t); ok {
+		return cached.([]fieldRules), nil
+	}
+
+	var allRules []fieldRules
+	for i := 0; i < t.NumField(); i++ {
+		tag, ok := t.Field(i).Tag.Lookup("validate")
+		if !ok {
+			continue
+		}
+
+		rules, err := parseRules(t.Field(i), tag)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v.%v: %v", ErrInvalidTag, t.Name(), t.Field(i).Name, err)
+		}
+
+		allRules = append(allRules, fieldRules{index: i, name: fieldName(t.Field(i)), rules: rules})
+	}
+
+	structRules.Store(t, allRules)
+	return allRules, nil
+}
+
+// parseRules parses a validate tag and checks that its rules apply to
+// the type of the field
+func parseRules(field reflect.StructField, tag string) (rules []rule, err error) {
+	for _, item := range strings.Split(tag, ",") {
+		name, arg := item, ""
+		if equals := strings.Index(item, "="); equals >= 0 {
+			name, arg = item[:equals], item[equals+1:]
+		}
+
+		r := rule{name: name}
+
+		switch name {
+		case "trim", "required":
+		case "min", "max":
+			r.limit, err = strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%v needs a number, got %q", name, arg)
+			}
+
+			if !hasSize(field.Type) {
+				return nil, fmt.Errorf("%v does not apply to %v", name, field.Type)
+			}
+		case "isbn", "uuid", "email":
+			if field.Type.Kind() != reflect.String {
+				return nil, fmt.Errorf("%v does not apply to %v", name, field.Type)
+			}
+		default:
+			return nil, fmt.Errorf("unknown rule %q", name)
+		}
+
+		if arg != "" && name != "min" && name != "max" {
+			return nil, fmt.Errorf("%v takes no argument", name)
+		}
+
+		rules = append(rules, r)
+	}
+
+	return
+}
+
+func checkField(value reflect.Value, name string, rules []rule) *util.FieldError {
+	for _, r := range rules {
+		switch r.name {
+		case "trim":
+			trim(value)
+		case "required":
+			if isEmpty(value) {
+				return &util.FieldError{Field: name, Code: util.FieldCodeRequired, Message: name + " is required"}
+			}
+		case "min":
+			if size(value) < r.limit {
+				return &util.FieldError{Field: name, Code: util.FieldCodeTooShort, Message: name + " must be at least " + describeLimit(value, r.limit)}
+			}
+		case "max":
+			if size(value) > r.limit {
+				return &util.FieldError{Field: name, Code: util.FieldCodeTooLong, Message: name + " must be at most " + describeLimit(value, r.limit)}
+			}
+		case "isbn":
+			if _, ok := util.NormalizeISBN(value.String()); !ok && value.String() != "" {
+				return &util.FieldError{Field: name, Code: util.FieldCodeInvalidFormat, Message: name + " is not a valid ISBN"}
+			}
+		case "uuid":
+			if !uuidPattern.MatchString(value.String()) && value.String() != "" {
+				return &util.FieldError{Field: name, Code: util.FieldCodeInvalidFormat, Message: name + " is not a valid UUID"}
+			}
+		case "email":
+			if _, err := mail.ParseAddress(value.String()); err != nil && value.String() != "" {
+				return &util.FieldError{Field: name, Code: util.FieldCodeInvalidFormat, Message: name + " is not a valid email address"}
+			}
+		}
+	}
+
+	return nil
+}
+
+// fieldIndex returns the index of the exported field that encoding/json
+// decodes the member name into, or -1.
+func fieldIndex(t reflect.Type, name string, foldCase bool) int {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" || field.Tag.Get("json") == "-" {
+			continue
+		}
+
+		jsonName := fieldName(field)
+		if jsonName == name || (foldCase && strings.EqualFold(jsonName, name)) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// fieldName returns the name of the field in the JSON body
+func fieldName(field reflect.StructField) string {
+	name := field.Tag.Get("json")
+	if comma := strings.Index(name, ","); comma >= 0 {
+		name = name[:comma]
+	}
+
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+func trim(value reflect.Value) {
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(strings.TrimSpace(value.String()))
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			trim(value.Index(i))
+		}
+	case reflect.Ptr:
+		if !value.IsNil() {
+			trim(value.Elem())
+		}
+	}
+}
+
+func isEmpty(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	default:
+		return value.IsZero()
+	}
+}
+
+// hasSize returns whether min and max apply to the type
+func hasSize(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Slice, reflect.Map:
+		return true
+	case reflect.Ptr:
+		return hasSize(t.Elem())
+	default:
+		return false
+	}
+}
+
+// size returns the number of characters of a string, the value of a
+// number or the length of a list. parseRules only lets min and max
+// onto types that hasSize accepts.
+func size(value reflect.Value) int64 {
+	switch value.Kind() {
+	case reflect.String:
+		return int64(utf8.RuneCountInString(value.String()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int()
+	case reflect.Slice, reflect.Map:
+		return int64(value.Len())
+	case reflect.Ptr:
+		if value.IsNil() {
+			return 0
+		}
+		return size(value.Elem())
+	default:
+		return 0
+	}
+}
+
+func describeLimit(value reflect.Value, limit int64) string {
+	count := strconv.FormatInt(limit, 10)
+
+	switch value.Kind() {
+	case reflect.String:
+		return count + " characters long"
+	case reflect.Slice, reflect.Map:
+		return count + " items long"
+	default:
+		return count
+	}
+}
@@ -0,0 +1,196 @@
+package validate
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rjseymour66/library-go/util"
+)
+
+type bookRequest struct {
+	BookName string   `validate:"trim,required,max=10"`
+	ISBN     string   `validate:"trim,isbn"`
+	Copies   int64    `validate:"min=1,max=5"`
+	Tags     []string `json:"tags" validate:"trim,max=2"`
+	Internal string   `json:"-"`
+	Note     string
+}
+
+// field returns the field and code of a field error, which is all the
+// tests compare
+func field(name, code string) util.FieldError {
+	return util.FieldError{Field: name, Code: code}
+}
+
+func codes(fields []util.FieldError) []util.FieldError {
+	result := make([]util.FieldError, 0, len(fields))
+	for _, f := range fields {
+		result = append(result, field(f.Field, f.Code))
+	}
+	return result
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []util.FieldError
+	}{
+		{name: "valid", body: `{"BookName":" Dune ","ISBN":"0-306-40615-2","Copies":2,"tags":["sf"]}`, want: []util.FieldError{}},
+		{name: "case-folded names", body: `{"bookname":"Dune","copies":1,"TAGS":[]}`, want: []util.FieldError{}},
+		{name: "unknown field", body: `{"BookName":"Dune","Copies":1,"Author":"Herbert"}`, want: []util.FieldError{
+			field("Author", util.FieldCodeUnknownField),
+		}},
+		{name: "unexported JSON name", body: `{"BookName":"Dune","Copies":1,"Internal":"x"}`, want: []util.FieldError{
+			field("Internal", util.FieldCodeUnknownField),
+		}},
+		{name: "duplicate case-folded keys", body: `{"BookName":"Dune","bookname":"Emma","Copies":1}`, want: []util.FieldError{
+			field("bookname", util.FieldCodeUnknownField),
+		}},
+		{name: "duplicate keys without exact match", body: `{"bookname":"Dune","BOOKNAME":"Emma","Copies":1}`, want: []util.FieldError{
+			field("bookname", util.FieldCodeUnknownField),
+		}},
+		{name: "string for number", body: `{"BookName":"Dune","Copies":"2"}`, want: []util.FieldError{
+			field("Copies", util.FieldCodeInvalidType),
+		}},
+		{name: "number for string", body: `{"BookName":42,"Copies":1}`, want: []util.FieldError{
+			field("BookName", util.FieldCodeInvalidType),
+		}},
+		{name: "object for list", body: `{"BookName":"Dune","Copies":1,"tags":{}}`, want: []util.FieldError{
+			field("tags", util.FieldCodeInvalidType),
+		}},
+		{name: "fraction for integer", body: `{"BookName":"Dune","Copies":1.5}`, want: []util.FieldError{
+			field("Copies", util.FieldCodeInvalidType),
+		}},
+		{name: "null values", body: `{"BookName":null,"Copies":null}`, want: []util.FieldError{
+			field("BookName", util.FieldCodeRequired),
+			field("Copies", util.FieldCodeTooShort),
+		}},
+		{name: "empty object", body: `{}`, want: []util.FieldError{
+			field("BookName", util.FieldCodeRequired),
+			field("Copies", util.FieldCodeTooShort),
+		}},
+		{name: "rules", body: `{"BookName":"  ","ISBN":"123","Copies":6,"tags":["a","b","c"]}`, want: []util.FieldError{
+			field("BookName", util.FieldCodeRequired),
+			field("ISBN", util.FieldCodeInvalidFormat),
+			field("Copies", util.FieldCodeTooLong),
+			field("tags", util.FieldCodeTooLong),
+		}},
+		{name: "length in characters", body: `{"BookName":"Ærøskøbing","Copies":1}`, want: []util.FieldError{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := &bookRequest{}
+			fields, err := Decode(strings.NewReader(test.body), request)
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+
+			if got := codes(fields); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Decode: got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDecodeNotObject(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "null", body: `null`},
+		{name: "empty", body: ``},
+		{name: "array", body: `[{"BookName":"Dune"}]`},
+		{name: "string", body: `"Dune"`},
+		{name: "truncated", body: `{"BookName":"Dune"`},
+		{name: "trailing data", body: `{"BookName":"Dune","Copies":1} {}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Decode(strings.NewReader(test.body), &bookRequest{})
+			if err == nil {
+				t.Errorf("Decode: got no error")
+			}
+		})
+	}
+
+	_, err := Decode(strings.NewReader(`null`), &bookRequest{})
+	if !errors.Is(err, ErrNotObject) {
+		t.Errorf("Decode(null): got %v, want ErrNotObject", err)
+	}
+}
+
+func TestDecodeTrims(t *testing.T) {
+	request := &bookRequest{}
+	_, err := Decode(strings.NewReader(`{"BookName":" Dune\n","Copies":1,"tags":[" sf "]}`), request)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	if request.BookName != "Dune" || !reflect.DeepEqual(request.Tags, []string{"sf"}) {
+		t.Errorf("Decode: got %q and %q", request.BookName, request.Tags)
+	}
+}
+
+func TestCheckTags(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		valid bool
+	}{
+		{name: "valid", value: &bookRequest{}, valid: true},
+		{name: "not a pointer", value: bookRequest{}, valid: true},
+		{name: "unknown rule", value: &struct {
+			Name string `validate:"trim,requird"`
+		}{}},
+		{name: "non-numeric max", value: &struct {
+			Name string `validate:"max=ten"`
+		}{}},
+		{name: "empty min", value: &struct {
+			Name string `validate:"min="`
+		}{}},
+		{name: "max of bool", value: &struct {
+			Active bool `validate:"max=1"`
+		}{}},
+		{name: "uuid of number", value: &struct {
+			ID int64 `validate:"uuid"`
+		}{}},
+		{name: "argument of required", value: &struct {
+			Name string `validate:"required=true"`
+		}{}},
+		{name: "empty tag", value: &struct {
+			Name string `validate:""`
+		}{}},
+		{name: "not a struct", value: new(string)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := CheckTags(test.value)
+			if test.valid && err != nil {
+				t.Errorf("CheckTags: %v", err)
+			}
+			if !test.valid && !errors.Is(err, ErrInvalidTag) {
+				t.Errorf("CheckTags: got %v, want ErrInvalidTag", err)
+			}
+		})
+	}
+}
+
+func TestInvalidTagDoesNotPanic(t *testing.T) {
+	request := &struct {
+		Name string `validate:"trim,requird"`
+	}{}
+
+	if _, err := Decode(strings.NewReader(`{"Name":"Dune"}`), request); !errors.Is(err, ErrInvalidTag) {
+		t.Errorf("Decode: got %v, want ErrInvalidTag", err)
+	}
+
+	if _, err := Struct(request); !errors.Is(err, ErrInvalidTag) {
+		t.Errorf("Struct: got %v, want ErrInvalidTag", err)
+	}
+}
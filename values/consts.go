@@ -1,16 +1,93 @@
 package values
 
-// User role values
+// Built-in user role values. Other roles are created through the API
 const (
 	UserRoleUnknown   = 0
 	UserRoleMember    = 1
 	UserRoleLibrarian = 2
 )
 
+// Permissions. A role grants a set of them, and every route requires
+// one
 const (
-	BookStatusUnkown    = 0
-	BookStatusAvailable = 1
-	BookStatusBorrowed  = 2
+	PermissionBookRead     = "book:read"
+	PermissionBookInspect  = "book:inspect"
+	PermissionBookCreate   = "book:create"
+	PermissionBookUpdate   = "book:update"
+	PermissionBookDelete   = "book:delete"
+	PermissionBookExport   = "book:export"
+	PermissionItemRead     = "item:read"
+	PermissionItemManage   = "item:manage"
+	PermissionLoanSelf     = "loan:self"
+	PermissionHoldSelf     = "hold:self"
+	PermissionLoanRead     = "loan:read"
+	PermissionLoanManage   = "loan:manage"
+	PermissionLoanOverride = "loan:override"
+	PermissionLedgerRead   = "ledger:read"
+	PermissionLedgerManage = "ledger:manage"
+	PermissionUserRead     = "user:read"
+	PermissionUserManage   = "user:manage"
+	PermissionRoleManage   = "role:manage"
+)
+
+// Authentication sources of users. A user logs in through the
+// authenticator with the name of their source
+const (
+	AuthSourceDatabase = "database"
+	AuthSourceLDAP     = "ldap"
+	AuthSourceOIDC     = "oidc"
+)
+
+// User status values. Only active users can be authorized
+const (
+	UserStatusUnknown     = 0
+	UserStatusPending     = 1
+	UserStatusActive      = 2
+	UserStatusRejected    = 3
+	UserStatusSuspended   = 4
+	UserStatusDeactivated = 5
+)
+
+// Book status values. The status is tracked per item (copy)
+const (
+	BookStatusUnkown      = 0
+	BookStatusAvailable   = 1
+	BookStatusBorrowed    = 2
+	BookStatusOnHoldShelf = 3
+)
+
+// Item condition values
+const (
+	ItemConditionUnknown = 0
+	ItemConditionNew     = 1
+	ItemConditionGood    = 2
+	ItemConditionFair    = 3
+	ItemConditionPoor    = 4
+	ItemConditionDamaged = 5
+)
+
+// Hold status values
+const (
+	HoldStatusUnknown   = 0
+	HoldStatusWaiting   = 1
+	HoldStatusReady     = 2
+	HoldStatusFulfilled = 3
+	HoldStatusCancelled = 4
+	HoldStatusExpired   = 5
+)
+
+// Ledger entry type values
+const (
+	LedgerEntryTypeUnknown = 0
+	LedgerEntryTypeFine    = 1
+	LedgerEntryTypePayment = 2
+	LedgerEntryTypeWaiver  = 3
+)
+
+// MARC file format values
+const (
+	MARCFormatMARC21  = "marc21"
+	MARCFormatMARCXML = "marcxml"
 )
 
 const MaxRowLimit = 1000
@@ -4,3 +4,23 @@ package values
 var ContextKeyDbRunner = contextKeyDbRunner{}
 
 type contextKeyDbRunner struct{}
+
+// ContextKeyPrincipal is a key for context.Context to extract the
+// *Principal of an authorized request
+var ContextKeyPrincipal = contextKeyPrincipal{}
+
+type contextKeyPrincipal struct{}
+
+// Principal is the user a request is authorized for
+type Principal struct {
+	UserID string
+	Role   int
+
+	// APIKey is set when the request is authorized with an API key
+	// rather than a session or access token
+	APIKey bool
+
+	// Scopes limits the permissions of the role to these. Nil means
+	// the role is not limited
+	Scopes []string
+}